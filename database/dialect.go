@@ -0,0 +1,72 @@
+// Responsible for the differences between the database engines.
+package database
+
+import (
+	"strconv"
+	"strings"
+)
+
+// SQL flavour of a database engine.
+// Queries are written with "?" placeholders and the SQL understood by all the engines,
+// the dialect only covers what cannot be written portably.
+//
+// Attributes:
+//
+//	name - name of the engine, e.g. "sqlite"
+//	driver - name of the database/sql driver
+//	numbered - true if the placeholders are numbered, e.g. "$1"
+//	noLimit - LIMIT value listing all the rows
+//	lockMigrations - statement locking the migrations until the end of the transaction, empty if not needed
+//	migrations - migrations of the schema for the engine
+type dialect struct {
+	name           string
+	driver         string
+	numbered       bool
+	noLimit        string
+	lockMigrations string
+	migrations     []migration
+}
+
+var sqliteDialect = dialect{
+	name:       "sqlite",
+	driver:     sqliteDriver,
+	noLimit:    "-1",
+	migrations: migrations,
+}
+
+var postgresDialect = dialect{
+	name:     "postgres",
+	driver:   "postgres",
+	numbered: true,
+	noLimit:  "ALL",
+	// Any constant unique to the bot identifies the lock
+	lockMigrations: "SELECT pg_advisory_xact_lock(4242)",
+	migrations:     postgresMigrations,
+}
+
+// Replace the "?" placeholders of the query with the placeholders of the engine.
+//
+// Parameters:
+//
+//	query - query with "?" placeholders, which must not contain "?" in its literals
+//
+// Returns:
+//
+//	string - query for the engine, e.g. "SELECT 1 WHERE id = $1" for PostgreSQL
+func (d dialect) rebind(query string) string {
+	if !d.numbered {
+		return query
+	}
+
+	var builder strings.Builder
+	n := 0
+	for _, r := range query {
+		if r != '?' {
+			builder.WriteRune(r)
+			continue
+		}
+		n++
+		builder.WriteString("$" + strconv.Itoa(n))
+	}
+	return builder.String()
+}
@@ -0,0 +1,190 @@
+// Responsible for importing the databases of the older versions, which kept the offers
+// and the searches in separate files.
+package database
+
+import (
+	"apartment-parser/parser"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"os"
+)
+
+// Get the SQL expression copying the posting time of an untyped offer, NULL unless it is a full timestamp.
+// Times stored as displayed on the site, e.g. "12:30", and the zero time are unknown.
+//
+// Parameters:
+//
+//	column: Name of the column holding the time.
+//
+// Returns:
+//
+//	string: SQL expression of the timestamp or NULL.
+func legacyPostedAt(column string) string {
+	return "CASE WHEN " + column + " GLOB '[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9][ T][0-9][0-9]:[0-9][0-9]*' AND " + column + " NOT LIKE '0001-01-01%' THEN " + column + " END"
+}
+
+// Import the legacy offers and searches databases into the database, once per file.
+// Missing files and files imported before are skipped. Every file is imported in a single transaction.
+// The legacy files are SQLite databases, which are only imported into SQLite databases.
+// The files are attached read-only and never changed, they keep the schema of the first version.
+//
+// Parameters:
+//
+//	offersFile: Name of the legacy offers database file, e.g. "offers.db".
+//	searchesFile: Name of the legacy searches database file, e.g. "searches.db".
+//
+// Returns:
+//
+//	error: Error object.
+//
+// Example:
+//
+//	err := store.ImportLegacyDatabases("offers.db", "searches.db")
+func (s *SQLStore) ImportLegacyDatabases(offersFile, searchesFile string) error {
+	err := s.importLegacyFile(searchesFile, importLegacySearches)
+	if err != nil {
+		return err
+	}
+	return s.importLegacyFile(offersFile, importLegacyOffers)
+}
+
+// Copy the searches of the legacy searches database attached as "legacy", skipping the ones already stored.
+// The file has the schema of the first version, the newer columns get their default values.
+//
+// Parameters:
+//
+//	ctx: Context of the queries.
+//	tx: Transaction of the import.
+//
+// Returns:
+//
+//	error: Error object.
+func importLegacySearches(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO users(id, created_at) SELECT DISTINCT UserID, ? FROM legacy.searches WHERE UserID IS NOT NULL", now())
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO searches(UserID, url) SELECT s.UserID, s.url FROM legacy.searches s WHERE s.UserID IS NOT NULL AND s.url IS NOT NULL AND NOT EXISTS (SELECT 1 FROM searches c WHERE c.UserID = s.UserID AND c.url = s.url) ORDER BY s.id")
+	return err
+}
+
+// Copy the offers of the legacy offers database attached as "legacy", skipping the ones already stored.
+// The file has the schema of the first version, the source and the listing id are found from the urls
+// and the newer columns are left empty.
+//
+// Parameters:
+//
+//	ctx: Context of the queries.
+//	tx: Transaction of the import.
+//
+// Returns:
+//
+//	error: Error object.
+func importLegacyOffers(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO users(id, created_at) SELECT DISTINCT user_id, ? FROM legacy.offers WHERE user_id IS NOT NULL", now())
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT id, url FROM legacy.offers WHERE user_id IS NOT NULL AND url IS NOT NULL ORDER BY id")
+	if err != nil {
+		return err
+	}
+	type listing struct {
+		id         int64
+		source     sql.NullString
+		listing_id sql.NullString
+	}
+	listings := make([]listing, 0)
+	for rows.Next() {
+		var l listing
+		var url string
+		if err := rows.Scan(&l.id, &url); err != nil {
+			rows.Close()
+			return err
+		}
+		if source, err := parser.FindSource(url); err == nil {
+			l.source = sql.NullString{String: source.Name(), Valid: true}
+			l.listing_id = listingId(parser.Offer{ListingId: source.ListingId(url)})
+		}
+		listings = append(listings, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, l := range listings {
+		// The same offer may be stored several times for a user, only the first one is kept
+		_, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO offers(user_id, source, listing_id, url, title, price, additional_payment, location, posted_at, description, rooms, area, floor) SELECT user_id, ?, ?, url, title, CAST(price AS INTEGER), CAST(additional_payment AS INTEGER), location, "+legacyPostedAt("time")+", description, rooms, area, floor FROM legacy.offers WHERE id = ?",
+			l.source, l.listing_id, l.id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Import the legacy database file attached read-only as "legacy" with the copy function, unless it was imported before.
+// The file itself is never changed.
+//
+// Parameters:
+//
+//	file: Name of the legacy database file.
+//	copyRows: Copies the rows of the legacy database within the transaction of the import.
+//
+// Returns:
+//
+//	error: Error object.
+func (s *SQLStore) importLegacyFile(file string, copyRows func(ctx context.Context, tx *sql.Tx) error) error {
+	if _, err := os.Stat(file); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if s.dialect.name != sqliteDialect.name {
+		log.Printf("Skipping the legacy database %s, it can only be imported into a SQLite database", file)
+		return nil
+	}
+
+	var imported bool
+	err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM legacy_imports WHERE file = ?)", file).Scan(&imported)
+	if err != nil || imported {
+		return err
+	}
+
+	// Attached databases belong to a single connection
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "ATTACH DATABASE ? AS legacy", "file:"+file+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "DETACH DATABASE legacy")
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := copyRows(ctx, tx); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO legacy_imports(file, imported_at) VALUES(?, ?)", file, now())
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("Imported the legacy database %s", file)
+	return nil
+}
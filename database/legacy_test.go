@@ -0,0 +1,157 @@
+package database
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Create a legacy database file with the statements.
+func createLegacyDatabase(t *testing.T, file string, statements ...string) {
+	t.Helper()
+	db, err := sql.Open(sqliteDriver, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestImportLegacyDatabases(t *testing.T) {
+	dir := t.TempDir()
+	offersFile, searchesFile := filepath.Join(dir, "offers.db"), filepath.Join(dir, "searches.db")
+
+	// Files of the first version, which stored the times as displayed on the site and the prices as text
+	createLegacyDatabase(t, offersFile,
+		"CREATE TABLE IF NOT EXISTS offers (id INTEGER PRIMARY KEY AUTOINCREMENT, title TEXT, price TEXT, location TEXT, time TEXT, url TEXT, additional_payment TEXT, description TEXT, rooms TEXT, area TEXT, floor TEXT, user_id INTEGER)",
+		"INSERT INTO offers(title, price, location, time, url, additional_payment, description, rooms, area, floor, user_id) VALUES('Kawalerka', '2000', 'Warszawa, Mokotów', '12:30', 'https://www.olx.pl/d/oferta/kawalerka-CID3-ID1.html', '400', 'Opis', 'Liczba pokoi: 1', 'Powierzchnia: 25 m²', 'Poziom: 2', 1)",
+		"INSERT INTO offers(title, price, location, time, url, additional_payment, description, rooms, area, floor, user_id) VALUES('Mieszkanie', '3000', 'Warszawa', '', 'https://www.olx.pl/d/oferta/mieszkanie-CID3-ID2.html', '0', '', '', '', '', 1)",
+		// The same offer stored twice is imported once
+		"INSERT INTO offers(title, price, location, time, url, additional_payment, description, rooms, area, floor, user_id) VALUES('Kawalerka', '2000', 'Warszawa, Mokotów', '12:45', 'https://www.olx.pl/d/oferta/kawalerka-CID3-ID1.html', '400', 'Opis', '', '', '', 1)",
+		"INSERT INTO offers(title, price, location, time, url, additional_payment, description, rooms, area, floor, user_id) VALUES('Pokój', '1500', 'Kraków', '2026-01-02 03:04:05+01:00', 'https://www.olx.pl/d/oferta/pokoj-CID3-ID3.html', '0', '', '', '', '', 2)",
+		"INSERT INTO offers(title, price, location, time, url, additional_payment, description, rooms, area, floor, user_id) VALUES('Dom', '5000', 'Gdańsk', '0001-01-01 00:00:00+00:00', 'https://www.olx.pl/d/oferta/dom-CID3-ID4.html', '0', '', '', '', '', 2)",
+	)
+	createLegacyDatabase(t, searchesFile,
+		"CREATE TABLE IF NOT EXISTS searches (id INTEGER PRIMARY KEY AUTOINCREMENT, UserID INTEGER, url TEXT)",
+		"INSERT INTO searches(UserID, url) VALUES(1, 'https://www.olx.pl/nieruchomosci/mieszkania/wynajem/warszawa/')",
+		"INSERT INTO searches(UserID, url) VALUES(2, 'https://www.olx.pl/nieruchomosci/mieszkania/wynajem/krakow/')",
+	)
+
+	legacyFiles := func() [][]byte {
+		t.Helper()
+		contents := make([][]byte, 0)
+		for _, file := range []string{offersFile, searchesFile} {
+			content, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			contents = append(contents, content)
+		}
+		return contents
+	}
+	before := legacyFiles()
+
+	store, err := Open(filepath.Join(dir, "apartibot.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	for i := 0; i < 2; i++ {
+		// Importing again does nothing
+		if err := store.ImportLegacyDatabases(offersFile, searchesFile); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(legacyFiles(), before) {
+		t.Error("the legacy files changed")
+	}
+
+	for _, user_id := range []int64{1, 2} {
+		searches, err := store.ListSearches(user_id)
+		if err != nil || len(searches) != 1 || !searches[0].Active || searches[0].PriceAlerts {
+			t.Errorf("ListSearches(%d) = %+v, %v, want 1 active search", user_id, searches, err)
+		}
+	}
+
+	offers, err := store.ListOffers(OfferFilter{OrderBy: OrderByID})
+	if err != nil {
+		t.Fatalf("ListOffers = %v", err)
+	}
+	want := []struct {
+		title    string
+		price    int
+		postedAt time.Time
+	}{
+		{"Kawalerka", 2000, time.Time{}},
+		{"Mieszkanie", 3000, time.Time{}},
+		{"Pokój", 1500, time.Date(2026, 1, 2, 2, 4, 5, 0, time.UTC)},
+		{"Dom", 5000, time.Time{}},
+	}
+	if len(offers) != len(want) {
+		t.Fatalf("ListOffers = %+v, want %d offers", offers, len(want))
+	}
+	for i, w := range want {
+		offer := offers[i].Offer
+		if offer.Title != w.title || offer.Price != w.price || !offer.PostedAt.Equal(w.postedAt) {
+			t.Errorf("offer %d = %q for %d posted at %v, want %q for %d posted at %v", i, offer.Title, offer.Price, offer.PostedAt, w.title, w.price, w.postedAt)
+		}
+	}
+	first := offers[0].Offer
+	if first.Source != "olx" || first.ListingId != "1" || first.AdditionalPayment != 400 || first.Rooms != "Liczba pokoi: 1" {
+		t.Errorf("first offer = %+v", first)
+	}
+	if exists, err := store.OfferExists(first, 1); err != nil || !exists {
+		t.Errorf("OfferExists of the imported offer = %v, %v, want true", exists, err)
+	}
+}
+
+func TestMigrateUntypedOffers(t *testing.T) {
+	db, err := sql.Open(sqliteDriver, sqliteSource(filepath.Join(t.TempDir(), "apartibot.db")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &SQLStore{db: db, dialect: sqliteDialect}
+	defer store.Close()
+
+	// Databases at version 4 keep the offers untyped, with the times as displayed on the site
+	if _, err := store.SchemaVersion(); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range migrations[:4] {
+		if _, err := store.applyMigration(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, statement := range []string{
+		"INSERT INTO users(id) VALUES(1)",
+		"INSERT INTO offers(title, price, time, url, user_id) VALUES('Kawalerka', '2000', '12:30', 'https://www.olx.pl/d/oferta/a.html', 1)",
+		"INSERT INTO offers(title, price, time, url, user_id) VALUES('Mieszkanie', '3000', '0001-01-01 00:00:00+00:00', 'https://www.olx.pl/d/oferta/b.html', 1)",
+		"INSERT INTO offers(title, price, time, url, user_id) VALUES('Pokój', '1500', '2026-01-02 03:04:05+01:00', 'https://www.olx.pl/d/oferta/c.html', 1)",
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := store.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	offers, err := store.ListOffers(OfferFilter{OrderBy: OrderByID})
+	if err != nil || len(offers) != 3 {
+		t.Fatalf("ListOffers = %+v, %v, want 3 offers", offers, err)
+	}
+	posted := time.Date(2026, 1, 2, 2, 4, 5, 0, time.UTC)
+	if !offers[0].Offer.PostedAt.IsZero() || !offers[1].Offer.PostedAt.IsZero() || !offers[2].Offer.PostedAt.Equal(posted) {
+		t.Errorf("posted at %v, %v and %v, want unknown, unknown and %v", offers[0].Offer.PostedAt, offers[1].Offer.PostedAt, offers[2].Offer.PostedAt, posted)
+	}
+	if offers[0].Offer.Price != 2000 || offers[0].Offer.Title != "Kawalerka" {
+		t.Errorf("first offer = %+v", offers[0].Offer)
+	}
+}
@@ -0,0 +1,257 @@
+// Responsible for creating and upgrading the schema of the database.
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// Migration upgrading the schema of the database by one version.
+//
+// Attributes:
+//
+//	version - number of the schema version created by the migration, starting from 1
+//	description - short description of the change, e.g. "create searches"
+//	up - applies the change within the transaction of the migration
+type migration struct {
+	version     int
+	description string
+	up          func(tx *sql.Tx) error
+}
+
+// Migrations of the schema in the order of their versions.
+// Applied migrations must never be changed, every schema change is a new migration at the end of the list.
+var migrations = []migration{
+	{
+		version:     1,
+		description: "create users and searches",
+		up: execStatements(
+			"CREATE TABLE users (id INTEGER PRIMARY KEY, created_at TIMESTAMP)",
+			"CREATE TABLE searches (id INTEGER PRIMARY KEY AUTOINCREMENT, UserID INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE, url TEXT NOT NULL, price_alerts INTEGER NOT NULL DEFAULT 0, active INTEGER NOT NULL DEFAULT 1, paused_until TIMESTAMP)",
+			"CREATE INDEX searches_user ON searches(UserID)",
+		),
+	},
+	{
+		version:     2,
+		description: "create offers",
+		up: execStatements(
+			"CREATE TABLE offers (id INTEGER PRIMARY KEY AUTOINCREMENT, title TEXT, price TEXT, location TEXT, time TEXT, url TEXT, additional_payment TEXT, description TEXT, rooms TEXT, area TEXT, floor TEXT, user_id INTEGER REFERENCES users(id) ON DELETE CASCADE, image_hashes TEXT, source TEXT, listing_id TEXT, added_at TIMESTAMP, checked_at TIMESTAMP, removed_at TIMESTAMP)",
+			// Offers without a listing id have NULL in the column, which is never equal to other NULLs
+			"CREATE UNIQUE INDEX offers_listing ON offers(user_id, source, listing_id)",
+			"CREATE INDEX offers_url ON offers(user_id, url)",
+		),
+	},
+	{
+		version:     3,
+		description: "create price history",
+		up: execStatements(
+			"CREATE TABLE price_history (id INTEGER PRIMARY KEY AUTOINCREMENT, source TEXT, listing_id TEXT, url TEXT, price INTEGER, additional_payment INTEGER, observed_at TIMESTAMP)",
+			"CREATE INDEX price_history_listing ON price_history(source, listing_id)",
+		),
+	},
+	{
+		version:     4,
+		description: "create legacy imports",
+		up: execStatements(
+			"CREATE TABLE legacy_imports (file TEXT PRIMARY KEY, imported_at TIMESTAMP)",
+		),
+	},
+	{
+		version:     5,
+		description: "type the offer columns and store the offer images",
+		up: execStatements(
+			"CREATE TABLE offers_typed (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER REFERENCES users(id) ON DELETE CASCADE, search_id INTEGER REFERENCES searches(id) ON DELETE SET NULL, source TEXT, listing_id TEXT, url TEXT, title TEXT, price INTEGER, additional_payment INTEGER, location TEXT, posted_at TIMESTAMP, description TEXT, rooms TEXT, area TEXT, floor TEXT, room_count INTEGER, area_m2 REAL, floor_number INTEGER, total_floors INTEGER, latitude REAL, longitude REAL, is_business INTEGER NOT NULL DEFAULT 0, image_hashes TEXT, first_seen_at TIMESTAMP, last_seen_at TIMESTAMP, checked_at TIMESTAMP, removed_at TIMESTAMP)",
+			// Times which are not full timestamps, e.g. "12:30" or the zero time, are unknown
+			"INSERT INTO offers_typed(id, user_id, source, listing_id, url, title, price, additional_payment, location, posted_at, description, rooms, area, floor, image_hashes, first_seen_at, last_seen_at, checked_at, removed_at) SELECT id, user_id, source, listing_id, url, title, CAST(price AS INTEGER), CAST(additional_payment AS INTEGER), location, "+legacyPostedAt("time")+", description, rooms, area, floor, image_hashes, added_at, added_at, checked_at, removed_at FROM offers",
+			"DROP TABLE offers",
+			"ALTER TABLE offers_typed RENAME TO offers",
+			"CREATE UNIQUE INDEX offers_listing ON offers(user_id, source, listing_id)",
+			"CREATE INDEX offers_url ON offers(user_id, url)",
+			"CREATE INDEX offers_search ON offers(search_id)",
+			"CREATE INDEX offers_first_seen ON offers(user_id, first_seen_at)",
+			"CREATE TABLE offer_images (offer_id INTEGER NOT NULL REFERENCES offers(id) ON DELETE CASCADE, position INTEGER NOT NULL, url TEXT NOT NULL, PRIMARY KEY (offer_id, position))",
+		),
+	},
+	{
+		version:     6,
+		description: "make the offer urls unique per user",
+		up: execStatements(
+			// Offers added concurrently before the unique index may have been stored twice, the first one is kept
+			"DELETE FROM offers WHERE url IS NOT NULL AND id NOT IN (SELECT MIN(id) FROM offers WHERE url IS NOT NULL GROUP BY user_id, url)",
+			"DROP INDEX offers_url",
+			"CREATE UNIQUE INDEX offers_url ON offers(user_id, url)",
+		),
+	},
+}
+
+// Migrations of the schema of PostgreSQL databases, creating the same schema as migrations with the same versions.
+// PostgreSQL databases never had the untyped offers, so the offers are typed since their creation.
+// Applied migrations must never be changed, every schema change is a new migration at the end of the list.
+var postgresMigrations = []migration{
+	{
+		version:     1,
+		description: "create users and searches",
+		up: execStatements(
+			"CREATE TABLE users (id BIGINT PRIMARY KEY, created_at TIMESTAMPTZ)",
+			"CREATE TABLE searches (id BIGSERIAL PRIMARY KEY, UserID BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE, url TEXT NOT NULL, price_alerts BOOLEAN NOT NULL DEFAULT FALSE, active BOOLEAN NOT NULL DEFAULT TRUE, paused_until TIMESTAMPTZ)",
+			"CREATE INDEX searches_user ON searches(UserID)",
+		),
+	},
+	{
+		version:     2,
+		description: "create offers",
+		up: execStatements(
+			"CREATE TABLE offers (id BIGSERIAL PRIMARY KEY, user_id BIGINT REFERENCES users(id) ON DELETE CASCADE, search_id BIGINT REFERENCES searches(id) ON DELETE SET NULL, source TEXT, listing_id TEXT, url TEXT, title TEXT, price INTEGER, additional_payment INTEGER, location TEXT, posted_at TIMESTAMPTZ, description TEXT, rooms TEXT, area TEXT, floor TEXT, room_count INTEGER, area_m2 DOUBLE PRECISION, floor_number INTEGER, total_floors INTEGER, latitude DOUBLE PRECISION, longitude DOUBLE PRECISION, is_business BOOLEAN NOT NULL DEFAULT FALSE, image_hashes TEXT, first_seen_at TIMESTAMPTZ, last_seen_at TIMESTAMPTZ, checked_at TIMESTAMPTZ, removed_at TIMESTAMPTZ)",
+			// Offers without a listing id have NULL in the column, which is never equal to other NULLs
+			"CREATE UNIQUE INDEX offers_listing ON offers(user_id, source, listing_id)",
+			"CREATE INDEX offers_url ON offers(user_id, url)",
+		),
+	},
+	{
+		version:     3,
+		description: "create price history",
+		up: execStatements(
+			"CREATE TABLE price_history (id BIGSERIAL PRIMARY KEY, source TEXT, listing_id TEXT, url TEXT, price INTEGER, additional_payment INTEGER, observed_at TIMESTAMPTZ)",
+			"CREATE INDEX price_history_listing ON price_history(source, listing_id)",
+		),
+	},
+	{
+		version:     4,
+		description: "create legacy imports",
+		up: execStatements(
+			"CREATE TABLE legacy_imports (file TEXT PRIMARY KEY, imported_at TIMESTAMPTZ)",
+		),
+	},
+	{
+		version:     5,
+		description: "type the offer columns and store the offer images",
+		up: execStatements(
+			"CREATE INDEX offers_search ON offers(search_id)",
+			"CREATE INDEX offers_first_seen ON offers(user_id, first_seen_at)",
+			"CREATE TABLE offer_images (offer_id BIGINT NOT NULL REFERENCES offers(id) ON DELETE CASCADE, position INTEGER NOT NULL, url TEXT NOT NULL, PRIMARY KEY (offer_id, position))",
+		),
+	},
+	{
+		version:     6,
+		description: "make the offer urls unique per user",
+		up: execStatements(
+			// Offers added concurrently before the unique index may have been stored twice, the first one is kept
+			"DELETE FROM offers WHERE url IS NOT NULL AND id NOT IN (SELECT MIN(id) FROM offers WHERE url IS NOT NULL GROUP BY user_id, url)",
+			"DROP INDEX offers_url",
+			"CREATE UNIQUE INDEX offers_url ON offers(user_id, url)",
+		),
+	},
+}
+
+// Create a migration step executing the statements in order.
+func execStatements(statements ...string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		for _, statement := range statements {
+			if _, err := tx.Exec(statement); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Get the version of the schema of the database, creating the schema_version table if needed.
+//
+// Returns:
+//
+//	int - version of the last applied migration, 0 for a new database
+//	error - error if the database connection fails
+//
+// Example:
+//
+//	version, err := store.SchemaVersion()
+func (s *SQLStore) SchemaVersion() (int, error) {
+	_, err := s.exec(context.Background(), "CREATE TABLE IF NOT EXISTS schema_version (version INTEGER PRIMARY KEY, description TEXT, applied_at TIMESTAMP)")
+	if err != nil {
+		return 0, err
+	}
+
+	var version int
+	err = s.queryRow(context.Background(), "SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// Apply the migrations newer than the version of the schema of the database.
+// Every migration runs in its own transaction together with the update of the schema version,
+// so a failed migration leaves the database at the previous version.
+//
+// Returns:
+//
+//	error - error if a migration fails or the database is newer than the known migrations
+//
+// Example:
+//
+//	err := store.Migrate()
+func (s *SQLStore) Migrate() error {
+	version, err := s.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	migrations := s.dialect.migrations
+	latest := migrations[len(migrations)-1].version
+	if version > latest {
+		return fmt.Errorf("database schema version %d is newer than the supported version %d", version, latest)
+	}
+
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+		applied, err := s.applyMigration(m)
+		if err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.description, err)
+		}
+		if applied {
+			log.Printf("Applied database migration %d: %s", m.version, m.description)
+		}
+	}
+	return nil
+}
+
+// Apply the migration and record its version in a single transaction.
+// Bots sharing a PostgreSQL database may start at the same time, so the migrations are applied
+// under a lock and a migration applied by another bot in the meantime is skipped.
+//
+// Returns:
+//
+//	bool - true if the migration was applied, false if it was applied by another bot
+//	error - error if the migration fails
+func (s *SQLStore) applyMigration(m migration) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if s.dialect.lockMigrations != "" {
+		if _, err := tx.Exec(s.dialect.lockMigrations); err != nil {
+			return false, err
+		}
+	}
+
+	var applied bool
+	err = tx.QueryRow(s.dialect.rebind("SELECT EXISTS(SELECT 1 FROM schema_version WHERE version = ?)"), m.version).Scan(&applied)
+	if err != nil || applied {
+		return false, err
+	}
+
+	if err := m.up(tx); err != nil {
+		return false, err
+	}
+	_, err = tx.Exec(s.dialect.rebind("INSERT INTO schema_version(version, description, applied_at) VALUES(?, ?, ?)"), m.version, m.description, now())
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
@@ -3,57 +3,99 @@ package database
 
 import (
 	"apartment-parser/parser"
+	"context"
 	"database/sql"
-	_ "github.com/mattn/go-sqlite3"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 )
 
-// Add offer to the database.
+// Add offer to the database unless the user already has it, see OfferExists.
+// The check and the insert are a single statement, so searches adding the same offer concurrently
+// add it only once. The images of the offer are stored in the order of the offer.
 //
 // Parameters:
 //
-//	db - database connection
 //	offer - offer struct
 //	userID - user id
+//	searchID - id of the search the offer was found by, 0 if unknown
 //
 // Returns:
 //
+//	bool - true if the offer was added, false if the user already has it
 //	error - error if the database connection fails
 //
 // Example:
 //
 //	offer := parser.Offer{
 //		Title: "Mieszkanie 2 pokojowe",
-//		Price: "1 000 zł",
+//		Price: 1000,
 //		Location: "Warszawa",
-//		Time: "dzisiaj 12:00",
+//		PostedAt: time.Now(),
 //		Url: "https://www.olx.pl/oferta/mieszkanie-2-pokojowe-ID6Q2Zr.html"
 //	}
-//	err := AddOffer(db, offer, 1)
-func AddOffer(db *sql.DB, offer parser.Offer, userID int64) error {
-	exists, err := OfferExists(db, offer, userID)
+//	added, err := store.AddOffer(offer, 1, 2)
+func (s *SQLStore) AddOffer(offer parser.Offer, userID int64, searchID int64) (bool, error) {
+	return s.AddOfferContext(context.Background(), offer, userID, searchID)
+}
 
-	if err != nil {
-		return err
-	}
+// AddOffer with a context canceling its queries.
+func (s *SQLStore) AddOfferContext(ctx context.Context, offer parser.Offer, userID int64, searchID int64) (bool, error) {
+	added := false
+	err := s.inTx(ctx, func(tx *SQLStore) error {
+		err := tx.addUser(ctx, userID)
+		if err != nil {
+			return err
+		}
 
-	if exists {
-		return nil
-	}
+		seen_at := now()
+		// The unique indexes of the offers identify them like OfferExists, no row is returned for an existing offer.
+		// PostgreSQL drivers do not report the last inserted id.
+		var id int64
+		err = tx.queryRow(ctx, "INSERT INTO offers(user_id, search_id, source, listing_id, url, title, price, additional_payment, location, posted_at, description, rooms, area, floor, room_count, area_m2, floor_number, total_floors, latitude, longitude, is_business, image_hashes, first_seen_at, last_seen_at) values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING RETURNING id",
+			userID, sql.NullInt64{Int64: searchID, Valid: searchID != 0}, offer.Source, listingId(offer), offer.Url,
+			offer.Title, offer.Price, offer.AdditionalPayment, offer.Location, nullTime(offer.PostedAt), offer.Description,
+			offer.Rooms, offer.Area, offer.Floor, offer.RoomCount, offer.AreaM2, offer.FloorNumber, offer.TotalFloors,
+			offer.Latitude, offer.Longitude, offer.IsBusiness, encodeImageHashes(offer.ImageHashes), seen_at, seen_at).Scan(&id)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
 
-	stmt, err := db.Prepare("INSERT INTO offers(title, price, location, time, url, additional_payment, description, rooms, area, floor, user_id) values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+		for position, image_url := range offer.Images {
+			_, err = tx.exec(ctx, "INSERT INTO offer_images(offer_id, position, url) VALUES(?, ?, ?)", id, position, image_url)
+			if err != nil {
+				return err
+			}
+		}
+		added = true
+		return nil
+	})
 	if err != nil {
-		return err
+		return false, err
 	}
+	return added, nil
+}
 
-	_, err = stmt.Exec(offer.Title, offer.Price, offer.Location, offer.Time, offer.Url, offer.AdditionalPayment, offer.Description, offer.Rooms, offer.Area, offer.Floor, userID)
-	return err
+// Get the time to store, NULL if it is unknown.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t.UTC(), Valid: !t.IsZero()}
+}
+
+// Get the listing id of the offer to store, NULL if unknown so the offers without it are never equal.
+func listingId(offer parser.Offer) sql.NullString {
+	return sql.NullString{String: offer.ListingId, Valid: offer.ListingId != ""}
 }
 
 // Check if offer exists in the database.
+// Offers are identified by their url or by their source and listing id,
+// so changes of the title or the price do not make the offer new.
 //
 // Parameters:
 //
-//	db - database connection
 //	offer - offer struct
 //	userID - user id
 //
@@ -68,51 +110,378 @@ func AddOffer(db *sql.DB, offer parser.Offer, userID int64) error {
 //		Title: "Mieszkanie 2 pokojowe",
 //		Price: "1 000 zł",
 //		Location: "Warszawa",
-//		Time: "dzisiaj 12:00",
+//		PostedAt: time.Now(),
 //		Url: "https://www.olx.pl/oferta/mieszkanie-2-pokojowe-ID6Q2Zr.html"
 //	}
-//	exists, err := offerExists(db, offer, 1)
-func OfferExists(db *sql.DB, offer parser.Offer, userID int64) (bool, error) {
+//	exists, err := store.OfferExists(offer, 1)
+func (s *SQLStore) OfferExists(offer parser.Offer, userID int64) (bool, error) {
+	return s.OfferExistsContext(context.Background(), offer, userID)
+}
+
+// OfferExists with a context canceling its queries.
+func (s *SQLStore) OfferExistsContext(ctx context.Context, offer parser.Offer, userID int64) (bool, error) {
 	var exists bool
-	// if offer with the same title and price exists
-	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM offers WHERE title = ? AND price = ? AND user_id = ?)", offer.Title, offer.Price, userID).Scan(&exists)
+	err := s.queryRow(ctx, "SELECT EXISTS(SELECT 1 FROM offers WHERE user_id = ? AND "+listingCondition+")", append([]any{userID}, listingArgs(offer)...)...).Scan(&exists)
 	if err != nil {
 		return false, err
 	}
 	return exists, nil
 }
 
-// List all offers from the database.
+// Record that the offer of the user was found again by a search.
 //
 // Parameters:
 //
-//	db - database connection
-//	offer - offer struct
+//	offer - offer found again
+//	userID - user id
 //
 // Returns:
 //
-//	[]parser.Offer - list of offers
 //	error - error if the database connection fails
 //
 // Example:
 //
-//	offers, err := ListOffers(db)
-func ListOffers(db *sql.DB) ([]parser.Offer, error) {
-	var offers []parser.Offer
-	rows, err := db.Query("SELECT * FROM offers")
+//	err := store.MarkOfferSeen(offer, 1)
+func (s *SQLStore) MarkOfferSeen(offer parser.Offer, userID int64) error {
+	return s.MarkOfferSeenContext(context.Background(), offer, userID)
+}
+
+// MarkOfferSeen with a context canceling its queries.
+func (s *SQLStore) MarkOfferSeenContext(ctx context.Context, offer parser.Offer, userID int64) error {
+	_, err := s.exec(ctx, "UPDATE offers SET last_seen_at = ? WHERE user_id = ? AND "+listingCondition,
+		append([]any{now(), userID}, listingArgs(offer)...)...)
+	return err
+}
+
+// Offer as stored in the database.
+//
+// Attributes:
+//
+//	ID - id of the stored offer
+//	UserID - user id the offer was sent to
+//	SearchID - id of the search the offer was found by, 0 if unknown or deleted
+//	Offer - offer with all its fields and images
+//	FirstSeenAt - time the offer was added to the database, zero if unknown
+//	LastSeenAt - time the offer was last found by a search, zero if unknown
+//	CheckedAt - time the offer was last checked for being taken down, zero if never
+//	RemovedAt - time the offer was found taken down, zero if it is still listed
+type StoredOffer struct {
+	ID          int64
+	UserID      int64
+	SearchID    int64
+	Offer       parser.Offer
+	FirstSeenAt time.Time
+	LastSeenAt  time.Time
+	CheckedAt   time.Time
+	RemovedAt   time.Time
+}
+
+// Column the listed offers are ordered by.
+type OfferOrder string
+
+const (
+	OrderByID        OfferOrder = "id"
+	OrderByFirstSeen OfferOrder = "first_seen_at"
+	OrderByLastSeen  OfferOrder = "last_seen_at"
+	OrderByPostedAt  OfferOrder = "posted_at"
+	OrderByPrice     OfferOrder = "price"
+)
+
+// Filter, ordering and page of the offers listed by ListOffers.
+// Zero values of the attributes do not filter the offers.
+//
+// Attributes:
+//
+//	UserID - only offers of the user
+//	SearchID - only offers found by the search
+//	MinPrice - only offers with at least this price
+//	MaxPrice - only offers with at most this price
+//	SeenFrom - only offers first seen at or after this time
+//	SeenTo - only offers first seen before this time
+//	OrderBy - column to order the offers by, OrderByID if empty, ties are ordered by id
+//	Descending - true to list the offers in the descending order
+//	Limit - maximum number of offers, all if 0
+//	Offset - number of offers to skip, used with Limit to list the offers page by page
+type OfferFilter struct {
+	UserID     int64
+	SearchID   int64
+	MinPrice   int
+	MaxPrice   int
+	SeenFrom   time.Time
+	SeenTo     time.Time
+	OrderBy    OfferOrder
+	Descending bool
+	Limit      int
+	Offset     int
+}
+
+// Build the WHERE clause of the filter and its arguments.
+func (filter OfferFilter) where() (string, []any) {
+	conditions := make([]string, 0)
+	args := make([]any, 0)
+	if filter.UserID != 0 {
+		conditions, args = append(conditions, "user_id = ?"), append(args, filter.UserID)
+	}
+	if filter.SearchID != 0 {
+		conditions, args = append(conditions, "search_id = ?"), append(args, filter.SearchID)
+	}
+	if filter.MinPrice != 0 {
+		conditions, args = append(conditions, "price >= ?"), append(args, filter.MinPrice)
+	}
+	if filter.MaxPrice != 0 {
+		conditions, args = append(conditions, "price <= ?"), append(args, filter.MaxPrice)
+	}
+	if !filter.SeenFrom.IsZero() {
+		conditions, args = append(conditions, "first_seen_at >= ?"), append(args, filter.SeenFrom.UTC())
+	}
+	if !filter.SeenTo.IsZero() {
+		conditions, args = append(conditions, "first_seen_at < ?"), append(args, filter.SeenTo.UTC())
+	}
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// Build the ORDER BY, LIMIT and OFFSET clauses of the filter.
+//
+// Parameters:
+//
+//	noLimit - LIMIT value of the database engine listing all the rows
+func (filter OfferFilter) page(noLimit string) (string, error) {
+	order := filter.OrderBy
+	if order == "" {
+		order = OrderByID
+	}
+	switch order {
+	case OrderByID, OrderByFirstSeen, OrderByLastSeen, OrderByPostedAt, OrderByPrice:
+	default:
+		return "", fmt.Errorf("unknown offer order %q", order)
+	}
+
+	direction := " ASC"
+	if filter.Descending {
+		direction = " DESC"
+	}
+	clause := " ORDER BY " + string(order) + direction
+	if order != OrderByID {
+		clause += ", id" + direction
+	}
+	if filter.Limit > 0 || filter.Offset > 0 {
+		limit := noLimit
+		if filter.Limit > 0 {
+			limit = strconv.Itoa(filter.Limit)
+		}
+		clause += fmt.Sprintf(" LIMIT %s OFFSET %d", limit, filter.Offset)
+	}
+	return clause, nil
+}
+
+// List the offers matching the filter with all their fields and images.
+//
+// Parameters:
+//
+//	filter - filter, ordering and page of the offers
+//
+// Returns:
+//
+//	[]StoredOffer - offers in the order of the filter
+//	error - error if the order is unknown or the database connection fails
+//
+// Example:
+//
+//	offers, err := store.ListOffers(OfferFilter{UserID: 1, MaxPrice: 3000, OrderBy: OrderByFirstSeen, Descending: true, Limit: 20, Offset: 40})
+func (s *SQLStore) ListOffers(filter OfferFilter) ([]StoredOffer, error) {
+	return s.ListOffersContext(context.Background(), filter)
+}
+
+// ListOffers with a context canceling its queries.
+func (s *SQLStore) ListOffersContext(ctx context.Context, filter OfferFilter) ([]StoredOffer, error) {
+	where, args := filter.where()
+	page, err := filter.page(s.dialect.noLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.query(ctx, "SELECT "+offerColumns+" FROM offers"+where+page, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
+	offers := make([]StoredOffer, 0)
 	for rows.Next() {
-		var offer parser.Offer
-		var id int
-		err = rows.Scan(&id, &offer.Title, &offer.Price, &offer.Location, &offer.Time, &offer.Url)
+		offer, err := scanOffer(rows)
 		if err != nil {
 			return nil, err
 		}
 		offers = append(offers, offer)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	err = s.loadImages(ctx, offers)
+	if err != nil {
+		return nil, err
+	}
 	return offers, nil
 }
+
+// Count the offers matching the filter, ignoring its ordering and page.
+//
+// Parameters:
+//
+//	filter - filter of the offers
+//
+// Returns:
+//
+//	int - number of the offers
+//	error - error if the database connection fails
+//
+// Example:
+//
+//	count, err := store.CountOffers(OfferFilter{UserID: 1})
+func (s *SQLStore) CountOffers(filter OfferFilter) (int, error) {
+	return s.CountOffersContext(context.Background(), filter)
+}
+
+// CountOffers with a context canceling its queries.
+func (s *SQLStore) CountOffersContext(ctx context.Context, filter OfferFilter) (int, error) {
+	where, args := filter.where()
+	var count int
+	err := s.queryRow(ctx, "SELECT COUNT(*) FROM offers"+where, args...).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// Maximum number of offers the images are loaded for by one query, below the limit of the query parameters
+const imagesBatch = 500
+
+// Load the images of the offers in their stored order.
+func (s *SQLStore) loadImages(ctx context.Context, offers []StoredOffer) error {
+	indexes := make(map[int64]int, len(offers))
+	for i := range offers {
+		indexes[offers[i].ID] = i
+	}
+
+	for start := 0; start < len(offers); start += imagesBatch {
+		batch := offers[start:min(start+imagesBatch, len(offers))]
+		args := make([]any, len(batch))
+		for i, offer := range batch {
+			args[i] = offer.ID
+		}
+
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(batch)), ", ")
+		rows, err := s.query(ctx, "SELECT offer_id, url FROM offer_images WHERE offer_id IN ("+placeholders+") ORDER BY offer_id, position", args...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var offer_id int64
+			var image_url string
+			err = rows.Scan(&offer_id, &image_url)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			offer := &offers[indexes[offer_id]].Offer
+			offer.Images = append(offer.Images, image_url)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List the latest offers of the user, used to detect the duplicates of the new offers.
+//
+// Parameters:
+//
+//	userID - user id
+//	limit - maximum number of offers
+//
+// Returns:
+//
+//	[]parser.Offer - list of offers, the newest first
+//	error - error if the database connection fails
+//
+// Example:
+//
+//	offers, err := store.ListUserOffers(1, 500)
+func (s *SQLStore) ListUserOffers(userID int64, limit int) ([]parser.Offer, error) {
+	return s.ListUserOffersContext(context.Background(), userID, limit)
+}
+
+// ListUserOffers with a context canceling its queries.
+func (s *SQLStore) ListUserOffersContext(ctx context.Context, userID int64, limit int) ([]parser.Offer, error) {
+	stored, err := s.ListOffersContext(ctx, OfferFilter{UserID: userID, Descending: true, Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+
+	offers := make([]parser.Offer, len(stored))
+	for i, offer := range stored {
+		offers[i] = offer.Offer
+	}
+	return offers, nil
+}
+
+// Columns of the offers table read by scanOffer
+const offerColumns = "id, user_id, search_id, source, listing_id, url, title, price, additional_payment, location, posted_at, description, rooms, area, floor, room_count, area_m2, floor_number, total_floors, latitude, longitude, is_business, image_hashes, first_seen_at, last_seen_at, checked_at, removed_at"
+
+// Scan the offer selected with offerColumns without its images, the missing values are left empty.
+func scanOffer(row interface{ Scan(dest ...any) error }) (StoredOffer, error) {
+	var stored StoredOffer
+	var user_id, search_id, price, additional_payment, room_count, floor_number, total_floors sql.NullInt64
+	var source, listing_id, url, title, location, description, rooms, area, floor, image_hashes sql.NullString
+	var area_m2, latitude, longitude sql.NullFloat64
+	var is_business sql.NullBool
+	var posted_at, first_seen_at, last_seen_at, checked_at, removed_at sql.NullTime
+	err := row.Scan(&stored.ID, &user_id, &search_id, &source, &listing_id, &url, &title, &price, &additional_payment,
+		&location, &posted_at, &description, &rooms, &area, &floor, &room_count, &area_m2, &floor_number, &total_floors,
+		&latitude, &longitude, &is_business, &image_hashes, &first_seen_at, &last_seen_at, &checked_at, &removed_at)
+	if err != nil {
+		return stored, err
+	}
+	stored.UserID, stored.SearchID = user_id.Int64, search_id.Int64
+	// PostgreSQL drivers return the times in the time zone of the session
+	stored.FirstSeenAt, stored.LastSeenAt = first_seen_at.Time.UTC(), last_seen_at.Time.UTC()
+	stored.CheckedAt, stored.RemovedAt = checked_at.Time.UTC(), removed_at.Time.UTC()
+
+	offer := &stored.Offer
+	offer.Source, offer.ListingId, offer.Url = source.String, listing_id.String, url.String
+	offer.Title, offer.Price, offer.AdditionalPayment = title.String, int(price.Int64), int(additional_payment.Int64)
+	offer.Location, offer.PostedAt, offer.Description = location.String, posted_at.Time.UTC(), description.String
+	offer.Rooms, offer.Area, offer.Floor = rooms.String, area.String, floor.String
+	offer.RoomCount, offer.AreaM2 = int(room_count.Int64), area_m2.Float64
+	offer.FloorNumber, offer.TotalFloors = int(floor_number.Int64), int(total_floors.Int64)
+	offer.Latitude, offer.Longitude, offer.IsBusiness = latitude.Float64, longitude.Float64, is_business.Bool
+	offer.ImageHashes = decodeImageHashes(image_hashes.String)
+	return stored, nil
+}
+
+// Encode the image hashes as comma separated hexadecimal numbers.
+func encodeImageHashes(hashes []uint64) string {
+	encoded := make([]string, len(hashes))
+	for i, hash := range hashes {
+		encoded[i] = strconv.FormatUint(hash, 16)
+	}
+	return strings.Join(encoded, ",")
+}
+
+// Decode the image hashes encoded with encodeImageHashes, skipping invalid ones.
+func decodeImageHashes(text string) []uint64 {
+	hashes := make([]uint64, 0)
+	for _, encoded := range strings.Split(text, ",") {
+		if hash, err := strconv.ParseUint(encoded, 16, 64); err == nil {
+			hashes = append(hashes, hash)
+		}
+	}
+	return hashes
+}
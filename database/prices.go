@@ -0,0 +1,167 @@
+// Responsible for tracking the prices of the offers.
+package database
+
+import (
+	"apartment-parser/parser"
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Price of an offer observed at some time.
+//
+// Attributes:
+//
+//	Price - price of the offer
+//	AdditionalPayment - additional payment of the offer
+//	ObservedAt - time the price was observed at
+type PricePoint struct {
+	Price             int
+	AdditionalPayment int
+	ObservedAt        time.Time
+}
+
+// Condition selecting the rows of the listing, by its url or by its source and listing id,
+// so rows stored with another listing id or without one are found by their url
+const listingCondition = "(url = ? OR (source = ? AND listing_id = ?))"
+
+// Get the arguments of listingCondition for the offer.
+func listingArgs(offer parser.Offer) []any {
+	return []any{offer.Url, offer.Source, listingId(offer)}
+}
+
+// Record the price of the offer in the price history if it changed since the last observation.
+// Search results often lack the additional payment, so 0 keeps the last observed one.
+// The last price is read and the new one inserted in a single transaction.
+//
+// Parameters:
+//
+//	offer - offer with the current price
+//
+// Returns:
+//
+//	bool - true if the price was recorded, false if it did not change
+//	error - error if the database connection fails
+//
+// Example:
+//
+//	recorded, err := store.RecordPrice(offer)
+func (s *SQLStore) RecordPrice(offer parser.Offer) (bool, error) {
+	return s.RecordPriceContext(context.Background(), offer)
+}
+
+// RecordPrice with a context canceling its queries.
+func (s *SQLStore) RecordPriceContext(ctx context.Context, offer parser.Offer) (bool, error) {
+	recorded := false
+	err := s.inTx(ctx, func(tx *SQLStore) error {
+		history, err := tx.PriceHistoryContext(ctx, offer)
+		if err != nil {
+			return err
+		}
+
+		additional_payment := offer.AdditionalPayment
+		if len(history) > 0 {
+			last := history[len(history)-1]
+			if additional_payment == 0 {
+				additional_payment = last.AdditionalPayment
+			}
+			if last.Price == offer.Price && last.AdditionalPayment == additional_payment {
+				return nil
+			}
+		}
+
+		_, err = tx.exec(ctx, "INSERT INTO price_history(source, listing_id, url, price, additional_payment, observed_at) VALUES(?, ?, ?, ?, ?, ?)",
+			offer.Source, listingId(offer), offer.Url, offer.Price, additional_payment, now())
+		recorded = err == nil
+		return err
+	})
+	return recorded, err
+}
+
+// List the prices of the offer recorded by RecordPrice.
+//
+// Parameters:
+//
+//	offer - offer to list the prices of
+//
+// Returns:
+//
+//	[]PricePoint - prices of the offer, the oldest first
+//	error - error if the database connection fails
+//
+// Example:
+//
+//	history, err := store.PriceHistory(offer)
+func (s *SQLStore) PriceHistory(offer parser.Offer) ([]PricePoint, error) {
+	return s.PriceHistoryContext(context.Background(), offer)
+}
+
+// PriceHistory with a context canceling its queries.
+func (s *SQLStore) PriceHistoryContext(ctx context.Context, offer parser.Offer) ([]PricePoint, error) {
+	rows, err := s.query(ctx, "SELECT price, additional_payment, observed_at FROM price_history WHERE "+listingCondition+" ORDER BY id", listingArgs(offer)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := make([]PricePoint, 0)
+	for rows.Next() {
+		var point PricePoint
+		err = rows.Scan(&point.Price, &point.AdditionalPayment, &point.ObservedAt)
+		if err != nil {
+			return nil, err
+		}
+		point.ObservedAt = point.ObservedAt.UTC()
+		history = append(history, point)
+	}
+	return history, rows.Err()
+}
+
+// Update the price of the offer stored for the user if it changed.
+// Search results often lack the additional payment, so 0 keeps the stored one.
+//
+// Parameters:
+//
+//	offer - offer with the current price
+//	userID - user id
+//
+// Returns:
+//
+//	parser.Offer - offer stored for the user before the update
+//	bool - true if the price or the additional payment changed, false if not or the offer is not stored
+//	error - error if the database connection fails
+//
+// Example:
+//
+//	stored, changed, err := store.UpdateOfferPrice(offer, 1)
+func (s *SQLStore) UpdateOfferPrice(offer parser.Offer, userID int64) (parser.Offer, bool, error) {
+	return s.UpdateOfferPriceContext(context.Background(), offer, userID)
+}
+
+// UpdateOfferPrice with a context canceling its queries.
+func (s *SQLStore) UpdateOfferPriceContext(ctx context.Context, offer parser.Offer, userID int64) (parser.Offer, bool, error) {
+	args := append([]any{userID}, listingArgs(offer)...)
+	row, err := scanOffer(s.queryRow(ctx, "SELECT "+offerColumns+" FROM offers WHERE user_id = ? AND "+listingCondition+" ORDER BY id DESC LIMIT 1", args...))
+	stored := row.Offer
+	if err == sql.ErrNoRows {
+		return offer, false, nil
+	}
+	if err != nil {
+		return offer, false, err
+	}
+
+	additional_payment := offer.AdditionalPayment
+	if additional_payment == 0 {
+		additional_payment = stored.AdditionalPayment
+	}
+	if stored.Price == offer.Price && stored.AdditionalPayment == additional_payment {
+		return stored, false, nil
+	}
+
+	_, err = s.exec(ctx, "UPDATE offers SET price = ?, additional_payment = ? WHERE user_id = ? AND "+listingCondition,
+		append([]any{offer.Price, additional_payment}, args...)...)
+	if err != nil {
+		return stored, false, err
+	}
+	return stored, true, nil
+}
@@ -0,0 +1,151 @@
+// Responsible for tracking the offers taken down from their sources.
+package database
+
+import (
+	"apartment-parser/parser"
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Offer of a user taken down from its source.
+//
+// Attributes:
+//
+//	UserID - user id the offer was sent to
+//	Offer - offer as stored for the user
+//	ListedAt - time the offer was posted at, or added to the database if unknown, zero if both are unknown
+//	RemovedAt - time the offer was found taken down
+type RemovedOffer struct {
+	UserID    int64
+	Offer     parser.Offer
+	ListedAt  time.Time
+	RemovedAt time.Time
+}
+
+// Get the current time as stored in the timestamp columns.
+// Whole seconds in UTC keep the stored values ordered as text.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+// List the offers to check for being taken down, each url once.
+// Offers never checked come first, followed by the ones checked the longest time ago.
+//
+// Parameters:
+//
+//	checkedBefore - only offers not checked since this time are listed
+//	limit - maximum number of offers
+//
+// Returns:
+//
+//	[]parser.Offer - offers with the url, source and listing id set
+//	error - error if the database connection fails
+//
+// Example:
+//
+//	offers, err := store.ListOffersToCheck(time.Now().Add(-24*time.Hour), 50)
+func (s *SQLStore) ListOffersToCheck(checkedBefore time.Time, limit int) ([]parser.Offer, error) {
+	return s.ListOffersToCheckContext(context.Background(), checkedBefore, limit)
+}
+
+// ListOffersToCheck with a context canceling its queries.
+func (s *SQLStore) ListOffersToCheckContext(ctx context.Context, checkedBefore time.Time, limit int) ([]parser.Offer, error) {
+	rows, err := s.query(ctx, "SELECT url, MAX(source), MAX(listing_id) FROM offers WHERE removed_at IS NULL AND url IS NOT NULL AND url != '' GROUP BY url HAVING MAX(checked_at) IS NULL OR MAX(checked_at) < ? ORDER BY MAX(checked_at) IS NOT NULL, MAX(checked_at) LIMIT ?",
+		checkedBefore.UTC().Truncate(time.Second), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	offers := make([]parser.Offer, 0)
+	for rows.Next() {
+		var offer parser.Offer
+		var source, listing_id sql.NullString
+		err = rows.Scan(&offer.Url, &source, &listing_id)
+		if err != nil {
+			return nil, err
+		}
+		offer.Source, offer.ListingId = source.String, listing_id.String
+		offers = append(offers, offer)
+	}
+	return offers, rows.Err()
+}
+
+// Record that the offer is still listed by its source.
+//
+// Parameters:
+//
+//	offer - checked offer
+//
+// Returns:
+//
+//	error - error if the database connection fails
+//
+// Example:
+//
+//	err := store.MarkOfferChecked(offer)
+func (s *SQLStore) MarkOfferChecked(offer parser.Offer) error {
+	return s.MarkOfferCheckedContext(context.Background(), offer)
+}
+
+// MarkOfferChecked with a context canceling its queries.
+func (s *SQLStore) MarkOfferCheckedContext(ctx context.Context, offer parser.Offer) error {
+	_, err := s.exec(ctx, "UPDATE offers SET checked_at = ? WHERE url = ?", now(), offer.Url)
+	return err
+}
+
+// Record that the offer was taken down from its source.
+//
+// Parameters:
+//
+//	offer - taken down offer
+//
+// Returns:
+//
+//	[]RemovedOffer - offers of all the users with the url which were not marked as removed before
+//	error - error if the database connection fails
+//
+// Example:
+//
+//	removed, err := store.MarkOfferRemoved(offer)
+func (s *SQLStore) MarkOfferRemoved(offer parser.Offer) ([]RemovedOffer, error) {
+	return s.MarkOfferRemovedContext(context.Background(), offer)
+}
+
+// MarkOfferRemoved with a context canceling its queries.
+func (s *SQLStore) MarkOfferRemovedContext(ctx context.Context, offer parser.Offer) ([]RemovedOffer, error) {
+	removed_at := now()
+	removed := make([]RemovedOffer, 0)
+	err := s.inTx(ctx, func(tx *SQLStore) error {
+		rows, err := tx.query(ctx, "SELECT "+offerColumns+" FROM offers WHERE url = ? AND removed_at IS NULL", offer.Url)
+		if err != nil {
+			return err
+		}
+
+		for rows.Next() {
+			stored, err := scanOffer(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+
+			r := RemovedOffer{UserID: stored.UserID, Offer: stored.Offer, ListedAt: stored.Offer.PostedAt, RemovedAt: removed_at}
+			if r.ListedAt.IsZero() {
+				r.ListedAt = stored.FirstSeenAt
+			}
+			removed = append(removed, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		_, err = tx.exec(ctx, "UPDATE offers SET removed_at = ?, checked_at = ? WHERE url = ? AND removed_at IS NULL", removed_at, removed_at, offer.Url)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return removed, nil
+}
@@ -2,8 +2,10 @@
 package database
 
 import (
+	"context"
 	"database/sql"
-	_ "github.com/mattn/go-sqlite3"
+	"errors"
+	"time"
 )
 
 // Search struct represents a search in the database.
@@ -13,18 +15,53 @@ import (
 //	ID - search id
 //	UserID - user id of the user who added the search
 //	URL - search url
+//	PriceAlerts - true if the user is notified when the price of an offer sent for the search drops
+//	Active - false if the search is paused
+//	PausedUntil - time the paused search resumes at, zero if it is paused until resumed by the user
 type Search struct {
-	ID     int64
-	UserID int64
-	URL    string
+	ID          int64
+	UserID      int64
+	URL         string
+	PriceAlerts bool
+	Active      bool
+	PausedUntil time.Time
+}
+
+// Check if the search is paused at the given time.
+//
+// Parameters:
+//
+//	at - time to check
+//
+// Returns:
+//
+//	bool - true if the offers of the search should not be parsed
+func (search Search) IsPaused(at time.Time) bool {
+	return !search.Active && (search.PausedUntil.IsZero() || at.Before(search.PausedUntil))
+}
+
+// Columns of the searches table read by scanSearch
+const searchColumns = "id, url, UserID, price_alerts, active, paused_until"
+
+// Scan the search selected with searchColumns.
+func scanSearch(row interface{ Scan(dest ...any) error }) (Search, error) {
+	var search Search
+	var paused_until sql.NullTime
+	err := row.Scan(&search.ID, &search.URL, &search.UserID, &search.PriceAlerts, &search.Active, &paused_until)
+	if err != nil {
+		return Search{}, err
+	}
+	if paused_until.Valid {
+		search.PausedUntil = paused_until.Time.UTC()
+	}
+	return search, nil
 }
 
 // Create a new database entry for a new search.
-// If the search already exists, it will not be added.
+// If the search already exists, it will not be added, the check and the insert are done in a single transaction.
 //
 // Parameters:
 //
-//	db - database connection
 //	userID - user id of the user who added the search
 //	url - search url
 //
@@ -34,28 +71,34 @@ type Search struct {
 //
 // Example:
 //
-//	err := AddSearch(db, 1, "https://www.olx.pl/nieruchomosci/mieszkania/wynajem/warszawa/")
-func AddSearch(db *sql.DB, userID int64, url string) error {
-	// If the search already exists, do not add it
-	exists, err := searchExists(db, userID, url)
-	if err != nil || exists {
-		return err
-	}
+//	err := store.AddSearch(1, "https://www.olx.pl/nieruchomosci/mieszkania/wynajem/warszawa/")
+func (s *SQLStore) AddSearch(userID int64, url string) error {
+	return s.AddSearchContext(context.Background(), userID, url)
+}
 
-	stmt, err := db.Prepare("INSERT INTO searches(UserID, url) VALUES(?, ?)")
-	if err != nil {
-		return err
-	}
+// AddSearch with a context canceling its queries.
+func (s *SQLStore) AddSearchContext(ctx context.Context, userID int64, url string) error {
+	return s.inTx(ctx, func(tx *SQLStore) error {
+		// If the search already exists, do not add it
+		exists, err := tx.searchExists(ctx, userID, url)
+		if err != nil || exists {
+			return err
+		}
 
-	_, err = stmt.Exec(userID, url)
-	return err
+		err = tx.addUser(ctx, userID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.exec(ctx, "INSERT INTO searches(UserID, url) VALUES(?, ?)", userID, url)
+		return err
+	})
 }
 
 // Check if search already exists in the database.
 //
 // Parameters:
 //
-//	db - database connection
 //	userID - user id of the user who added the search
 //	url - search url
 //
@@ -66,22 +109,66 @@ func AddSearch(db *sql.DB, userID int64, url string) error {
 //
 // Example:
 //
-//	exists, err := searchExists(db, 1, "https://www.olx.pl/nieruchomosci/mieszkania/wynajem/warszawa/")
-func searchExists(db *sql.DB, userID int64, url string) (bool, error) {
+//	exists, err := store.searchExists(1, "https://www.olx.pl/nieruchomosci/mieszkania/wynajem/warszawa/")
+func (s *SQLStore) searchExists(ctx context.Context, userID int64, url string) (bool, error) {
 	var exists bool
 	// if search with the same url exists
-	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM searches WHERE UserID = ? AND url = ?)", userID, url).Scan(&exists)
+	err := s.queryRow(ctx, "SELECT EXISTS(SELECT 1 FROM searches WHERE UserID = ? AND url = ?)", userID, url).Scan(&exists)
 	if err != nil {
 		return false, err
 	}
 	return exists, nil
 }
 
+// Replace the url of a search, keeping its id and settings.
+// Only the searches of the user are updated. The check for a duplicate search and the update
+// are done in a single transaction.
+//
+// Parameters:
+//
+//	userID - user id of the user who owns the search
+//	ID - search id
+//	url - new search url
+//
+// Returns:
+//
+//	error - sql.ErrNoRows if the user has no search with the id, error if the user already has
+//	a search with the url or the database connection fails
+//
+// Example:
+//
+//	err := store.UpdateSearch(1, 1, "https://www.olx.pl/nieruchomosci/mieszkania/wynajem/krakow/")
+func (s *SQLStore) UpdateSearch(userID int64, ID int64, url string) error {
+	return s.UpdateSearchContext(context.Background(), userID, ID, url)
+}
+
+// UpdateSearch with a context canceling its queries.
+func (s *SQLStore) UpdateSearchContext(ctx context.Context, userID int64, ID int64, url string) error {
+	return s.inTx(ctx, func(tx *SQLStore) error {
+		var found int
+		err := tx.queryRow(ctx, "SELECT 1 FROM searches WHERE id = ? AND UserID = ?", ID, userID).Scan(&found)
+		if err != nil {
+			return err
+		}
+
+		var exists bool
+		err = tx.queryRow(ctx, "SELECT EXISTS(SELECT 1 FROM searches WHERE UserID = ? AND url = ? AND id != ?)", userID, url, ID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return errors.New("search already exists")
+		}
+
+		_, err = tx.exec(ctx, "UPDATE searches SET url = ? WHERE id = ? AND UserID = ?", url, ID, userID)
+		return err
+	})
+}
+
 // Delete a search from the database.
 //
 // Parameters:
 //
-//	db - database connection
 //	ID - search id
 //
 // Returns:
@@ -90,22 +177,111 @@ func searchExists(db *sql.DB, userID int64, url string) (bool, error) {
 //
 // Example:
 //
-//	err := DeleteSearch(db, 1)
-func DeleteSearch(db *sql.DB, ID int64) error {
-	stmt, err := db.Prepare("DELETE FROM searches WHERE id = ?")
+//	err := store.DeleteSearch(1)
+func (s *SQLStore) DeleteSearch(ID int64) error {
+	return s.DeleteSearchContext(context.Background(), ID)
+}
+
+// DeleteSearch with a context canceling its queries.
+func (s *SQLStore) DeleteSearchContext(ctx context.Context, ID int64) error {
+	_, err := s.exec(ctx, "DELETE FROM searches WHERE id = ?", ID)
+	return err
+}
+
+// Enable or disable the price drop notifications of a search of the user.
+//
+// Parameters:
+//
+//	userID - user id of the user who owns the search
+//	ID - search id
+//	enabled - true to notify the user about price drops
+//
+// Returns:
+//
+//	error - sql.ErrNoRows if the user has no search with the id, error if the database connection fails
+//
+// Example:
+//
+//	err := store.SetPriceAlerts(1, 1, true)
+func (s *SQLStore) SetPriceAlerts(userID int64, ID int64, enabled bool) error {
+	return s.SetPriceAlertsContext(context.Background(), userID, ID, enabled)
+}
+
+// SetPriceAlerts with a context canceling its queries.
+func (s *SQLStore) SetPriceAlertsContext(ctx context.Context, userID int64, ID int64, enabled bool) error {
+	return searchUpdated(s.exec(ctx, "UPDATE searches SET price_alerts = ? WHERE id = ? AND UserID = ?", enabled, ID, userID))
+}
+
+// Pause a search of the user, its offers are not parsed until it is resumed.
+//
+// Parameters:
+//
+//	userID - user id of the user who owns the search
+//	ID - search id
+//	until - time the search resumes at, zero to pause it until ResumeSearch is called
+//
+// Returns:
+//
+//	error - sql.ErrNoRows if the user has no search with the id, error if the database connection fails
+//
+// Example:
+//
+//	err := store.PauseSearch(1, 1, time.Now().AddDate(0, 0, 7))
+func (s *SQLStore) PauseSearch(userID int64, ID int64, until time.Time) error {
+	return s.PauseSearchContext(context.Background(), userID, ID, until)
+}
+
+// PauseSearch with a context canceling its queries.
+func (s *SQLStore) PauseSearchContext(ctx context.Context, userID int64, ID int64, until time.Time) error {
+	var paused_until sql.NullTime
+	if !until.IsZero() {
+		paused_until = sql.NullTime{Time: until.UTC().Truncate(time.Second), Valid: true}
+	}
+	return searchUpdated(s.exec(ctx, "UPDATE searches SET active = ?, paused_until = ? WHERE id = ? AND UserID = ?", false, paused_until, ID, userID))
+}
+
+// Resume a paused search of the user.
+//
+// Parameters:
+//
+//	userID - user id of the user who owns the search
+//	ID - search id
+//
+// Returns:
+//
+//	error - sql.ErrNoRows if the user has no search with the id, error if the database connection fails
+//
+// Example:
+//
+//	err := store.ResumeSearch(1, 1)
+func (s *SQLStore) ResumeSearch(userID int64, ID int64) error {
+	return s.ResumeSearchContext(context.Background(), userID, ID)
+}
+
+// ResumeSearch with a context canceling its queries.
+func (s *SQLStore) ResumeSearchContext(ctx context.Context, userID int64, ID int64) error {
+	return searchUpdated(s.exec(ctx, "UPDATE searches SET active = ?, paused_until = NULL WHERE id = ? AND UserID = ?", true, ID, userID))
+}
+
+// Check the result of an update of a search, which updates no rows if the user has no search with the id.
+func searchUpdated(result sql.Result, err error) error {
 	if err != nil {
 		return err
 	}
-
-	_, err = stmt.Exec(ID)
-	return err
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
 // Lists all searches from the database related to a specific user.
 //
 // Parameters:
 //
-//	db - database connection
 //	userID - user id searches belong to
 //
 // Returns:
@@ -115,18 +291,22 @@ func DeleteSearch(db *sql.DB, ID int64) error {
 //
 // Example:
 //
-//	searches, err := ListSearches(db, 1)
-func ListSearches(db *sql.DB, userID int64) ([]Search, error) {
+//	searches, err := store.ListSearches(1)
+func (s *SQLStore) ListSearches(userID int64) ([]Search, error) {
+	return s.ListSearchesContext(context.Background(), userID)
+}
+
+// ListSearches with a context canceling its queries.
+func (s *SQLStore) ListSearchesContext(ctx context.Context, userID int64) ([]Search, error) {
 	var searches []Search
-	rows, err := db.Query("SELECT id, url FROM searches WHERE UserID = ?", userID)
+	rows, err := s.query(ctx, "SELECT "+searchColumns+" FROM searches WHERE UserID = ?", userID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var search Search
-		err = rows.Scan(&search.ID, &search.URL)
+		search, err := scanSearch(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -139,7 +319,6 @@ func ListSearches(db *sql.DB, userID int64) ([]Search, error) {
 //
 // Parameters:
 //
-//	db - database connection
 //	id - search id
 //
 // Returns:
@@ -149,27 +328,32 @@ func ListSearches(db *sql.DB, userID int64) ([]Search, error) {
 //
 // Example:
 //
-//	search, err := GetSearch(db, 1)
-func GetSearch(db *sql.DB, id int64) (Search, error) {
-	var search Search
-	err := db.QueryRow("SELECT id, url FROM searches WHERE id = ?", id).Scan(&search.ID, &search.URL)
-	if err != nil {
-		return Search{}, err
-	}
-	return search, nil
+//	search, err := store.GetSearch(1)
+func (s *SQLStore) GetSearch(id int64) (Search, error) {
+	return s.GetSearchContext(context.Background(), id)
+}
+
+// GetSearch with a context canceling its queries.
+func (s *SQLStore) GetSearchContext(ctx context.Context, id int64) (Search, error) {
+	return scanSearch(s.queryRow(ctx, "SELECT "+searchColumns+" FROM searches WHERE id = ?", id))
 }
 
-func GetAllSearches(db *sql.DB) ([]Search, error) {
+// List all searches of all users, including the paused ones, see Search.IsPaused.
+func (s *SQLStore) GetAllSearches() ([]Search, error) {
+	return s.GetAllSearchesContext(context.Background())
+}
+
+// GetAllSearches with a context canceling its queries.
+func (s *SQLStore) GetAllSearchesContext(ctx context.Context) ([]Search, error) {
 	var searches []Search
-	rows, err := db.Query("SELECT id, url, UserID FROM searches")
+	rows, err := s.query(ctx, "SELECT "+searchColumns+" FROM searches")
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var search Search
-		err = rows.Scan(&search.ID, &search.URL, &search.UserID)
+		search, err := scanSearch(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -179,10 +363,15 @@ func GetAllSearches(db *sql.DB) ([]Search, error) {
 	return searches, nil
 }
 
-func SearchExists(db *sql.DB, search Search) (bool, error) {
+func (s *SQLStore) SearchExists(search Search) (bool, error) {
+	return s.SearchExistsContext(context.Background(), search)
+}
+
+// SearchExists with a context canceling its queries.
+func (s *SQLStore) SearchExistsContext(ctx context.Context, search Search) (bool, error) {
 	var exists bool
 	// if search with the same url exists
-	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM searches WHERE UserID = ? AND url = ?)", search.UserID, search.URL).Scan(&exists)
+	err := s.queryRow(ctx, "SELECT EXISTS(SELECT 1 FROM searches WHERE UserID = ? AND url = ?)", search.UserID, search.URL).Scan(&exists)
 	if err != nil {
 		return false, err
 	}
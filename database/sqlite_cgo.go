@@ -0,0 +1,17 @@
+//go:build !sqlite_purego
+
+// Responsible for the SQLite driver of the default builds, which needs cgo.
+package database
+
+import (
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Name of the database/sql driver of the SQLite databases
+const sqliteDriver = "sqlite3"
+
+// Get the data source name of the SQLite database file.
+// Foreign keys are enforced by SQLite only when enabled on every connection.
+func sqliteSource(file string) string {
+	return "file:" + file + "?_foreign_keys=on"
+}
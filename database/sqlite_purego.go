@@ -0,0 +1,18 @@
+//go:build sqlite_purego
+
+// Responsible for the SQLite driver of the builds with the sqlite_purego tag, which do not need cgo.
+package database
+
+import (
+	_ "modernc.org/sqlite"
+)
+
+// Name of the database/sql driver of the SQLite databases
+const sqliteDriver = "sqlite"
+
+// Get the data source name of the SQLite database file.
+// Foreign keys are enforced by SQLite only when enabled on every connection,
+// the times are stored in the format of the cgo driver so both drivers read the same files.
+func sqliteSource(file string) string {
+	return "file:" + file + "?_pragma=foreign_keys(1)&_time_format=sqlite"
+}
@@ -0,0 +1,180 @@
+// Responsible for the stores of the offers and the searches.
+package database
+
+import (
+	"apartment-parser/parser"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Store of the offers sent to the users, their prices and their removals.
+// Every method has a variant taking a context, which cancels its queries.
+type OfferStore interface {
+	AddOffer(offer parser.Offer, userID int64, searchID int64) (bool, error)
+	AddOfferContext(ctx context.Context, offer parser.Offer, userID int64, searchID int64) (bool, error)
+	OfferExists(offer parser.Offer, userID int64) (bool, error)
+	OfferExistsContext(ctx context.Context, offer parser.Offer, userID int64) (bool, error)
+	MarkOfferSeen(offer parser.Offer, userID int64) error
+	MarkOfferSeenContext(ctx context.Context, offer parser.Offer, userID int64) error
+	ListOffers(filter OfferFilter) ([]StoredOffer, error)
+	ListOffersContext(ctx context.Context, filter OfferFilter) ([]StoredOffer, error)
+	CountOffers(filter OfferFilter) (int, error)
+	CountOffersContext(ctx context.Context, filter OfferFilter) (int, error)
+	ListUserOffers(userID int64, limit int) ([]parser.Offer, error)
+	ListUserOffersContext(ctx context.Context, userID int64, limit int) ([]parser.Offer, error)
+
+	RecordPrice(offer parser.Offer) (bool, error)
+	RecordPriceContext(ctx context.Context, offer parser.Offer) (bool, error)
+	PriceHistory(offer parser.Offer) ([]PricePoint, error)
+	PriceHistoryContext(ctx context.Context, offer parser.Offer) ([]PricePoint, error)
+	UpdateOfferPrice(offer parser.Offer, userID int64) (parser.Offer, bool, error)
+	UpdateOfferPriceContext(ctx context.Context, offer parser.Offer, userID int64) (parser.Offer, bool, error)
+
+	ListOffersToCheck(checkedBefore time.Time, limit int) ([]parser.Offer, error)
+	ListOffersToCheckContext(ctx context.Context, checkedBefore time.Time, limit int) ([]parser.Offer, error)
+	MarkOfferChecked(offer parser.Offer) error
+	MarkOfferCheckedContext(ctx context.Context, offer parser.Offer) error
+	MarkOfferRemoved(offer parser.Offer) ([]RemovedOffer, error)
+	MarkOfferRemovedContext(ctx context.Context, offer parser.Offer) ([]RemovedOffer, error)
+
+	WithTx(ctx context.Context, fn func(tx Store) error) error
+}
+
+// Store of the searches of the users.
+// Every method has a variant taking a context, which cancels its queries.
+type SearchStore interface {
+	AddSearch(userID int64, url string) error
+	AddSearchContext(ctx context.Context, userID int64, url string) error
+	UpdateSearch(userID int64, ID int64, url string) error
+	UpdateSearchContext(ctx context.Context, userID int64, ID int64, url string) error
+	DeleteSearch(ID int64) error
+	DeleteSearchContext(ctx context.Context, ID int64) error
+	SetPriceAlerts(userID int64, ID int64, enabled bool) error
+	SetPriceAlertsContext(ctx context.Context, userID int64, ID int64, enabled bool) error
+	PauseSearch(userID int64, ID int64, until time.Time) error
+	PauseSearchContext(ctx context.Context, userID int64, ID int64, until time.Time) error
+	ResumeSearch(userID int64, ID int64) error
+	ResumeSearchContext(ctx context.Context, userID int64, ID int64) error
+	ListSearches(userID int64) ([]Search, error)
+	ListSearchesContext(ctx context.Context, userID int64) ([]Search, error)
+	GetSearch(id int64) (Search, error)
+	GetSearchContext(ctx context.Context, id int64) (Search, error)
+	GetAllSearches() ([]Search, error)
+	GetAllSearchesContext(ctx context.Context) ([]Search, error)
+	SearchExists(search Search) (bool, error)
+	SearchExistsContext(ctx context.Context, search Search) (bool, error)
+
+	WithTx(ctx context.Context, fn func(tx Store) error) error
+}
+
+// Store of both the offers and the searches, passed to the functions run by WithTx.
+type Store interface {
+	OfferStore
+	SearchStore
+}
+
+// SQLStore keeps the users, the searches and the offers in a SQLite or a PostgreSQL database.
+// It implements both OfferStore and SearchStore, several bots may share a PostgreSQL database.
+//
+// Attributes:
+//
+//	db - connections of the database
+//	tx - transaction all the queries run in, nil outside of WithTx
+//	dialect - SQL flavour of the database engine
+type SQLStore struct {
+	db      *sql.DB
+	tx      *sql.Tx
+	dialect dialect
+}
+
+var _ Store = (*SQLStore)(nil)
+
+// Close the connections of the store.
+func (s *SQLStore) Close() error {
+	if s.tx != nil {
+		return errors.New("the store of a transaction cannot be closed")
+	}
+	return s.db.Close()
+}
+
+// Run the function in a transaction, committed if the function returns nil and rolled back otherwise.
+// All the operations of the store passed to the function run in the transaction,
+// so multi-step operations, e.g. storing an offer and recording its price, are atomic.
+// The store passed to the function must not be used after it returns.
+// Called on the store of a transaction, the function runs in that transaction.
+//
+// Parameters:
+//
+//	ctx - context of the transaction, canceling it rolls the transaction back
+//	fn - function running the operations of the transaction
+//
+// Returns:
+//
+//	error - error returned by the function, or error if the database connection fails
+//
+// Example:
+//
+//	err := store.WithTx(ctx, func(tx Store) error {
+//		added, err := tx.AddOfferContext(ctx, offer, 1, 2)
+//		if err != nil || !added {
+//			return err
+//		}
+//		_, err = tx.RecordPriceContext(ctx, offer)
+//		return err
+//	})
+func (s *SQLStore) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	return s.inTx(ctx, func(tx *SQLStore) error {
+		return fn(tx)
+	})
+}
+
+// Run the function in a transaction like WithTx, passing it the store of the transaction.
+func (s *SQLStore) inTx(ctx context.Context, fn func(tx *SQLStore) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(&SQLStore{db: s.db, tx: tx, dialect: s.dialect})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Queries of the database or of a transaction.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Get the transaction of the store, or the database outside of transactions.
+func (s *SQLStore) conn() querier {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.db
+}
+
+// Execute the statement written with "?" placeholders.
+func (s *SQLStore) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return s.conn().ExecContext(ctx, s.dialect.rebind(query), args...)
+}
+
+// Run the query written with "?" placeholders.
+func (s *SQLStore) query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return s.conn().QueryContext(ctx, s.dialect.rebind(query), args...)
+}
+
+// Run the query written with "?" placeholders, expecting at most one row.
+func (s *SQLStore) queryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	return s.conn().QueryRowContext(ctx, s.dialect.rebind(query), args...)
+}
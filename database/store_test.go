@@ -0,0 +1,698 @@
+package database
+
+import (
+	"apartment-parser/parser"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+)
+
+// Url of the PostgreSQL database the PostgreSQL stores are tested against, empty to skip them.
+// Set with the POSTGRES_TEST_DSN environment variable, or POSTGRES_TEST_EMBEDDED to start an embedded server.
+var postgresTestDSN string
+
+func TestMain(m *testing.M) {
+	postgresTestDSN = os.Getenv("POSTGRES_TEST_DSN")
+	if postgresTestDSN != "" || os.Getenv("POSTGRES_TEST_EMBEDDED") == "" {
+		os.Exit(m.Run())
+	}
+
+	runtime, err := os.MkdirTemp("", "apartibot-postgres")
+	if err != nil {
+		log.Fatal(err)
+	}
+	config := embeddedpostgres.DefaultConfig().Port(54329).RuntimePath(runtime)
+	server := embeddedpostgres.NewDatabase(config)
+	if err := server.Start(); err != nil {
+		log.Fatal(err)
+	}
+	postgresTestDSN = config.GetConnectionURL() + "?sslmode=disable"
+
+	code := m.Run()
+	server.Stop()
+	os.RemoveAll(runtime)
+	os.Exit(code)
+}
+
+func TestSQLiteStore(t *testing.T) {
+	testStores(t, func(t *testing.T) (OfferStore, SearchStore) {
+		store, err := Open(filepath.Join(t.TempDir(), "apartibot.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store, store
+	})
+}
+
+func TestPostgresStore(t *testing.T) {
+	if postgresTestDSN == "" {
+		t.Skip("set POSTGRES_TEST_DSN or POSTGRES_TEST_EMBEDDED to test the PostgreSQL stores")
+	}
+
+	admin, err := sql.Open("postgres", postgresTestDSN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer admin.Close()
+
+	// Every test gets its own schema, so the suite can run against a database in use
+	schemas := 0
+	testStores(t, func(t *testing.T) (OfferStore, SearchStore) {
+		schemas++
+		schema := fmt.Sprintf("apartibot_test_%d_%d", os.Getpid(), schemas)
+		if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+		separator := "?"
+		if strings.Contains(postgresTestDSN, "?") {
+			separator = "&"
+		}
+		store, err := Open(postgresTestDSN + separator + "search_path=" + schema)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store, store
+	})
+}
+
+// Set the time the offers with the url were first seen at.
+func setFirstSeen(t *testing.T, offers OfferStore, url string, at time.Time) {
+	t.Helper()
+	store := offers.(*SQLStore)
+	if _, err := store.exec(context.Background(), "UPDATE offers SET first_seen_at = ? WHERE url = ?", at, url); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Run the conformance tests of the stores, open creates empty stores sharing a database.
+func testStores(t *testing.T, open func(t *testing.T) (OfferStore, SearchStore)) {
+	t.Run("Searches", func(t *testing.T) { testSearches(t, open) })
+	t.Run("OfferRoundTrip", func(t *testing.T) { testOfferRoundTrip(t, open) })
+	t.Run("ListOffers", func(t *testing.T) { testListOffers(t, open) })
+	t.Run("Prices", func(t *testing.T) { testPrices(t, open) })
+	t.Run("PricesOtherListingId", func(t *testing.T) { testPricesOtherListingId(t, open) })
+	t.Run("Removals", func(t *testing.T) { testRemovals(t, open) })
+	t.Run("Transactions", func(t *testing.T) { testTransactions(t, open) })
+}
+
+// Add a search and get its id.
+func addTestSearch(t *testing.T, searches SearchStore, userID int64, url string) int64 {
+	t.Helper()
+	if err := searches.AddSearch(userID, url); err != nil {
+		t.Fatal(err)
+	}
+	list, err := searches.ListSearches(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, search := range list {
+		if search.URL == url {
+			return search.ID
+		}
+	}
+	t.Fatalf("search %s not found", url)
+	return 0
+}
+
+func testSearches(t *testing.T, open func(t *testing.T) (OfferStore, SearchStore)) {
+	_, searches := open(t)
+
+	id := addTestSearch(t, searches, 1, "https://www.olx.pl/a/")
+	if err := searches.AddSearch(1, "https://www.olx.pl/a/"); err != nil {
+		t.Fatal(err)
+	}
+	addTestSearch(t, searches, 1, "https://www.olx.pl/b/")
+	addTestSearch(t, searches, 2, "https://www.olx.pl/a/")
+
+	list, err := searches.ListSearches(1)
+	if err != nil || len(list) != 2 {
+		t.Fatalf("ListSearches = %v, %v, want 2 searches", list, err)
+	}
+	all, err := searches.GetAllSearches()
+	if err != nil || len(all) != 3 {
+		t.Fatalf("GetAllSearches = %v, %v, want 3 searches", all, err)
+	}
+
+	search, err := searches.GetSearch(id)
+	want := Search{ID: id, UserID: 1, URL: "https://www.olx.pl/a/", Active: true}
+	if err != nil || search != want {
+		t.Fatalf("GetSearch = %+v, %v, want %+v", search, err, want)
+	}
+
+	if err := searches.UpdateSearch(1, id, "https://www.olx.pl/b/"); err == nil {
+		t.Error("UpdateSearch to the url of another search succeeded")
+	}
+	// The search of another user is not updated
+	if err := searches.UpdateSearch(2, id, "https://www.olx.pl/d/"); err != sql.ErrNoRows {
+		t.Errorf("UpdateSearch of the search of another user = %v, want sql.ErrNoRows", err)
+	}
+	if search, _ = searches.GetSearch(id); search.URL != "https://www.olx.pl/a/" {
+		t.Errorf("search updated by another user = %+v", search)
+	}
+	if err := searches.UpdateSearch(1, id, "https://www.olx.pl/c/"); err != nil {
+		t.Fatal(err)
+	}
+	// The searches of another user are not changed
+	if err := searches.SetPriceAlerts(2, id, true); err != sql.ErrNoRows {
+		t.Errorf("SetPriceAlerts of the search of another user = %v, want sql.ErrNoRows", err)
+	}
+	if err := searches.PauseSearch(2, id, time.Time{}); err != sql.ErrNoRows {
+		t.Errorf("PauseSearch of the search of another user = %v, want sql.ErrNoRows", err)
+	}
+	if search, _ = searches.GetSearch(id); search.PriceAlerts || !search.Active {
+		t.Errorf("search changed by another user = %+v", search)
+	}
+	if err := searches.SetPriceAlerts(1, id, true); err != nil {
+		t.Fatal(err)
+	}
+	until := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := searches.PauseSearch(1, id, until); err != nil {
+		t.Fatal(err)
+	}
+	search, err = searches.GetSearch(id)
+	want = Search{ID: id, UserID: 1, URL: "https://www.olx.pl/c/", PriceAlerts: true, PausedUntil: until}
+	if err != nil || search != want {
+		t.Fatalf("GetSearch after the update = %+v, %v, want %+v", search, err, want)
+	}
+
+	if err := searches.ResumeSearch(2, id); err != sql.ErrNoRows {
+		t.Errorf("ResumeSearch of the search of another user = %v, want sql.ErrNoRows", err)
+	}
+	if search, _ = searches.GetSearch(id); search.Active {
+		t.Errorf("search resumed by another user = %+v", search)
+	}
+	if err := searches.ResumeSearch(1, id); err != nil {
+		t.Fatal(err)
+	}
+	if search, _ = searches.GetSearch(id); !search.Active || !search.PausedUntil.IsZero() {
+		t.Errorf("resumed search = %+v", search)
+	}
+
+	exists, err := searches.SearchExists(search)
+	if err != nil || !exists {
+		t.Errorf("SearchExists = %v, %v, want true", exists, err)
+	}
+	if err := searches.DeleteSearch(id); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ = searches.SearchExists(search); exists {
+		t.Error("deleted search exists")
+	}
+	if _, err := searches.GetSearch(id); err != sql.ErrNoRows {
+		t.Errorf("GetSearch of a deleted search = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func testOfferRoundTrip(t *testing.T, open func(t *testing.T) (OfferStore, SearchStore)) {
+	offers, searches := open(t)
+	search_id := addTestSearch(t, searches, 1, "https://www.olx.pl/a/")
+
+	offer := parser.Offer{
+		Title:             "Mieszkanie 2 pokojowe",
+		Price:             2500,
+		Location:          "Warszawa, Mokotów",
+		PostedAt:          time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Url:               "https://www.olx.pl/d/oferta/mieszkanie-CID3-ID1.html",
+		ListingId:         "ID1",
+		AdditionalPayment: 600,
+		Description:       "Jasne mieszkanie\nz balkonem",
+		Rooms:             "Liczba pokoi: 2",
+		Area:              "Powierzchnia: 45,5 m²",
+		Floor:             "Poziom: 3",
+		RoomCount:         2,
+		AreaM2:            45.5,
+		FloorNumber:       3,
+		TotalFloors:       5,
+		Images:            []string{"https://img/1.jpg", "https://img/2.jpg", "https://img/3.jpg"},
+		Source:            "olx",
+		Latitude:          52.1934,
+		Longitude:         21.0355,
+		IsBusiness:        true,
+		ImageHashes:       []uint64{1, 0xffffffffffffffff},
+	}
+	// Every field is set, so the comparison of the stored offer covers all of them
+	fields := reflect.ValueOf(offer)
+	for i := 0; i < fields.NumField(); i++ {
+		if fields.Field(i).IsZero() {
+			t.Fatalf("test offer has no %s", fields.Type().Field(i).Name)
+		}
+	}
+	before := now()
+	if added, err := offers.AddOffer(offer, 1, search_id); err != nil || !added {
+		t.Fatalf("AddOffer = %v, %v, want true", added, err)
+	}
+	// Adding the offer again does nothing, it is identified by its listing id or by its url
+	if added, err := offers.AddOffer(offer, 1, search_id); err != nil || added {
+		t.Fatalf("AddOffer again = %v, %v, want false", added, err)
+	}
+	moved := offer
+	moved.Url = "https://www.olx.pl/d/oferta/mieszkanie-CID3-ID1-moved.html"
+	if added, err := offers.AddOffer(moved, 1, search_id); err != nil || added {
+		t.Fatalf("AddOffer with another url = %v, %v, want false", added, err)
+	}
+	renamed := offer
+	renamed.ListingId = "ID9"
+	if added, err := offers.AddOffer(renamed, 1, search_id); err != nil || added {
+		t.Fatalf("AddOffer with another listing id = %v, %v, want false", added, err)
+	}
+
+	stored, err := offers.ListOffers(OfferFilter{})
+	if err != nil || len(stored) != 1 {
+		t.Fatalf("ListOffers = %v, %v, want 1 offer", stored, err)
+	}
+	if !reflect.DeepEqual(stored[0].Offer, offer) {
+		t.Errorf("stored offer = %+v, want %+v", stored[0].Offer, offer)
+	}
+	if stored[0].UserID != 1 || stored[0].SearchID != search_id {
+		t.Errorf("stored offer of user %d and search %d, want 1 and %d", stored[0].UserID, stored[0].SearchID, search_id)
+	}
+	if stored[0].FirstSeenAt.Before(before) || !stored[0].LastSeenAt.Equal(stored[0].FirstSeenAt) {
+		t.Errorf("stored offer seen at %v and %v, want both after %v", stored[0].FirstSeenAt, stored[0].LastSeenAt, before)
+	}
+
+	exists, err := offers.OfferExists(offer, 1)
+	if err != nil || !exists {
+		t.Errorf("OfferExists = %v, %v, want true", exists, err)
+	}
+	if exists, _ = offers.OfferExists(offer, 2); exists {
+		t.Error("offer exists for another user")
+	}
+
+	// Offers without the optional fields come back empty
+	bare := parser.Offer{Url: "https://www.otodom.pl/pl/oferta/a-ID2", Source: "otodom", ImageHashes: []uint64{}}
+	if _, err := offers.AddOffer(bare, 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	stored, err = offers.ListOffers(OfferFilter{SearchID: 0, OrderBy: OrderByID, Descending: true, Limit: 1})
+	if err != nil || len(stored) != 1 || !reflect.DeepEqual(stored[0].Offer, bare) || stored[0].SearchID != 0 {
+		t.Errorf("bare offer = %+v, %v, want %+v", stored, err, bare)
+	}
+
+	// Offers listed together keep their own images, and the posting times of other time zones keep their instant
+	warsaw, err := time.LoadLocation("Europe/Warsaw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := offer
+	other.Url, other.ListingId, other.Price = "https://www.olx.pl/d/oferta/mieszkanie-CID3-ID3.html", "ID3", 2700
+	other.PostedAt = time.Date(2026, 5, 6, 7, 8, 9, 0, warsaw)
+	other.Images = []string{"https://img/4.jpg"}
+	other.IsBusiness = false
+	if _, err := offers.AddOffer(other, 1, search_id); err != nil {
+		t.Fatal(err)
+	}
+	stored, err = offers.ListOffers(OfferFilter{UserID: 1, OrderBy: OrderByID})
+	if err != nil || len(stored) != 3 {
+		t.Fatalf("ListOffers = %v, %v, want 3 offers", stored, err)
+	}
+	got := stored[2].Offer
+	if !got.PostedAt.Equal(other.PostedAt) {
+		t.Errorf("posted at %v, want %v", got.PostedAt, other.PostedAt)
+	}
+	got.PostedAt = other.PostedAt
+	if !reflect.DeepEqual(got, other) || !reflect.DeepEqual(stored[0].Offer, offer) {
+		t.Errorf("stored offers = %+v and %+v, want %+v and %+v", stored[0].Offer, got, offer, other)
+	}
+
+	// Check and removal times are listed with the offer
+	if err := offers.MarkOfferChecked(other); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := offers.MarkOfferRemoved(other); err != nil {
+		t.Fatal(err)
+	}
+	stored, err = offers.ListOffers(OfferFilter{UserID: 1, OrderBy: OrderByID, Offset: 2})
+	if err != nil || len(stored) != 1 || stored[0].CheckedAt.Before(before) || stored[0].RemovedAt.Before(before) {
+		t.Errorf("ListOffers = %+v, %v, want the offer checked and removed after %v", stored, err, before)
+	}
+	if stored, _ = offers.ListOffers(OfferFilter{UserID: 1, Limit: 1}); len(stored) != 1 || !stored[0].CheckedAt.IsZero() || !stored[0].RemovedAt.IsZero() {
+		t.Errorf("ListOffers = %+v, want the offer never checked", stored)
+	}
+
+	// Deleting the search keeps its offers
+	if err := searches.DeleteSearch(search_id); err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := offers.CountOffers(OfferFilter{UserID: 1}); count != 3 {
+		t.Errorf("offers after deleting the search = %d, want 3", count)
+	}
+}
+
+func testListOffers(t *testing.T, open func(t *testing.T) (OfferStore, SearchStore)) {
+	offers, searches := open(t)
+	search_a := addTestSearch(t, searches, 1, "https://www.olx.pl/a/")
+	search_b := addTestSearch(t, searches, 1, "https://www.olx.pl/b/")
+
+	for i, price := range []int{3000, 1000, 4000, 2000, 5000} {
+		search_id := search_a
+		if i%2 == 1 {
+			search_id = search_b
+		}
+		offer := parser.Offer{Url: fmt.Sprintf("https://www.olx.pl/d/oferta/%d.html", i), Price: price}
+		if _, err := offers.AddOffer(offer, 1, search_id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := offers.AddOffer(parser.Offer{Url: "https://www.olx.pl/d/oferta/other.html", Price: 2500}, 2, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Offers are first seen a day apart, the offer of the other user at the same time as the second one
+	base := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		setFirstSeen(t, offers, fmt.Sprintf("https://www.olx.pl/d/oferta/%d.html", i), base.AddDate(0, 0, i))
+	}
+	setFirstSeen(t, offers, "https://www.olx.pl/d/oferta/other.html", base.AddDate(0, 0, 1))
+	warsaw, err := time.LoadLocation("Europe/Warsaw")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prices := func(filter OfferFilter) []int {
+		t.Helper()
+		stored, err := offers.ListOffers(filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prices := make([]int, len(stored))
+		for i, offer := range stored {
+			prices[i] = offer.Offer.Price
+		}
+		return prices
+	}
+
+	tests := []struct {
+		name   string
+		filter OfferFilter
+		want   []int
+	}{
+		{"all", OfferFilter{}, []int{3000, 1000, 4000, 2000, 5000, 2500}},
+		{"user", OfferFilter{UserID: 2}, []int{2500}},
+		{"search", OfferFilter{SearchID: search_b}, []int{1000, 2000}},
+		{"price range", OfferFilter{MinPrice: 2000, MaxPrice: 4000}, []int{3000, 4000, 2000, 2500}},
+		{"by price", OfferFilter{UserID: 1, OrderBy: OrderByPrice}, []int{1000, 2000, 3000, 4000, 5000}},
+		{"descending", OfferFilter{UserID: 1, Descending: true}, []int{5000, 2000, 4000, 1000, 3000}},
+		{"page", OfferFilter{UserID: 1, OrderBy: OrderByPrice, Limit: 2, Offset: 2}, []int{3000, 4000}},
+		{"offset only", OfferFilter{UserID: 1, OrderBy: OrderByPrice, Offset: 3}, []int{4000, 5000}},
+		{"seen from", OfferFilter{SeenFrom: base.AddDate(0, 0, 3)}, []int{2000, 5000}},
+		{"seen to", OfferFilter{SeenTo: base.AddDate(0, 0, 1)}, []int{3000}},
+		{"seen range", OfferFilter{SeenFrom: base.AddDate(0, 0, 1), SeenTo: base.AddDate(0, 0, 3)}, []int{1000, 4000, 2500}},
+		{"seen range in another time zone", OfferFilter{SeenFrom: base.AddDate(0, 0, 1).In(warsaw), SeenTo: base.AddDate(0, 0, 3).In(warsaw)}, []int{1000, 4000, 2500}},
+		{"seen range with other filters", OfferFilter{UserID: 1, MaxPrice: 1000, SeenFrom: base.AddDate(0, 0, 1), SeenTo: base.AddDate(0, 0, 3)}, []int{1000}},
+		{"empty seen range", OfferFilter{SeenFrom: base.AddDate(0, 0, 1), SeenTo: base.AddDate(0, 0, 1)}, []int{}},
+		{"seen before", OfferFilter{SeenTo: base}, []int{}},
+		{"seen after", OfferFilter{SeenFrom: base.AddDate(0, 0, 5)}, []int{}},
+		{"by first seen with ties", OfferFilter{OrderBy: OrderByFirstSeen}, []int{3000, 1000, 2500, 4000, 2000, 5000}},
+		{"by first seen descending", OfferFilter{OrderBy: OrderByFirstSeen, Descending: true}, []int{5000, 2000, 4000, 2500, 1000, 3000}},
+		{"first page", OfferFilter{UserID: 1, OrderBy: OrderByPrice, Limit: 2}, []int{1000, 2000}},
+		{"last partial page", OfferFilter{UserID: 1, OrderBy: OrderByPrice, Limit: 2, Offset: 4}, []int{5000}},
+		{"offset at the end", OfferFilter{UserID: 1, OrderBy: OrderByPrice, Limit: 2, Offset: 5}, []int{}},
+		{"offset past the end", OfferFilter{UserID: 1, Offset: 10}, []int{}},
+		{"limit above the count", OfferFilter{UserID: 1, OrderBy: OrderByPrice, Limit: 10}, []int{1000, 2000, 3000, 4000, 5000}},
+		{"descending page", OfferFilter{UserID: 1, OrderBy: OrderByPrice, Descending: true, Limit: 2, Offset: 1}, []int{4000, 3000}},
+	}
+	for _, tt := range tests {
+		if got := prices(tt.filter); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: prices = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Pages of the offers with the same order value neither repeat nor skip offers
+	paged := make([]int, 0)
+	for offset := 0; offset < 7; offset += 2 {
+		paged = append(paged, prices(OfferFilter{OrderBy: OrderByFirstSeen, Limit: 2, Offset: offset})...)
+	}
+	if want := prices(OfferFilter{OrderBy: OrderByFirstSeen}); !reflect.DeepEqual(paged, want) {
+		t.Errorf("paged prices = %v, want %v", paged, want)
+	}
+
+	if _, err := offers.ListOffers(OfferFilter{OrderBy: "price; DROP TABLE offers"}); err == nil {
+		t.Error("ListOffers with an unknown order succeeded")
+	}
+	if count, err := offers.CountOffers(OfferFilter{UserID: 1, MinPrice: 2000, Limit: 1}); err != nil || count != 4 {
+		t.Errorf("CountOffers = %d, %v, want 4", count, err)
+	}
+
+	latest, err := offers.ListUserOffers(1, 2)
+	if err != nil || len(latest) != 2 || latest[0].Price != 5000 || latest[1].Price != 2000 {
+		t.Errorf("ListUserOffers = %v, %v, want the offers for 5000 and 2000", latest, err)
+	}
+}
+
+func testPrices(t *testing.T, open func(t *testing.T) (OfferStore, SearchStore)) {
+	offers, _ := open(t)
+	offer := parser.Offer{Url: "https://www.olx.pl/d/oferta/a-ID1.html", ListingId: "ID1", Source: "olx", Price: 3000, AdditionalPayment: 500}
+	if _, err := offers.AddOffer(offer, 1, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, price := range []int{3000, 3000, 2800} {
+		offer.Price = price
+		if _, err := offers.RecordPrice(offer); err != nil {
+			t.Fatal(err)
+		}
+	}
+	history, err := offers.PriceHistory(offer)
+	if err != nil || len(history) != 2 || history[0].Price != 3000 || history[1].Price != 2800 || history[1].AdditionalPayment != 500 {
+		t.Errorf("PriceHistory = %v, %v, want 3000 and 2800", history, err)
+	}
+
+	// Search results lack the additional payment
+	offer.AdditionalPayment = 0
+	stored, changed, err := offers.UpdateOfferPrice(offer, 1)
+	if err != nil || !changed || stored.Price != 3000 || stored.AdditionalPayment != 500 {
+		t.Errorf("UpdateOfferPrice = %+v, %v, %v, want the previous price changed", stored, changed, err)
+	}
+	if _, changed, _ = offers.UpdateOfferPrice(offer, 1); changed {
+		t.Error("UpdateOfferPrice changed the same price")
+	}
+	if _, changed, _ = offers.UpdateOfferPrice(offer, 2); changed {
+		t.Error("UpdateOfferPrice changed the offer of another user")
+	}
+
+	// A reposted offer with the same price is not a price change
+	reposted := offer
+	reposted.Url = "https://www.olx.pl/d/oferta/a-odswiezone-ID1.html"
+	if recorded, err := offers.RecordPrice(reposted); err != nil || recorded {
+		t.Errorf("RecordPrice of the reposted offer = %v, %v, want false", recorded, err)
+	}
+	if _, changed, err := offers.UpdateOfferPrice(reposted, 1); err != nil || changed {
+		t.Errorf("UpdateOfferPrice of the reposted offer = %v, %v, want false", changed, err)
+	}
+
+	// A change of the additional payment alone is a price change
+	offer.AdditionalPayment = 400
+	if recorded, err := offers.RecordPrice(offer); err != nil || !recorded {
+		t.Errorf("RecordPrice of the new additional payment = %v, %v, want true", recorded, err)
+	}
+	stored, changed, err = offers.UpdateOfferPrice(offer, 1)
+	if err != nil || !changed || stored.Price != 2800 || stored.AdditionalPayment != 500 {
+		t.Errorf("UpdateOfferPrice = %+v, %v, %v, want the previous additional payment changed", stored, changed, err)
+	}
+	history, _ = offers.PriceHistory(offer)
+	if len(history) != 3 || history[2].Price != 2800 || history[2].AdditionalPayment != 400 {
+		t.Errorf("PriceHistory = %v, want 2800 with 400 last", history)
+	}
+
+	if err := offers.MarkOfferSeen(offer, 1); err != nil {
+		t.Fatal(err)
+	}
+	list, _ := offers.ListOffers(OfferFilter{})
+	if len(list) != 1 || list[0].Offer.Price != 2800 || list[0].Offer.AdditionalPayment != 400 || list[0].LastSeenAt.Before(list[0].FirstSeenAt) {
+		t.Errorf("stored offer = %+v", list)
+	}
+}
+
+// Offers found with another listing id than the stored one, or without one, are found by their url.
+func testPricesOtherListingId(t *testing.T, open func(t *testing.T) (OfferStore, SearchStore)) {
+	offers, _ := open(t)
+	stored := parser.Offer{Url: "https://www.otodom.pl/pl/oferta/a-ID4bbbb", ListingId: "4bbbb", Source: "otodom", Price: 3000}
+	if _, err := offers.AddOffer(stored, 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := offers.RecordPrice(stored); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, listing_id := range []string{"65123456", ""} {
+		found := stored
+		found.ListingId = listing_id
+		if exists, err := offers.OfferExists(found, 1); err != nil || !exists {
+			t.Errorf("%q: OfferExists = %v, %v, want true", listing_id, exists, err)
+		}
+		if err := offers.MarkOfferSeen(found, 1); err != nil {
+			t.Fatal(err)
+		}
+		if history, err := offers.PriceHistory(found); err != nil || len(history) != 1 {
+			t.Errorf("%q: PriceHistory = %v, %v, want the stored price", listing_id, history, err)
+		}
+		if recorded, err := offers.RecordPrice(found); err != nil || recorded {
+			t.Errorf("%q: RecordPrice of the same price = %v, %v, want false", listing_id, recorded, err)
+		}
+	}
+
+	found := stored
+	found.ListingId, found.Price = "", 2800
+	if recorded, err := offers.RecordPrice(found); err != nil || !recorded {
+		t.Errorf("RecordPrice of the dropped price = %v, %v, want true", recorded, err)
+	}
+	old, changed, err := offers.UpdateOfferPrice(found, 1)
+	if err != nil || !changed || old.Price != 3000 || old.ListingId != "4bbbb" {
+		t.Errorf("UpdateOfferPrice = %+v, %v, %v, want the stored offer changed", old, changed, err)
+	}
+	if history, _ := offers.PriceHistory(stored); len(history) != 2 {
+		t.Errorf("PriceHistory of the stored offer = %v, want both prices", history)
+	}
+	list, _ := offers.ListOffers(OfferFilter{})
+	if len(list) != 1 || list[0].Offer.Price != 2800 || list[0].Offer.ListingId != "4bbbb" {
+		t.Errorf("stored offers = %+v, want the stored listing with the new price", list)
+	}
+}
+
+func testRemovals(t *testing.T, open func(t *testing.T) (OfferStore, SearchStore)) {
+	offers, _ := open(t)
+	posted := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+	kept := parser.Offer{Url: "https://www.olx.pl/d/oferta/kept.html", Source: "olx"}
+	removed := parser.Offer{Url: "https://www.olx.pl/d/oferta/removed.html", Source: "olx", Price: 2000, PostedAt: posted}
+	for _, user_id := range []int64{1, 2} {
+		for _, offer := range []parser.Offer{kept, removed} {
+			if _, err := offers.AddOffer(offer, user_id, 0); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	to_check, err := offers.ListOffersToCheck(time.Now().Add(time.Hour), 10)
+	if err != nil || len(to_check) != 2 {
+		t.Fatalf("ListOffersToCheck = %v, %v, want 2 urls", to_check, err)
+	}
+	if err := offers.MarkOfferChecked(kept); err != nil {
+		t.Fatal(err)
+	}
+	to_check, _ = offers.ListOffersToCheck(time.Now().Add(time.Hour), 1)
+	if len(to_check) != 1 || to_check[0].Url != removed.Url {
+		t.Errorf("ListOffersToCheck = %v, want the never checked offer first", to_check)
+	}
+	if to_check, _ = offers.ListOffersToCheck(time.Now().Add(-time.Hour), 10); len(to_check) != 1 {
+		t.Errorf("ListOffersToCheck = %v, want only the never checked offer", to_check)
+	}
+
+	marked, err := offers.MarkOfferRemoved(removed)
+	if err != nil || len(marked) != 2 {
+		t.Fatalf("MarkOfferRemoved = %v, %v, want the offers of 2 users", marked, err)
+	}
+	for _, r := range marked {
+		if r.Offer.Price != 2000 || !r.ListedAt.Equal(posted) || r.RemovedAt.IsZero() {
+			t.Errorf("removed offer = %+v", r)
+		}
+	}
+	if marked, _ = offers.MarkOfferRemoved(removed); len(marked) != 0 {
+		t.Errorf("MarkOfferRemoved again = %v, want none", marked)
+	}
+	if to_check, _ = offers.ListOffersToCheck(time.Now().Add(time.Hour), 10); len(to_check) != 1 || to_check[0].Url != kept.Url {
+		t.Errorf("ListOffersToCheck = %v, want only the kept offer", to_check)
+	}
+}
+
+func testTransactions(t *testing.T, open func(t *testing.T) (OfferStore, SearchStore)) {
+	offers, searches := open(t)
+	ctx := context.Background()
+	offer := parser.Offer{Url: "https://www.olx.pl/d/oferta/a-ID1.html", ListingId: "ID1", Source: "olx", Price: 3000, Images: []string{"https://img/1.jpg"}}
+
+	// A failed step rolls back the whole transaction
+	failure := errors.New("notification failed")
+	err := offers.WithTx(ctx, func(tx Store) error {
+		if _, err := tx.AddOfferContext(ctx, offer, 1, 0); err != nil {
+			return err
+		}
+		if err := tx.AddSearchContext(ctx, 1, "https://www.olx.pl/a/"); err != nil {
+			return err
+		}
+		if _, err := tx.RecordPriceContext(ctx, offer); err != nil {
+			return err
+		}
+		return failure
+	})
+	if err != failure {
+		t.Fatalf("WithTx = %v, want %v", err, failure)
+	}
+	if exists, _ := offers.OfferExists(offer, 1); exists {
+		t.Error("offer of a rolled back transaction exists")
+	}
+	if history, _ := offers.PriceHistory(offer); len(history) != 0 {
+		t.Errorf("price history of a rolled back transaction = %v", history)
+	}
+	if list, _ := searches.ListSearches(1); len(list) != 0 {
+		t.Errorf("searches of a rolled back transaction = %v", list)
+	}
+
+	// Nested transactions join the outer one
+	err = offers.WithTx(ctx, func(tx Store) error {
+		return tx.WithTx(ctx, func(nested Store) error {
+			added, err := nested.AddOfferContext(ctx, offer, 1, 0)
+			if err != nil || !added {
+				return fmt.Errorf("AddOfferContext = %v, %v, want true", added, err)
+			}
+			if exists, err := tx.OfferExistsContext(ctx, offer, 1); err != nil || !exists {
+				return fmt.Errorf("offer added by the nested transaction not seen by the outer one: %v", err)
+			}
+			_, err = nested.RecordPriceContext(ctx, offer)
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := offers.ListOffersContext(ctx, OfferFilter{UserID: 1})
+	if err != nil || len(stored) != 1 || !reflect.DeepEqual(stored[0].Offer.Images, offer.Images) {
+		t.Errorf("ListOffersContext = %+v, %v, want the committed offer", stored, err)
+	}
+	if history, _ := offers.PriceHistory(offer); len(history) != 1 {
+		t.Errorf("price history of a committed transaction = %v, want 1 price", history)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := offers.AddOfferContext(canceled, parser.Offer{Url: "https://www.olx.pl/d/oferta/b.html"}, 1, 0); err == nil {
+		t.Error("AddOfferContext with a canceled context succeeded")
+	}
+	if count, _ := offers.CountOffers(OfferFilter{}); count != 1 {
+		t.Errorf("offers after the canceled add = %d, want 1", count)
+	}
+}
+
+func TestRebind(t *testing.T) {
+	query := "SELECT 1 FROM offers WHERE user_id = ? AND url = ?"
+	if got := sqliteDialect.rebind(query); got != query {
+		t.Errorf("SQLite rebind = %q", got)
+	}
+	want := "SELECT 1 FROM offers WHERE user_id = $1 AND url = $2"
+	if got := postgresDialect.rebind(query); got != want {
+		t.Errorf("PostgreSQL rebind = %q, want %q", got, want)
+	}
+}
+
+func TestMigrationVersions(t *testing.T) {
+	if len(migrations) != len(postgresMigrations) {
+		t.Fatalf("%d SQLite migrations and %d PostgreSQL migrations", len(migrations), len(postgresMigrations))
+	}
+	for i := range migrations {
+		if migrations[i].version != i+1 || postgresMigrations[i].version != i+1 {
+			t.Errorf("migration %d has versions %d and %d", i, migrations[i].version, postgresMigrations[i].version)
+		}
+	}
+}
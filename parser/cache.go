@@ -0,0 +1,228 @@
+package parser
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache stores the fetched pages and images on disk.
+// Entries are keyed by url, served without a request while younger than TTL
+// and revalidated using ETag and Last-Modified afterwards.
+//
+// Attributes:
+//
+//	Dir: The directory the entries are stored in.
+//	TTL: The time an entry is served without revalidation.
+type Cache struct {
+	Dir string
+	TTL time.Duration
+
+	mutex sync.Mutex
+	now   func() time.Time
+}
+
+// Metadata of the cached entry, stored next to the body.
+type cacheEntry struct {
+	Url          string      `json:"url"`
+	Header       http.Header `json:"header"`
+	ETag         string      `json:"etag"`
+	LastModified string      `json:"last_modified"`
+	FetchedAt    time.Time   `json:"fetched_at"`
+}
+
+// Create a new cache in the given directory.
+// The directory is created if it does not exist.
+//
+// Parameters:
+//
+//	dir: The directory to store the entries in.
+//	ttl: The time an entry is served without revalidation.
+//
+// Returns:
+//
+//	The cache and an error if the directory could not be created.
+func NewCache(dir string, ttl time.Duration) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Cache{Dir: dir, TTL: ttl}, nil
+}
+
+func (c *Cache) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// Get the path of the entry files without the extension.
+func (c *Cache) path(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.Dir, hex.EncodeToString(sum[:]))
+}
+
+// Load the entry of the url.
+//
+// Returns:
+//
+//	The metadata, the body and false if the url is not cached.
+func (c *Cache) load(url string) (cacheEntry, []byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	path := c.path(url)
+	meta, err := os.ReadFile(path + ".json")
+	if err != nil {
+		return cacheEntry{}, nil, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(meta, &entry); err != nil || entry.Url != url {
+		return cacheEntry{}, nil, false
+	}
+	body, err := os.ReadFile(path + ".body")
+	if err != nil {
+		return cacheEntry{}, nil, false
+	}
+	return entry, body, true
+}
+
+// Store the entry of the url, replacing the previous one.
+func (c *Cache) store(entry cacheEntry, body []byte) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	meta, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	path := c.path(entry.Url)
+	if body != nil {
+		if err := writeFileAtomic(path+".body", body); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(path+".json", meta)
+}
+
+// Remove the entries which were not fetched or revalidated for longer than maxAge.
+//
+// Parameters:
+//
+//	maxAge: The age of the entries to remove.
+//
+// Returns:
+//
+//	An error if the directory could not be read.
+func (c *Cache) Prune(maxAge time.Duration) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	files, err := os.ReadDir(c.Dir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		path := filepath.Join(c.Dir, strings.TrimSuffix(file.Name(), ".json"))
+
+		var entry cacheEntry
+		meta, err := os.ReadFile(path + ".json")
+		if err == nil && json.Unmarshal(meta, &entry) == nil && c.clock().Sub(entry.FetchedAt) <= maxAge {
+			continue
+		}
+		os.Remove(path + ".json")
+		os.Remove(path + ".body")
+	}
+	return nil
+}
+
+// Fetch the url through the cache.
+// Fresh entries are returned without a request, stale ones are revalidated with a conditional request.
+//
+// Parameters:
+//
+//	fetcher: The fetcher used for the requests.
+//	url: The url to fetch.
+//	header: Additional headers of the request, may be nil.
+//
+// Returns:
+//
+//	The response and an error, same as Fetcher.Fetch.
+func (c *Cache) fetch(fetcher *Fetcher, url string, header http.Header) (*Response, error) {
+	entry, body, ok := c.load(url)
+	if ok && c.clock().Sub(entry.FetchedAt) < c.TTL {
+		return &Response{StatusCode: http.StatusOK, Url: url, Header: entry.Header, Body: body}, nil
+	}
+
+	conditional := header.Clone()
+	if conditional == nil {
+		conditional = http.Header{}
+	}
+	if ok {
+		if entry.ETag != "" {
+			conditional.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			conditional.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	resp, err := fetcher.Fetch(url, conditional)
+	if err != nil {
+		return resp, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified {
+		if !ok {
+			return resp, &StatusError{StatusCode: resp.StatusCode, Url: url}
+		}
+		entry.FetchedAt = c.clock()
+		if err := c.store(entry, nil); err != nil {
+			return nil, err
+		}
+		return &Response{StatusCode: http.StatusOK, Url: url, Header: entry.Header, Body: body}, nil
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		entry = cacheEntry{
+			Url:          url,
+			Header:       resp.Header,
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			FetchedAt:    c.clock(),
+		}
+		if err := c.store(entry, resp.Body); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// Write the file by renaming a temporary one, so readers never see a partial file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,261 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Check if the node is an element matching the selector.
+func matchesNode(node *html.Node, selector Selector) bool {
+	if node.Type != html.ElementNode {
+		return false
+	}
+	return matchesSelector(html.Token{Type: html.StartTagToken, Data: node.Data, Attr: node.Attr}, selector)
+}
+
+// Find all the nodes matching the selector, not descending into the matched nodes.
+//
+// Parameters:
+//
+//	node: The root of the tree to search in.
+//	selector: The selector of the nodes.
+//
+// Returns:
+//
+//	The matching nodes in the document order.
+func findNodes(node *html.Node, selector Selector) []*html.Node {
+	nodes := make([]*html.Node, 0)
+	if selector.Tag == "" && selector.Attribute == "" {
+		return nodes
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if matchesNode(n, selector) {
+			nodes = append(nodes, n)
+			return
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(node)
+	return nodes
+}
+
+// Find the first node matching the selector.
+//
+// Returns:
+//
+//	The node, nil if there is no such node.
+func findNode(node *html.Node, selector Selector) *html.Node {
+	if nodes := findNodes(node, selector); len(nodes) > 0 {
+		return nodes[0]
+	}
+	return nil
+}
+
+// Get the trimmed text pieces of the node and its descendants.
+func nodeTexts(node *html.Node) []string {
+	texts := make([]string, 0)
+	if node == nil {
+		return texts
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			if text := strings.Join(strings.Fields(n.Data), " "); text != "" {
+				texts = append(texts, text)
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(node)
+	return texts
+}
+
+// Get the text of the page shown to the users, without the scripts and the styles.
+func visibleText(node *html.Node) string {
+	texts := make([]string, 0)
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && (n.Data == "script" || n.Data == "style" || n.Data == "noscript") {
+			return
+		}
+		if n.Type == html.TextNode {
+			if text := strings.Join(strings.Fields(n.Data), " "); text != "" {
+				texts = append(texts, text)
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(node)
+	return strings.Join(texts, " ")
+}
+
+// Check the page of an offer for being taken down.
+// The pages with the description of the offer are live, whatever their text. The other pages
+// are taken down if their visible text shows the notice matching the RemovedPattern of the config.
+//
+// Parameters:
+//
+//	url: The url of the offer.
+//	text: The HTML code of the page of the offer.
+//	config: The configuration of the source.
+//
+// Returns:
+//
+//	True if the page shows the notice, and an error if the HTML could not be parsed
+//	or the page shows neither the description nor the notice, e.g. after a change of the layout.
+func offerPageRemoved(url, text string, config ExtractorConfig) (bool, error) {
+	doc, err := html.Parse(strings.NewReader(text))
+	if err != nil {
+		return false, err
+	}
+
+	if findNode(doc, config.DescriptionSelector) != nil {
+		return false, nil
+	}
+	if config.RemovedPattern != nil && config.RemovedPattern.MatchString(visibleText(doc)) {
+		return true, nil
+	}
+	return false, fmt.Errorf("neither the offer nor a removal notice found on %s", url)
+}
+
+// Get the text of the node with the pieces separated by spaces.
+func nodeText(node *html.Node) string {
+	return strings.Join(nodeTexts(node), " ")
+}
+
+// Parse the search results page made of offer cards.
+// The cards are found with OfferSelector and their fields with the other search selectors,
+// the promoted cards matching PromotedSelector are skipped like on the other sources.
+//
+// Parameters:
+//
+//	text: The HTML code of the search results page.
+//	config: The configuration of the source.
+//
+// Returns:
+//
+//	The offers with an url and a title and an error if the HTML could not be parsed.
+func parseCards(text string, config ExtractorConfig) ([]Offer, error) {
+	doc, err := html.Parse(strings.NewReader(text))
+	if err != nil {
+		return nil, err
+	}
+
+	offers := make([]Offer, 0)
+	for _, card := range findNodes(doc, config.OfferSelector) {
+		if matchesNode(card, config.PromotedSelector) {
+			continue
+		}
+		offer := Offer{
+			Title:    nodeText(findNode(card, config.TitleSelector)),
+			Location: nodeText(findNode(card, config.LocationSelector)),
+		}
+		if link := findNode(card, config.URLSelector); link != nil {
+			if href := getAttr(link.Attr, "href"); href != "" {
+				offer.Url = normalizeURL(href, config.BaseURL)
+			}
+		}
+		// Price per square meter often follows the price
+		if texts := nodeTexts(findNode(card, config.PriceSelector)); len(texts) > 0 {
+			offer.Price = extractPrice(texts[0], config.PricePattern)
+		}
+
+		if offer.Url == "" || offer.Title == "" {
+			continue
+		}
+		offers = append(offers, offer)
+	}
+	return offers, nil
+}
+
+// Parse the offer page described by the detail selectors of the configuration.
+// Parameters are read as a label followed by a value, e.g. "Powierzchnia" and "45 m²".
+//
+// Parameters:
+//
+//	offer: The offer to parse.
+//	text: The HTML code of the offer page.
+//	config: The configuration of the source.
+//
+// Returns:
+//
+//	The parsed offer and an error if the HTML could not be parsed.
+func parseDetailPage(offer Offer, text string, config ExtractorConfig) (Offer, error) {
+	doc, err := html.Parse(strings.NewReader(text))
+	if err != nil {
+		return offer, err
+	}
+
+	if description := findNode(doc, config.DescriptionSelector); description != nil {
+		offer.Description = strings.Join(nodeTexts(description), "\n")
+	}
+
+	for _, parameter := range findNodes(doc, config.ParameterSelector) {
+		texts := nodeTexts(parameter)
+		if len(texts) == 0 {
+			continue
+		}
+		label, value := texts[0], strings.Join(texts[1:], " ")
+		if i := strings.Index(label, ":"); i >= 0 && value == "" {
+			label, value = label[:i], label[i+1:]
+		}
+		applyParameter(&offer, strings.TrimSuffix(strings.TrimSpace(label), ":"), strings.TrimSpace(value))
+	}
+
+	images := findNodes(doc, config.ImageSelector)
+	if len(images) > 0 {
+		offer.Images = make([]string, 0, len(images))
+	}
+	for _, image := range images {
+		src := getAttr(image.Attr, "data-src")
+		if src == "" {
+			src = getAttr(image.Attr, "src")
+		}
+		if src != "" {
+			offer.Images = append(offer.Images, normalizeURL(src, config.BaseURL))
+		}
+	}
+
+	normalizeOffer(&offer)
+	return offer, nil
+}
+
+// Set the field of the offer described by the parameter label.
+//
+// Parameters:
+//
+//	offer: The offer to update.
+//	label: The label of the parameter, e.g. "Liczba pokoi".
+//	value: The value of the parameter, e.g. "2".
+func applyParameter(offer *Offer, label, value string) {
+	text := label + ": " + value
+	switch lower := strings.ToLower(label); {
+	case strings.HasPrefix(lower, "powierzchnia"):
+		offer.Area = text
+	case strings.HasPrefix(lower, "liczba pokoi"), strings.HasPrefix(lower, "pokoje"):
+		offer.Rooms = text
+	case strings.HasPrefix(lower, "piętro"), strings.HasPrefix(lower, "poziom"):
+		offer.Floor = text
+	case strings.HasPrefix(lower, "czynsz"), strings.HasPrefix(lower, "opłaty"):
+		// Decimal part of the amount is dropped
+		amount := strings.NewReplacer(" ", "", " ", "").Replace(value)
+		if i := strings.IndexAny(amount, ",."); i >= 0 {
+			amount = amount[:i]
+		}
+		if rent, err := strconv.Atoi(integerPattern.FindString(amount)); err == nil {
+			offer.AdditionalPayment = rent
+		}
+	}
+}
@@ -16,3 +16,96 @@ var floorEncodings = map[string]string{
 	"floor_11": "Above Tenth",
 	"floor_17": "Attic",
 }
+
+// Query parameters which only track the visitor, dropped from the pasted search urls
+var trackingParams = map[string]bool{
+	"fbclid":        true,
+	"gclid":         true,
+	"gbraid":        true,
+	"wbraid":        true,
+	"msclkid":       true,
+	"mc_cid":        true,
+	"mc_eid":        true,
+	"_gl":           true,
+	"ref":           true,
+	"reason":        true,
+	"search_reason": true,
+}
+
+// Names of the OLX filters of the apartment features, enabled with the "yes" value
+const (
+	olxFurnishedFilter = "search[filter_enum_furniture]"
+	olxPetsFilter      = "search[filter_enum_pets]"
+	olxElevatorFilter  = "search[filter_enum_elevator]"
+)
+
+// Map of OLX floor codes to the Otodom floor filter values
+var otodomFloorFilters = map[string]string{
+	"floor_0":  "GROUND",
+	"floor_1":  "FIRST",
+	"floor_2":  "SECOND",
+	"floor_3":  "THIRD",
+	"floor_4":  "FOURTH",
+	"floor_5":  "FIFTH",
+	"floor_6":  "SIXTH",
+	"floor_7":  "SEVENTH",
+	"floor_8":  "EIGHTH",
+	"floor_9":  "NINTH",
+	"floor_10": "TENTH",
+	"floor_11": "ABOVE_TENTH",
+	"floor_17": "GARRET",
+}
+
+// Map of city codes to the location part of the Otodom search url
+var otodomLocations = map[string]string{
+	"bialystok": "podlaskie/bialystok/bialystok/bialystok",
+	"bydgoszcz": "kujawsko--pomorskie/bydgoszcz/bydgoszcz/bydgoszcz",
+	"gdansk":    "pomorskie/gdansk/gdansk/gdansk",
+	"gdynia":    "pomorskie/gdynia/gdynia/gdynia",
+	"katowice":  "slaskie/katowice/katowice/katowice",
+	"kielce":    "swietokrzyskie/kielce/kielce/kielce",
+	"krakow":    "malopolskie/krakow/krakow/krakow",
+	"lublin":    "lubelskie/lublin/lublin/lublin",
+	"lodz":      "lodzkie/lodz/lodz/lodz",
+	"poznan":    "wielkopolskie/poznan/poznan/poznan",
+	"radom":     "mazowieckie/radom/radom/radom",
+	"rzeszow":   "podkarpackie/rzeszow/rzeszow/rzeszow",
+	"szczecin":  "zachodniopomorskie/szczecin/szczecin/szczecin",
+	"wroclaw":   "dolnoslaskie/wroclaw/wroclaw/wroclaw",
+	"warszawa":  "mazowieckie/warszawa/warszawa/warszawa",
+}
+
+// Map of Otodom number encodings used for the number of rooms
+var otodomNumbers = map[string]string{
+	"ONE":              "1",
+	"TWO":              "2",
+	"THREE":            "3",
+	"FOUR":             "4",
+	"FIVE":             "5",
+	"SIX":              "6",
+	"SEVEN":            "7",
+	"EIGHT":            "8",
+	"NINE":             "9",
+	"TEN":              "10",
+	"MORE":             "10+",
+	"MORE_THAN_TEN":    "10+",
+	"MORE_THAN_TWENTY": "20+",
+}
+
+// Map of Otodom floor encodings
+var otodomFloors = map[string]string{
+	"CELLAR":      "suterena",
+	"GROUND":      "parter",
+	"FIRST":       "1",
+	"SECOND":      "2",
+	"THIRD":       "3",
+	"FOURTH":      "4",
+	"FIFTH":       "5",
+	"SIXTH":       "6",
+	"SEVENTH":     "7",
+	"EIGHTH":      "8",
+	"NINTH":       "9",
+	"TENTH":       "10",
+	"ABOVE_TENTH": "> 10",
+	"GARRET":      "poddasze",
+}
@@ -0,0 +1,137 @@
+package parser
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	// Embed the time zone database, so Europe/Warsaw is available on every system
+	_ "time/tzdata"
+)
+
+// Time zone of the offers, with daylight saving time.
+var Warsaw = loadWarsaw()
+
+// Map of Polish month names in the genitive case, as used in dates
+var polishMonths = map[string]time.Month{
+	"stycznia":     time.January,
+	"lutego":       time.February,
+	"marca":        time.March,
+	"kwietnia":     time.April,
+	"maja":         time.May,
+	"czerwca":      time.June,
+	"lipca":        time.July,
+	"sierpnia":     time.August,
+	"września":     time.September,
+	"października": time.October,
+	"listopada":    time.November,
+	"grudnia":      time.December,
+}
+
+func loadWarsaw() *time.Location {
+	location, err := time.LoadLocation("Europe/Warsaw")
+	if err != nil {
+		log.Printf("Error loading Europe/Warsaw time zone: %v", err)
+		return time.UTC
+	}
+	return location
+}
+
+// Get the current time using the clock of the configuration.
+func (config ExtractorConfig) now() time.Time {
+	if config.Now != nil {
+		return config.Now()
+	}
+	return time.Now()
+}
+
+// Parse the time the offer was posted or refreshed at.
+//
+// Supported formats:
+//   - "Dzisiaj o 14:30" - today, at the time rendered in config.SourceLocation
+//   - "Wczoraj o 14:30" - yesterday, at the time rendered in config.SourceLocation
+//   - "Odświeżono dnia 12 października 2026" or "12 października 2026" - the given day
+//
+// Parameters:
+//
+//	text: The text to parse.
+//	config: The configuration with the keywords, patterns and time zones to use.
+//
+// Returns:
+//
+//	The time in config.Location and false if the text could not be parsed.
+func parsePostedAt(text string, config ExtractorConfig) (time.Time, bool) {
+	sourceLocation := config.SourceLocation
+	if sourceLocation == nil {
+		sourceLocation = time.UTC
+	}
+	location := config.Location
+	if location == nil {
+		location = Warsaw
+	}
+
+	var day time.Time
+	now := config.now().In(sourceLocation)
+	switch {
+	case config.TodayKeyword != "" && strings.Contains(text, config.TodayKeyword):
+		day = now
+	case config.YesterdayKeyword != "" && strings.Contains(text, config.YesterdayKeyword):
+		day = now.AddDate(0, 0, -1)
+	default:
+		if config.DatePattern == nil {
+			return time.Time{}, false
+		}
+		// Full dates are given without time, so they are already local
+		return parsePolishDate(config.DatePattern.FindString(text), location)
+	}
+
+	hour, minute := 0, 0
+	if config.TimePattern != nil {
+		if match := config.TimePattern.FindString(text); match != "" {
+			if t, err := time.Parse("15:04", match); err == nil {
+				hour, minute = t.Hour(), t.Minute()
+			}
+		}
+	}
+
+	return time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, sourceLocation).In(location), true
+}
+
+// Parse a Polish date, e.g. "12 października 2026".
+//
+// Parameters:
+//
+//	text: The date to parse.
+//	location: The time zone of the date.
+//
+// Returns:
+//
+//	The midnight of the date and false if the text is not a valid date.
+func parsePolishDate(text string, location *time.Location) (time.Time, bool) {
+	fields := strings.Fields(strings.ToLower(text))
+	if len(fields) != 3 {
+		return time.Time{}, false
+	}
+
+	day, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return time.Time{}, false
+	}
+	month, ok := polishMonths[fields[1]]
+	if !ok {
+		return time.Time{}, false
+	}
+	year, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Date(year, month, day, 0, 0, 0, 0, location), true
+}
+
+// Check if both times are on the same day in the given time zone.
+func sameDay(a, b time.Time, location *time.Location) bool {
+	a, b = a.In(location), b.In(location)
+	return a.Year() == b.Year() && a.YearDay() == b.YearDay()
+}
@@ -0,0 +1,83 @@
+package parser
+
+import (
+	"net/url"
+	"regexp"
+)
+
+func init() {
+	RegisterSource(portalSource{
+		name:        "domiporta",
+		displayName: "Domiporta",
+		host:        "domiporta.pl",
+		order:       "SortType=DataDodaniaDesc",
+		pageParam:   "PageNumber",
+		params: searchParams{
+			PriceMin: "Cena.From",
+			PriceMax: "Cena.To",
+			AreaMin:  "Powierzchnia.From",
+			AreaMax:  "Powierzchnia.To",
+			RoomsMin: "LiczbaPokoi.From",
+			RoomsMax: "LiczbaPokoi.To",
+		},
+		// The search url contains the voivodeship of the city
+		cityUrl: func(city string) (string, error) {
+			region, err := voivodeship(city)
+			if err != nil {
+				return "", err
+			}
+			return "https://www.domiporta.pl/mieszkanie/wynajme/" + region + "/" + city, nil
+		},
+		city: func(u *url.URL) string {
+			return pathSegment(u, 3)
+		},
+		listingId: regexp.MustCompile(`/(\d+)(?:[?#]|$)`),
+	})
+	registerConfig("domiporta", DomiportaConfig)
+}
+
+// Default configuration for Domiporta
+var DomiportaConfig = ExtractorConfig{
+	OfferSelector: Selector{
+		Tag:       "article",
+		Attribute: "class",
+		Value:     "sneakpeak",
+	},
+	TitleSelector: Selector{
+		Tag:       "span",
+		Attribute: "class",
+		Value:     "sneakpeak__title--inner",
+	},
+	PriceSelector: Selector{
+		Tag:       "span",
+		Attribute: "class",
+		Value:     "sneakpeak__price_value",
+	},
+	LocationSelector: Selector{
+		Tag:       "p",
+		Attribute: "class",
+		Value:     "sneakpeak__details_item--address",
+	},
+	URLSelector: Selector{
+		Tag:       "a",
+		Attribute: "class",
+		Value:     "sneakpeak__pin",
+	},
+	DescriptionSelector: Selector{
+		Tag:       "div",
+		Attribute: "class",
+		Value:     "description__panel",
+	},
+	ParameterSelector: Selector{
+		Tag:       "li",
+		Attribute: "class",
+		Value:     "features__item",
+	},
+	ImageSelector: Selector{
+		Tag:       "img",
+		Attribute: "class",
+		Value:     "gallery__photo",
+	},
+	PricePattern: regexp.MustCompile(`\d+`),
+	BaseURL:      "https://www.domiporta.pl",
+}
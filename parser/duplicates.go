@@ -0,0 +1,372 @@
+package parser
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"log"
+	"math"
+	"math/bits"
+	"strings"
+	"unicode"
+
+	_ "golang.org/x/image/webp"
+)
+
+// Thresholds of the duplicate detection.
+//
+// Attributes:
+//
+//	MaxPriceDifference: The maximum relative difference of the prices, e.g. 0.05 for 5%.
+//	MaxAreaDifference: The maximum difference of the areas in square meters.
+//	MaxHashDistance: The maximum number of different bits of the hashes of the same image.
+//	MinMatchingImages: The minimum number of matching images, also more than a half of the images
+//	of the offer with fewer images must match.
+type DuplicateThresholds struct {
+	MaxPriceDifference float64
+	MaxAreaDifference  float64
+	MaxHashDistance    int
+	MinMatchingImages  int
+}
+
+// DuplicateDetector finds the offers of the same apartment,
+// e.g. posted on several sources or by several agencies.
+//
+// Offers are duplicates if none of their known address, area, rooms, floor and price differ
+// and either most of their images match or both addresses name the same street and the area, price
+// and the rooms or the floor are known. Addresses naming only the city and the district
+// cover too many apartments to match them without the images.
+//
+// Attributes:
+//
+//	Thresholds: The thresholds of the duplicate detection.
+type DuplicateDetector struct {
+	Thresholds DuplicateThresholds
+}
+
+// Duplicate detector used by the bot.
+var DefaultDuplicateDetector = &DuplicateDetector{
+	Thresholds: DuplicateThresholds{
+		MaxPriceDifference: 0.05,
+		MaxAreaDifference:  1.5,
+		MaxHashDistance:    10,
+		MinMatchingImages:  2,
+	},
+}
+
+// Words of the locations which do not tell the places apart
+var addressStopWords = map[string]bool{
+	"ul": true, "ulica": true, "al": true, "aleja": true, "aleje": true, "pl": true, "plac": true,
+	"os": true, "osiedle": true, "gmina": true, "powiat": true, "woj": true,
+	"dolnoslaskie": true, "kujawsko": true, "pomorskie": true, "lubelskie": true, "lubuskie": true,
+	"lodzkie": true, "malopolskie": true, "mazowieckie": true, "opolskie": true, "podkarpackie": true,
+	"podlaskie": true, "slaskie": true, "swietokrzyskie": true, "warminsko": true, "mazurskie": true,
+	"wielkopolskie": true, "zachodniopomorskie": true,
+}
+
+// Words of the locations introducing a street, a square or an estate
+var streetWords = map[string]bool{
+	"ul": true, "ulica": true, "al": true, "aleja": true, "aleje": true, "pl": true, "plac": true,
+	"os": true, "osiedle": true,
+}
+
+// Replacements of the Polish letters
+var polishLetters = strings.NewReplacer(
+	"ą", "a", "ć", "c", "ę", "e", "ł", "l", "ń", "n", "ó", "o", "ś", "s", "ź", "z", "ż", "z",
+)
+
+// Split the location into normalized words, e.g. "ul. Puławska, Mokotów" into "pulawska" and "mokotow".
+//
+// Parameters:
+//
+//	location: The location of the offer.
+//
+// Returns:
+//
+//	The set of the words, empty if the location is unknown.
+func addressWords(location string) map[string]bool {
+	words := make(map[string]bool)
+	for _, word := range locationWords(location) {
+		if !addressStopWords[word] {
+			words[word] = true
+		}
+	}
+	return words
+}
+
+// Split the location into lower case words without the Polish letters, in their order.
+func locationWords(location string) []string {
+	location = polishLetters.Replace(strings.ToLower(location))
+	return strings.FieldsFunc(location, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Check if the location names a street, e.g. "ul. Puławska, Mokotów", not only the city and the district.
+//
+// Parameters:
+//
+//	location: The location of the offer.
+//
+// Returns:
+//
+//	True if the location names a street, a square or an estate, false otherwise.
+func streetAddress(location string) bool {
+	words := locationWords(location)
+	for i, word := range words {
+		if streetWords[word] && i+1 < len(words) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check if the locations may describe the same place.
+// Sources describe the places with different detail, e.g. "Warszawa, Mokotów"
+// and "ul. Puławska, Mokotów, Warszawa", so one has to contain all the words of the other.
+//
+// Parameters:
+//
+//	a: The location of the first offer.
+//	b: The location of the second offer.
+//
+// Returns:
+//
+//	same: True if the locations are compatible, false if they differ or any of them is unknown.
+//	known: True if both locations are known, false if any of them is empty.
+func sameAddress(a, b string) (same bool, known bool) {
+	wordsA, wordsB := addressWords(a), addressWords(b)
+	if len(wordsA) == 0 || len(wordsB) == 0 {
+		return false, false
+	}
+	if len(wordsA) > len(wordsB) {
+		wordsA, wordsB = wordsB, wordsA
+	}
+	for word := range wordsA {
+		if !wordsB[word] {
+			return false, true
+		}
+	}
+	return true, true
+}
+
+// Check if the prices are within the relative difference.
+func closePrices(a, b int, maxDifference float64) bool {
+	if a <= 0 || b <= 0 {
+		return false
+	}
+	return math.Abs(float64(a-b)) <= maxDifference*math.Max(float64(a), float64(b))
+}
+
+// Check if most of the images of the offers match.
+// Offers of different apartments often share a single image, e.g. a photo of the building
+// or the logo of the agency, so a single matching image is not enough.
+func (d *DuplicateDetector) sameImages(a, b Offer) bool {
+	if len(a.ImageHashes) > len(b.ImageHashes) {
+		a, b = b, a
+	}
+
+	// Every image of the other offer matches at most one image
+	matched := make([]bool, len(b.ImageHashes))
+	matching := 0
+	for _, hashA := range a.ImageHashes {
+		for i, hashB := range b.ImageHashes {
+			if !matched[i] && HashDistance(hashA, hashB) <= d.Thresholds.MaxHashDistance {
+				matched[i] = true
+				matching++
+				break
+			}
+		}
+	}
+	return matching >= d.Thresholds.MinMatchingImages && 2*matching > len(a.ImageHashes)
+}
+
+// Check if the offers describe the same apartment.
+//
+// Parameters:
+//
+//	a: The first offer.
+//	b: The second offer.
+//
+// Returns:
+//
+//	True if the offers are duplicates, false otherwise.
+func (d *DuplicateDetector) IsDuplicate(a, b Offer) bool {
+	if a.SameListing(b) {
+		return true
+	}
+	normalizeOffer(&a)
+	normalizeOffer(&b)
+
+	// Any known difference tells the apartments apart
+	address, addressKnown := sameAddress(a.Location, b.Location)
+	if addressKnown && !address {
+		return false
+	}
+
+	areaKnown := a.AreaM2 > 0 && b.AreaM2 > 0
+	if areaKnown && math.Abs(a.AreaM2-b.AreaM2) > d.Thresholds.MaxAreaDifference {
+		return false
+	}
+
+	roomsKnown := a.RoomCount > 0 && b.RoomCount > 0
+	if roomsKnown && a.RoomCount != b.RoomCount {
+		return false
+	}
+
+	floorKnown := a.Floor != "" && b.Floor != ""
+	if floorKnown && a.FloorNumber != b.FloorNumber {
+		return false
+	}
+
+	// Some sources include the additional payment in the price
+	priceKnown := a.Price > 0 && b.Price > 0
+	if priceKnown && !closePrices(a.Price, b.Price, d.Thresholds.MaxPriceDifference) &&
+		!closePrices(a.Price+a.AdditionalPayment, b.Price+b.AdditionalPayment, d.Thresholds.MaxPriceDifference) {
+		return false
+	}
+
+	if d.sameImages(a, b) {
+		return true
+	}
+	// Apartments of the same district often have the same rooms, area and price
+	sameStreet := address && streetAddress(a.Location) && streetAddress(b.Location)
+	return sameStreet && areaKnown && priceKnown && (roomsKnown || floorKnown)
+}
+
+// Group the offers describing the same apartment.
+// Offers are in the same cluster if they are connected by a chain of duplicates.
+//
+// Parameters:
+//
+//	offers: The offers to group.
+//
+// Returns:
+//
+//	The clusters ordered by their first offer, offers keep their order within the clusters.
+func (d *DuplicateDetector) Cluster(offers []Offer) [][]Offer {
+	parents := make([]int, len(offers))
+	for i := range parents {
+		parents[i] = i
+	}
+	var root func(i int) int
+	root = func(i int) int {
+		if parents[i] != i {
+			parents[i] = root(parents[i])
+		}
+		return parents[i]
+	}
+
+	for i := range offers {
+		for j := i + 1; j < len(offers); j++ {
+			if root(i) != root(j) && d.IsDuplicate(offers[i], offers[j]) {
+				parents[root(j)] = root(i)
+			}
+		}
+	}
+
+	clusters := make([][]Offer, 0)
+	indexes := make(map[int]int)
+	for i, offer := range offers {
+		r := root(i)
+		index, ok := indexes[r]
+		if !ok {
+			index = len(clusters)
+			indexes[r] = index
+			clusters = append(clusters, nil)
+		}
+		clusters[index] = append(clusters[index], offer)
+	}
+	return clusters
+}
+
+// Compute the perceptual difference hash of the image.
+// Resized or recompressed copies of the image have hashes differing in a few bits.
+//
+// Parameters:
+//
+//	data: The encoded JPEG, PNG, GIF or WebP image.
+//
+// Returns:
+//
+//	The hash and an error if the image could not be decoded.
+func ImageHash(data []byte) (uint64, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+
+	// Average brightness of the cells of a 9x8 grid
+	const width, height = 9, 8
+	var cells [height][width]float64
+	bounds := img.Bounds()
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := bounds.Min.X + (x+1)*bounds.Dx()/width
+			y0 := bounds.Min.Y + y*bounds.Dy()/height
+			y1 := bounds.Min.Y + (y+1)*bounds.Dy()/height
+
+			var sum float64
+			var count int
+			for py := y0; py < max(y1, y0+1); py++ {
+				for px := x0; px < max(x1, x0+1); px++ {
+					r, g, b, _ := img.At(px, py).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+					count++
+				}
+			}
+			cells[y][x] = sum / float64(count)
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < height; y++ {
+		for x := 0; x < width-1; x++ {
+			hash <<= 1
+			if cells[y][x] < cells[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash, nil
+}
+
+// Get the number of different bits of the image hashes.
+func HashDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// Download the first images of the offer and compute their hashes.
+// Images which could not be downloaded or decoded are skipped.
+//
+// Parameters:
+//
+//	offer: The offer with the urls of the images.
+//	limit: The maximum number of images to hash.
+//
+// Returns:
+//
+//	The offer with ImageHashes set.
+func HashImages(offer Offer, limit int) Offer {
+	offer.ImageHashes = make([]uint64, 0, limit)
+	for _, image_url := range offer.Images {
+		if len(offer.ImageHashes) >= limit {
+			break
+		}
+		image, err := DownloadImage(image_url)
+		if err != nil {
+			log.Printf("Error downloading image: %v", err)
+			continue
+		}
+		hash, err := ImageHash(image)
+		if err != nil {
+			log.Printf("Error hashing image %s: %v", image_url, err)
+			continue
+		}
+		offer.ImageHashes = append(offer.ImageHashes, hash)
+	}
+	return offer
+}
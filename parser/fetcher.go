@@ -0,0 +1,342 @@
+package parser
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Error returned when the server responds with an unexpected status code.
+//
+// Attributes:
+//
+//	StatusCode: The status code of the response.
+//	Url: The requested url.
+type StatusError struct {
+	StatusCode int
+	Url        string
+}
+
+func (err *StatusError) Error() string {
+	return "Status code: " + strconv.Itoa(err.StatusCode) + " for " + err.Url
+}
+
+// Response of a fetched url with the decoded body.
+//
+// Attributes:
+//
+//	StatusCode: The status code of the response.
+//	Url: The url of the response after the redirects.
+//	Header: The headers of the response.
+//	Body: The decompressed body of the response.
+type Response struct {
+	StatusCode int
+	Url        string
+	Header     http.Header
+	Body       []byte
+}
+
+// Fetcher downloads pages and images shared by all the sources.
+// Failed requests are retried with an exponential backoff and the requests are
+// rate limited per host, so the portals are not flooded when many searches run.
+//
+// Attributes:
+//
+//	Client: The HTTP client used for the requests, its Timeout bounds every attempt.
+//	UserAgent: The User-Agent header sent with every request.
+//	MaxRetries: The number of retries after a failed attempt.
+//	BaseDelay: The delay before the first retry, doubled on every next retry.
+//	MaxDelay: The maximum delay between the retries, also bounding the delays asked by Retry-After.
+//	MaxBodySize: The maximum size of the decompressed body in bytes.
+//	Rate: The number of requests per second allowed for a single host.
+//	Burst: The number of requests to a single host allowed at once.
+//	Cache: The cache used by FetchCached, nil to always fetch.
+type Fetcher struct {
+	Client      *http.Client
+	UserAgent   string
+	MaxRetries  int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	MaxBodySize int64
+	Rate        float64
+	Burst       int
+	Cache       *Cache
+
+	mutex    sync.Mutex
+	limiters map[string]*tokenBucket
+	sleep    func(time.Duration)
+}
+
+// Fetcher used by FetchHTMLPage and DownloadImage.
+var DefaultFetcher = NewFetcher()
+
+// Create a new fetcher with the default configuration.
+//
+// Returns:
+//
+//	The fetcher, its attributes can be changed before the first request.
+func NewFetcher() *Fetcher {
+	return &Fetcher{
+		Client:      &http.Client{Timeout: 30 * time.Second},
+		UserAgent:   "Mozilla/5.0 (X11; Linux x86_64; rv:123.0) Gecko/20100101 Firefox/123.0",
+		MaxRetries:  4,
+		BaseDelay:   time.Second,
+		MaxDelay:    time.Minute,
+		MaxBodySize: 20 << 20,
+		Rate:        1,
+		Burst:       3,
+	}
+}
+
+// Fetch the given url, retrying on network errors, 429 and 5xx responses.
+//
+// Parameters:
+//
+//	url_string: The url to fetch.
+//	header: Additional headers of the request, may be nil.
+//
+// Returns:
+//
+//	The response with 2xx or 304 status code.
+//	A *StatusError if the server responded with another status code, the response is returned as well.
+func (f *Fetcher) Fetch(url_string string, header http.Header) (*Response, error) {
+	u, err := url.Parse(url_string)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		f.wait(u.Host)
+
+		resp, err := f.do(url_string, header)
+		retry := err != nil
+		if err == nil {
+			retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+			if !retry {
+				if resp.StatusCode >= 300 && resp.StatusCode != http.StatusNotModified {
+					return resp, &StatusError{StatusCode: resp.StatusCode, Url: url_string}
+				}
+				return resp, nil
+			}
+		}
+
+		if attempt >= f.MaxRetries {
+			if err != nil {
+				return nil, err
+			}
+			return resp, &StatusError{StatusCode: resp.StatusCode, Url: url_string}
+		}
+
+		delay := f.backoff(attempt)
+		if resp != nil {
+			// Servers asking for long delays must not stall the polling
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok && retryAfter > delay {
+				delay = min(retryAfter, f.MaxDelay)
+			}
+		}
+		f.doSleep(delay)
+	}
+}
+
+// Fetch the given url through the cache of the fetcher, same as Fetch if there is no cache.
+//
+// Parameters:
+//
+//	url_string: The url to fetch.
+//	header: Additional headers of the request, may be nil.
+//
+// Returns:
+//
+//	The response and an error, same as Fetch.
+func (f *Fetcher) FetchCached(url_string string, header http.Header) (*Response, error) {
+	if f.Cache == nil {
+		return f.Fetch(url_string, header)
+	}
+	return f.Cache.fetch(f, url_string, header)
+}
+
+// Send a single request and read the decompressed body.
+func (f *Fetcher) do(url_string string, header http.Header) (*Response, error) {
+	req, err := http.NewRequest("GET", url_string, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", f.UserAgent)
+	}
+	// Setting the header disables the transparent gzip support of the transport
+	req.Header.Set("Accept-Encoding", "gzip, br")
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var reader io.Reader = resp.Body
+	switch strings.ToLower(resp.Header.Get("Content-Encoding")) {
+	case "gzip":
+		gzipReader, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	case "br":
+		reader = brotli.NewReader(resp.Body)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(reader, f.MaxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > f.MaxBodySize {
+		return nil, fmt.Errorf("body of %s exceeds %d bytes", url_string, f.MaxBodySize)
+	}
+
+	return &Response{StatusCode: resp.StatusCode, Url: resp.Request.URL.String(), Header: resp.Header, Body: body}, nil
+}
+
+// Get the delay before the given retry, with a random jitter of up to a half of the delay.
+func (f *Fetcher) backoff(attempt int) time.Duration {
+	delay := f.BaseDelay << uint(attempt)
+	if delay > f.MaxDelay || delay <= 0 {
+		delay = f.MaxDelay
+	}
+	if delay <= 1 {
+		return delay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// Wait until a request to the host is allowed by its rate limit.
+func (f *Fetcher) wait(host string) {
+	if f.Rate <= 0 {
+		return
+	}
+
+	f.mutex.Lock()
+	if f.limiters == nil {
+		f.limiters = make(map[string]*tokenBucket)
+	}
+	limiter, ok := f.limiters[host]
+	if !ok {
+		limiter = newTokenBucket(f.Rate, f.Burst)
+		f.limiters[host] = limiter
+	}
+	f.mutex.Unlock()
+
+	if delay := limiter.reserve(time.Now()); delay > 0 {
+		f.doSleep(delay)
+	}
+}
+
+func (f *Fetcher) doSleep(delay time.Duration) {
+	if f.sleep != nil {
+		f.sleep(delay)
+		return
+	}
+	time.Sleep(delay)
+}
+
+// Token bucket limiting the rate of the requests to a single host.
+type tokenBucket struct {
+	mutex  sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// Take a token from the bucket.
+//
+// Parameters:
+//
+//	now: The current time.
+//
+// Returns:
+//
+//	The time to wait until the taken token becomes available.
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// Parse the Retry-After header given in seconds or as an HTTP date.
+//
+// Parameters:
+//
+//	value: The value of the header.
+//	now: The current time.
+//
+// Returns:
+//
+//	The delay requested by the server and false if the header is missing or invalid.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := date.Sub(now); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// Check if the error is a *StatusError with the given status code.
+//
+// Parameters:
+//
+//	err: The error returned by the fetcher.
+//	statusCode: The status code to check for.
+//
+// Returns:
+//
+//	True if the server responded with the status code, false otherwise.
+func IsStatus(err error, statusCode int) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == statusCode
+}
@@ -0,0 +1,83 @@
+package parser
+
+import (
+	"net/url"
+	"regexp"
+)
+
+func init() {
+	RegisterSource(portalSource{
+		name:        "gratka",
+		displayName: "Gratka",
+		host:        "gratka.pl",
+		order:       "sort=newest",
+		pageParam:   "page",
+		params: searchParams{
+			PriceMin: "cena-calkowita:min",
+			PriceMax: "cena-calkowita:max",
+			AreaMin:  "powierzchnia-w-m2:min",
+			AreaMax:  "powierzchnia-w-m2:max",
+			RoomsMin: "liczba-pokoi:min",
+			RoomsMax: "liczba-pokoi:max",
+		},
+		cityUrl: func(city string) (string, error) {
+			return "https://gratka.pl/nieruchomosci/mieszkania/" + city + "/wynajem", nil
+		},
+		city: func(u *url.URL) string {
+			return pathSegment(u, 2)
+		},
+		listingId: regexp.MustCompile(`/ob/(\d+)`),
+	})
+	registerConfig("gratka", GratkaConfig)
+}
+
+// Default configuration for Gratka
+var GratkaConfig = ExtractorConfig{
+	OfferSelector: Selector{
+		Tag:       "article",
+		Attribute: "class",
+		Value:     "teaserUnified",
+	},
+	PromotedSelector: Selector{
+		Tag:       "article",
+		Attribute: "class",
+		Value:     "teaserUnified--promoted",
+	},
+	TitleSelector: Selector{
+		Tag:       "h2",
+		Attribute: "class",
+		Value:     "teaserUnified__title",
+	},
+	PriceSelector: Selector{
+		Tag:       "p",
+		Attribute: "class",
+		Value:     "teaserUnified__price",
+	},
+	LocationSelector: Selector{
+		Tag:       "span",
+		Attribute: "class",
+		Value:     "teaserUnified__location",
+	},
+	URLSelector: Selector{
+		Tag:       "a",
+		Attribute: "class",
+		Value:     "teaserUnified__anchor",
+	},
+	DescriptionSelector: Selector{
+		Tag:       "div",
+		Attribute: "class",
+		Value:     "description__rolled",
+	},
+	ParameterSelector: Selector{
+		Tag:       "li",
+		Attribute: "class",
+		Value:     "parameters__item",
+	},
+	ImageSelector: Selector{
+		Tag:       "img",
+		Attribute: "class",
+		Value:     "gallery__image",
+	},
+	PricePattern: regexp.MustCompile(`\d+`),
+	BaseURL:      "https://gratka.pl",
+}
@@ -0,0 +1,257 @@
+package parser
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// Statistics of the parsed pages of a source, used to detect layout changes of the sites.
+//
+// Attributes:
+//
+//	Pages: The number of parsed search results pages.
+//	Offers: The number of offers found on the search results pages.
+//	MissingTitle: The number of offers without a title.
+//	MissingPrice: The number of offers without a price.
+//	MissingLocation: The number of offers without a location.
+//	Details: The number of parsed offer pages.
+//	EmptyDescription: The number of offer pages without a description.
+//	EmptyImages: The number of offer pages without images.
+type Health struct {
+	Pages            int
+	Offers           int
+	MissingTitle     int
+	MissingPrice     int
+	MissingLocation  int
+	Details          int
+	EmptyDescription int
+	EmptyImages      int
+}
+
+// Thresholds of the health statistics, crossing any of them raises an alert.
+//
+// Attributes:
+//
+//	Window: The number of pages of each kind the ratios are computed over.
+//	MinOffersPerPage: The minimum average number of offers on a search results page.
+//	MaxMissingRatio: The maximum fraction of offers without a title, price or location.
+//	MaxEmptyRatio: The maximum fraction of offer pages without a description or images.
+type HealthThresholds struct {
+	Window           int
+	MinOffersPerPage float64
+	MaxMissingRatio  float64
+	MaxEmptyRatio    float64
+}
+
+// HealthMonitor tracks the health of every source and raises alerts
+// when a source becomes unhealthy and when it recovers.
+//
+// Attributes:
+//
+//	Thresholds: The thresholds of the health statistics.
+//	Alert: Called with the name of the source and the message of the alert.
+type HealthMonitor struct {
+	Thresholds HealthThresholds
+	Alert      func(source, message string)
+
+	mutex     sync.Mutex
+	stats     map[string]*Health
+	unhealthy map[string]bool
+}
+
+// Health monitor used by ParseSearchPage and ParseOffer.
+var DefaultHealthMonitor = &HealthMonitor{
+	Thresholds: HealthThresholds{
+		Window:           20,
+		MinOffersPerPage: 1,
+		MaxMissingRatio:  0.5,
+		MaxEmptyRatio:    0.5,
+	},
+	Alert: func(source, message string) {
+		log.Printf("[ALERT] %s: %s", source, message)
+	},
+}
+
+// Get the statistics of the source in the current window, creating them if needed.
+func (m *HealthMonitor) health(source string) *Health {
+	if m.stats == nil {
+		m.stats = make(map[string]*Health)
+		m.unhealthy = make(map[string]bool)
+	}
+	health, ok := m.stats[source]
+	if !ok {
+		health = &Health{}
+		m.stats[source] = health
+	}
+	return health
+}
+
+// Record the offers parsed from a search results page of the source.
+//
+// Parameters:
+//
+//	source: The name of the source.
+//	offers: The offers found on the page.
+func (m *HealthMonitor) RecordSearchPage(source string, offers []Offer) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	health := m.health(source)
+	health.Pages++
+	for _, offer := range offers {
+		health.Offers++
+		if offer.Title == "" {
+			health.MissingTitle++
+		}
+		if offer.Price == 0 {
+			health.MissingPrice++
+		}
+		if offer.Location == "" {
+			health.MissingLocation++
+		}
+	}
+	m.check(source, health)
+}
+
+// Record the offer parsed from an offer page of the source.
+//
+// Parameters:
+//
+//	source: The name of the source.
+//	offer: The parsed offer.
+func (m *HealthMonitor) RecordOfferPage(source string, offer Offer) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	health := m.health(source)
+	health.Details++
+	if offer.Description == "" {
+		health.EmptyDescription++
+	}
+	if len(offer.Images) == 0 {
+		health.EmptyImages++
+	}
+	m.check(source, health)
+}
+
+// Get the statistics of the source in the current window.
+//
+// Parameters:
+//
+//	source: The name of the source.
+//
+// Returns:
+//
+//	A copy of the statistics.
+func (m *HealthMonitor) Health(source string) Health {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return *m.health(source)
+}
+
+// Check the thresholds once a window of pages or offer pages is full
+// and raise an alert if the state of the source changed.
+func (m *HealthMonitor) check(source string, health *Health) {
+	window := m.Thresholds.Window
+	if window <= 0 {
+		return
+	}
+
+	if health.Pages >= window {
+		m.report(source, "search results", health.searchProblems(m.Thresholds))
+		health.Pages, health.Offers = 0, 0
+		health.MissingTitle, health.MissingPrice, health.MissingLocation = 0, 0, 0
+	}
+	if health.Details >= window {
+		m.report(source, "offer pages", health.offerProblems(m.Thresholds))
+		health.Details, health.EmptyDescription, health.EmptyImages = 0, 0, 0
+	}
+}
+
+// Raise an alert when the kind of pages of the source becomes unhealthy or recovers.
+func (m *HealthMonitor) report(source, kind string, problems []string) {
+	key := source + "|" + kind
+	if len(problems) > 0 && !m.unhealthy[key] {
+		m.alert(source, "layout of the "+kind+" may have changed:\n"+strings.Join(problems, "\n"))
+	} else if len(problems) == 0 && m.unhealthy[key] {
+		m.alert(source, "parsing of the "+kind+" recovered")
+	}
+	m.unhealthy[key] = len(problems) > 0
+}
+
+func (m *HealthMonitor) alert(source, message string) {
+	if m.Alert != nil {
+		m.Alert(source, message)
+	}
+}
+
+// List the thresholds crossed by the statistics of the search results pages.
+//
+// Parameters:
+//
+//	thresholds: The thresholds to check.
+//
+// Returns:
+//
+//	The descriptions of the crossed thresholds, empty if the pages are healthy.
+func (health Health) searchProblems(thresholds HealthThresholds) []string {
+	problems := make([]string, 0)
+	if health.Pages == 0 {
+		return problems
+	}
+
+	if perPage := float64(health.Offers) / float64(health.Pages); perPage < thresholds.MinOffersPerPage {
+		problems = append(problems, fmt.Sprintf("%.1f offers per page on %d pages", perPage, health.Pages))
+	}
+	if health.Offers == 0 {
+		return problems
+	}
+
+	missing := []struct {
+		name  string
+		count int
+	}{
+		{"title", health.MissingTitle},
+		{"price", health.MissingPrice},
+		{"location", health.MissingLocation},
+	}
+	for _, m := range missing {
+		if ratio := float64(m.count) / float64(health.Offers); ratio > thresholds.MaxMissingRatio {
+			problems = append(problems, fmt.Sprintf("%.0f%% of %d offers without %s", ratio*100, health.Offers, m.name))
+		}
+	}
+	return problems
+}
+
+// List the thresholds crossed by the statistics of the offer pages.
+//
+// Parameters:
+//
+//	thresholds: The thresholds to check.
+//
+// Returns:
+//
+//	The descriptions of the crossed thresholds, empty if the pages are healthy.
+func (health Health) offerProblems(thresholds HealthThresholds) []string {
+	problems := make([]string, 0)
+	if health.Details == 0 {
+		return problems
+	}
+
+	empty := []struct {
+		name  string
+		count int
+	}{
+		{"description", health.EmptyDescription},
+		{"images", health.EmptyImages},
+	}
+	for _, e := range empty {
+		if ratio := float64(e.count) / float64(health.Details); ratio > thresholds.MaxEmptyRatio {
+			problems = append(problems, fmt.Sprintf("%.0f%% of %d offer pages without %s", ratio*100, health.Details, e.name))
+		}
+	}
+	return problems
+}
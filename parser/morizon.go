@@ -0,0 +1,78 @@
+package parser
+
+import (
+	"net/url"
+	"regexp"
+)
+
+func init() {
+	RegisterSource(portalSource{
+		name:        "morizon",
+		displayName: "Morizon",
+		host:        "morizon.pl",
+		order:       "ps[sort]=date_desc",
+		pageParam:   "page",
+		params: searchParams{
+			PriceMin: "ps[price_from]",
+			PriceMax: "ps[price_to]",
+			AreaMin:  "ps[living_area_from]",
+			AreaMax:  "ps[living_area_to]",
+			RoomsMin: "ps[number_of_rooms_from]",
+			RoomsMax: "ps[number_of_rooms_to]",
+		},
+		cityUrl: func(city string) (string, error) {
+			return "https://www.morizon.pl/do-wynajecia/mieszkania/" + city + "/", nil
+		},
+		city: func(u *url.URL) string {
+			return pathSegment(u, 2)
+		},
+		listingId: regexp.MustCompile(`-mzn(\d+)`),
+	})
+	registerConfig("morizon", MorizonConfig)
+}
+
+// Default configuration for Morizon
+var MorizonConfig = ExtractorConfig{
+	OfferSelector: Selector{
+		Tag:       "div",
+		Attribute: "data-cy",
+		Value:     "card",
+	},
+	TitleSelector: Selector{
+		Tag:       "h2",
+		Attribute: "data-cy",
+		Value:     "card-title",
+	},
+	PriceSelector: Selector{
+		Tag:       "div",
+		Attribute: "data-cy",
+		Value:     "card-price",
+	},
+	LocationSelector: Selector{
+		Tag:       "h3",
+		Attribute: "data-cy",
+		Value:     "card-location",
+	},
+	URLSelector: Selector{
+		Tag:       "a",
+		Attribute: "data-cy",
+		Value:     "card-link",
+	},
+	DescriptionSelector: Selector{
+		Tag:       "div",
+		Attribute: "data-cy",
+		Value:     "description",
+	},
+	ParameterSelector: Selector{
+		Tag:       "div",
+		Attribute: "data-cy",
+		Value:     "detail",
+	},
+	ImageSelector: Selector{
+		Tag:       "img",
+		Attribute: "data-cy",
+		Value:     "gallery-image",
+	},
+	PricePattern: regexp.MustCompile(`\d+`),
+	BaseURL:      "https://www.morizon.pl",
+}
@@ -0,0 +1,80 @@
+package parser
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+func init() {
+	RegisterSource(portalSource{
+		name:        "nieruchomosci-online",
+		displayName: "Nieruchomosci-online",
+		host:        "nieruchomosci-online.pl",
+		order:       "sort=data_dodania_desc",
+		pageParam:   "p",
+		params: searchParams{
+			PriceMin: "cena_od",
+			PriceMax: "cena_do",
+			AreaMin:  "powierzchnia_od",
+			AreaMax:  "powierzchnia_do",
+			RoomsMin: "pokoje_od",
+			RoomsMax: "pokoje_do",
+		},
+		// Every city has its own subdomain
+		cityUrl: func(city string) (string, error) {
+			return "https://" + city + ".nieruchomosci-online.pl/mieszkania,do-wynajecia/", nil
+		},
+		city: func(u *url.URL) string {
+			return strings.Split(u.Hostname(), ".")[0]
+		},
+		listingId: regexp.MustCompile(`/(\d+)\.html`),
+	})
+	registerConfig("nieruchomosci-online", NieruchomosciOnlineConfig)
+}
+
+// Default configuration for Nieruchomosci-online
+var NieruchomosciOnlineConfig = ExtractorConfig{
+	OfferSelector: Selector{
+		Tag:       "div",
+		Attribute: "class",
+		Value:     "tile-inner",
+	},
+	TitleSelector: Selector{
+		Tag:       "h2",
+		Attribute: "class",
+		Value:     "name",
+	},
+	PriceSelector: Selector{
+		Tag:       "p",
+		Attribute: "class",
+		Value:     "primary-display",
+	},
+	LocationSelector: Selector{
+		Tag:       "p",
+		Attribute: "class",
+		Value:     "province",
+	},
+	URLSelector: Selector{
+		Tag:       "a",
+		Attribute: "class",
+		Value:     "tile-link",
+	},
+	DescriptionSelector: Selector{
+		Tag:       "div",
+		Attribute: "id",
+		Value:     "description",
+	},
+	ParameterSelector: Selector{
+		Tag:       "li",
+		Attribute: "class",
+		Value:     "box__attributes--item",
+	},
+	ImageSelector: Selector{
+		Tag:       "img",
+		Attribute: "class",
+		Value:     "gallery-photo",
+	},
+	PricePattern: regexp.MustCompile(`\d+`),
+	BaseURL:      "https://www.nieruchomosci-online.pl",
+}
@@ -0,0 +1,141 @@
+package parser
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Floor numbers of the floors without a number, mirroring floorEncodings.
+const (
+	FloorBasement   = -1
+	FloorGround     = 0
+	FloorAboveTenth = 11
+	FloorAttic      = 17
+)
+
+// Regular expressions used to extract numbers from the parameter labels
+var (
+	integerPattern = regexp.MustCompile(`\d+`)
+	decimalPattern = regexp.MustCompile(`\d+(?:[.,]\d+)?`)
+)
+
+// Get the value of the parameter label, e.g. "2 pokoje" for "Liczba pokoi: 2 pokoje".
+func labelValue(text string) string {
+	if i := strings.Index(text, ":"); i >= 0 {
+		text = text[i+1:]
+	}
+	return strings.ToLower(strings.TrimSpace(text))
+}
+
+// Parse the number of rooms from the parameter label.
+//
+// Parameters:
+//
+//	text: The label, e.g. "Liczba pokoi: 2 pokoje", "Kawalerka" or "4 i więcej".
+//
+// Returns:
+//
+//	The number of rooms, 0 if it could not be parsed.
+func parseRoomCount(text string) int {
+	value := labelValue(text)
+	if strings.Contains(value, "kawalerka") {
+		return 1
+	}
+
+	rooms, err := strconv.Atoi(integerPattern.FindString(value))
+	if err != nil {
+		return 0
+	}
+	return rooms
+}
+
+// Parse the area in square meters from the parameter label.
+//
+// Parameters:
+//
+//	text: The label, e.g. "Powierzchnia: 38,50 m²".
+//
+// Returns:
+//
+//	The area in square meters, 0 if it could not be parsed.
+func parseArea(text string) float64 {
+	value := strings.ReplaceAll(labelValue(text), " ", "")
+	value = strings.ReplaceAll(value, " ", "")
+
+	area, err := strconv.ParseFloat(strings.ReplaceAll(decimalPattern.FindString(value), ",", "."), 64)
+	if err != nil {
+		return 0
+	}
+	return area
+}
+
+// Parse the floor and the number of floors in the building from the parameter label.
+//
+// Parameters:
+//
+//	text: The label, e.g. "Poziom: Parter", "Piętro: 2/4" or "Piętro: > 10".
+//
+// Returns:
+//
+//	The floor number, FloorGround, FloorBasement, FloorAttic or FloorAboveTenth for the named floors.
+//	The number of floors in the building, 0 if unknown.
+//	False if the floor could not be parsed.
+func parseFloor(text string) (int, int, bool) {
+	value := labelValue(text)
+
+	total := 0
+	if i := strings.Index(value, "/"); i >= 0 {
+		total, _ = strconv.Atoi(integerPattern.FindString(value[i+1:]))
+		value = strings.TrimSpace(value[:i])
+	}
+
+	switch {
+	case strings.Contains(value, "parter"):
+		return FloorGround, total, true
+	case strings.Contains(value, "suterena"):
+		return FloorBasement, total, true
+	case strings.Contains(value, "poddasze"):
+		return FloorAttic, total, true
+	case strings.Contains(value, "powyżej") || strings.Contains(value, ">"):
+		return FloorAboveTenth, total, true
+	}
+
+	floor, err := strconv.Atoi(integerPattern.FindString(value))
+	if err != nil {
+		return 0, total, false
+	}
+	return floor, total, true
+}
+
+// Fill the numeric rooms, area and floor fields of the offer from its labels.
+//
+// Parameters:
+//
+//	offer: The offer to update.
+func normalizeOffer(offer *Offer) {
+	if offer.Rooms != "" {
+		offer.RoomCount = parseRoomCount(offer.Rooms)
+	}
+	if offer.Area != "" {
+		offer.AreaM2 = parseArea(offer.Area)
+	}
+	if offer.Floor != "" {
+		if floor, total, ok := parseFloor(offer.Floor); ok {
+			offer.FloorNumber = floor
+			offer.TotalFloors = total
+		}
+	}
+}
+
+// Get the price per square meter of the offer, including the additional payment.
+//
+// Returns:
+//
+//	The price per square meter, 0 if the area is unknown.
+func (offer Offer) PricePerM2() float64 {
+	if offer.AreaM2 <= 0 {
+		return 0
+	}
+	return float64(offer.Price+offer.AdditionalPayment) / offer.AreaM2
+}
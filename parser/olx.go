@@ -0,0 +1,617 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+func init() {
+	RegisterSource(olxSource{})
+	registerConfig("olx", OLXConfig)
+}
+
+// Source of offers from https://www.olx.pl.
+type olxSource struct{}
+
+func (olxSource) Name() string {
+	return "olx"
+}
+
+func (olxSource) DisplayName() string {
+	return "OLX"
+}
+
+func (olxSource) Match(url string) bool {
+	return strings.HasPrefix(url, "https://www.olx.pl")
+}
+
+func (olxSource) ParseSearchPage(text string) ([]Offer, error) {
+	return ParseHtml(text), nil
+}
+
+func (olxSource) PageUrl(url string, page int) string {
+	return setPageParam(url, page)
+}
+
+// Id of the offer at the end of the OLX url, e.g. "16SdDt" in "...-CID3-ID16SdDt.html"
+var olxListingIdPattern = regexp.MustCompile(`-ID([0-9A-Za-z]+)\.html`)
+
+func (olxSource) ListingId(url string) string {
+	if match := olxListingIdPattern.FindStringSubmatch(url); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+func (olxSource) ParseOffer(offer Offer) Offer {
+	return parseOlxOffer(offer)
+}
+
+// Default configuration for OLX
+var OLXConfig = ExtractorConfig{
+	OfferSelector: Selector{
+		Tag:       "div",
+		Attribute: "class",
+		Value:     "css-1sw7q4x",
+	},
+	TitleSelector: Selector{
+		Tag:       "h4", // More stable than h6
+		Attribute: "",
+		Value:     "",
+	},
+	PriceSelector: Selector{
+		Tag:       "p",
+		Attribute: "data-testid",
+		Value:     "ad-price",
+	},
+	LocationSelector: Selector{
+		Tag:       "p",
+		Attribute: "data-testid",
+		Value:     "location-date",
+	},
+	URLSelector: Selector{
+		Tag:       "a",
+		Attribute: "href",
+		Value:     "",
+	},
+	DescriptionSelector: Selector{
+		Tag:       "div",
+		Attribute: "class",
+		Value:     "css-19duwlz",
+	},
+	ParameterSelector: Selector{
+		Tag:       "p",
+		Attribute: "class",
+		Value:     "css-5l1a1j",
+	},
+	ImageSelector: Selector{
+		Tag:       "img",
+		Attribute: "class",
+		Value:     "css-1bmvjcs",
+	},
+	DatePattern:      regexp.MustCompile(`\d{1,2}\s+\p{L}+\s+\d{4}`),
+	TimePattern:      regexp.MustCompile(`\d{2}:\d{2}`),
+	PricePattern:     regexp.MustCompile(`\d+`),
+	TodayKeyword:     "Dzisiaj",
+	YesterdayKeyword: "Wczoraj",
+	BaseURL:          "https://www.olx.pl",
+	SourceLocation:   time.UTC, // OLX renders the times of the offers in UTC
+	Location:         Warsaw,
+	TodayOnly:        true, // OLX lists old offers among the new ones, only the ones posted today are sent
+}
+
+// Parse the olx offer.
+//
+// Parameters:
+//
+//	offer: The offer to parse.
+//
+// Returns:
+//
+//	The parsed offer.
+func parseOlxOffer(offer Offer) Offer {
+	text, err := FetchHTMLPage(offer.Url)
+
+	if err != nil {
+		log.Printf("Error fetching the OLX page: %v", err)
+		return offer
+	}
+
+	// The embedded JSON does not depend on the CSS classes, the HTML is only a fallback
+	parsed, err := parseOlxPrerenderedState(offer, text)
+	if err == nil {
+		return parsed
+	}
+	log.Printf("Falling back to the OLX HTML parser: %v", err)
+
+	return parseOlxOfferHtml(offer, text)
+}
+
+// Parse the olx offer from the HTML code of the offer page.
+//
+// Parameters:
+//
+//	offer: The offer to parse.
+//	text: The HTML code of the offer page.
+//
+// Returns:
+//
+//	The parsed offer.
+func parseOlxOfferHtml(offer Offer, text string) Offer {
+	var err error
+	config := GetConfig("olx")
+	tkn := html.NewTokenizer(strings.NewReader(text))
+
+	var isDescription bool
+	var isTag bool
+
+	for {
+		tt := tkn.Next()
+		switch tt {
+		case html.ErrorToken:
+			// End of the document, we're done
+			normalizeOffer(&offer)
+			return offer
+
+		case html.StartTagToken:
+			t := tkn.Token()
+			if t.Data == config.DescriptionSelector.Tag {
+				isDescription = matchesSelector(t, config.DescriptionSelector)
+			}
+			if t.Data == config.ParameterSelector.Tag {
+				isTag = matchesSelector(t, config.ParameterSelector)
+			}
+
+		case html.TextToken:
+			if isDescription {
+				offer.Description += string(tkn.Text())
+			} else if isTag {
+				data := string(tkn.Text())
+				if strings.HasPrefix(data, "Czynsz") {
+					data = strings.ReplaceAll(data, " ", "")
+					data = regexp.MustCompile(`\d+`).FindString(data)
+					if data == "" {
+						offer.AdditionalPayment = 0
+					}
+					offer.AdditionalPayment, err = strconv.Atoi(data)
+					if err != nil {
+						offer.AdditionalPayment = 0
+					}
+				} else if strings.HasPrefix(data, "Liczba pokoi") {
+					offer.Rooms = data
+				} else if strings.HasPrefix(data, "Powierzchnia") {
+					offer.Area = data
+				} else if strings.HasPrefix(data, "Poziom") {
+					offer.Floor = data
+				}
+			}
+		case html.EndTagToken:
+			t := tkn.Token()
+			if t.Data == config.DescriptionSelector.Tag && isDescription {
+				isDescription = false
+			} else if t.Data == config.ParameterSelector.Tag && isTag {
+				isTag = false
+			}
+
+		case html.SelfClosingTagToken:
+			t := tkn.Token()
+			if matchesSelector(t, config.ImageSelector) {
+				offer.Images = append(offer.Images, getAttr(t.Attr, "src"))
+			}
+		}
+	}
+}
+
+// Parse the HTML code and extract all the offers.
+//
+// Parameters:
+//
+//	text: The HTML code to parse.
+//
+// Returns:
+//
+//	The offers extracted from the HTML code.
+func ParseHtml(text string) []Offer {
+	config := GetConfig("olx")
+	tokenizer := html.NewTokenizer(strings.NewReader(text))
+
+	offers := make([]Offer, 0)
+	isOffer := false
+	var offerContent string
+	offerTag := config.OfferSelector.Tag
+	depth := 0
+
+	for {
+		tokenType := tokenizer.Next()
+
+		switch tokenType {
+		case html.ErrorToken:
+			// End of the document, we're done
+			return offers
+
+		case html.StartTagToken:
+			token := tokenizer.Token()
+			if !isOffer {
+				isOffer = matchesSelector(token, config.OfferSelector)
+			} else {
+				if token.Data == offerTag {
+					depth++
+				}
+				offerContent += token.String()
+			}
+
+		case html.EndTagToken:
+			token := tokenizer.Token()
+			if isOffer && token.Data == offerTag && depth == 0 {
+				isOffer = false
+				offer := extractOfferWithConfig(offerContent, config)
+
+				// TODO: For some reason, the last div recognized as offer is empty
+				// Inspect this later
+				if offer.Title != "" {
+					offers = append(offers, offer)
+				}
+				offerContent = ""
+				depth = 0
+			} else if isOffer {
+				if token.Data == offerTag {
+					depth--
+				}
+				offerContent += token.String()
+			}
+
+		default:
+			if isOffer {
+				offerContent += tokenizer.Token().String()
+				continue
+			}
+		}
+	}
+}
+
+// Generate the URL of the OLX search results page for the given search term.
+func (olxSource) CreateUrl(searchTerm SearchTerm) (string, error) {
+	var builder strings.Builder
+	builder.WriteString("https://www.olx.pl/nieruchomosci/mieszkania/wynajem/")
+
+	// Check if the search term has a location.
+	if searchTerm.Location == "" {
+		return "", errors.New("No location specified in search term.")
+	}
+	builder.WriteString(searchTerm.Location)
+	builder.WriteString("/q-mieszkanie/?search[order]=created_at:desc")
+
+	if searchTerm.Price_min != 0 {
+		fmt.Fprintf(&builder, "&search[filter_float_price:from]=%g", searchTerm.Price_min)
+	}
+
+	if searchTerm.Price_max != 0 {
+		fmt.Fprintf(&builder, "&search[filter_float_price:to]=%g", searchTerm.Price_max)
+	}
+
+	if searchTerm.Size_min != 0 {
+		fmt.Fprintf(&builder, "&search[filter_float_m:from]=%g", searchTerm.Size_min)
+	}
+
+	if searchTerm.Size_max != 0 {
+		fmt.Fprintf(&builder, "&search[filter_float_m:to]=%g", searchTerm.Size_max)
+	}
+
+	if len(searchTerm.Bedrooms) > 0 {
+		values := make([]string, len(searchTerm.Bedrooms))
+		for i, bedroom := range searchTerm.Bedrooms {
+			values[i] = "search[filter_enum_rooms][" + strconv.Itoa(i) + "]=" + bedroom
+		}
+		builder.WriteString("&")
+		builder.WriteString(strings.Join(values, "&"))
+	}
+
+	if len(searchTerm.Floors) > 0 {
+		values := make([]string, len(searchTerm.Floors))
+		for i, floor := range searchTerm.Floors {
+			values[i] = "search[filter_enum_floor_select][" + strconv.Itoa(i) + "]=" + floor
+		}
+		builder.WriteString("&")
+		builder.WriteString(strings.Join(values, "&"))
+	}
+
+	features := []struct {
+		enabled bool
+		filter  string
+	}{
+		{searchTerm.Furnished, olxFurnishedFilter},
+		{searchTerm.Pets, olxPetsFilter},
+		{searchTerm.Elevator, olxElevatorFilter},
+	}
+	for _, feature := range features {
+		if feature.enabled {
+			builder.WriteString("&" + feature.filter + "[0]=yes")
+		}
+	}
+
+	return builder.String(), nil
+}
+
+func (olxSource) ParseUrl(url_string string) (SearchTerm, error) {
+	u, err := url.Parse(url_string)
+	if err != nil {
+		return SearchTerm{}, err
+	}
+
+	// Searches in the whole country have no city segment, e.g. "/nieruchomosci/mieszkania/wynajem/q-mieszkanie/"
+	searchTerm := SearchTerm{Location: pathSegment(u, 3)}
+	if strings.HasPrefix(searchTerm.Location, "q-") {
+		searchTerm.Location = ""
+	}
+
+	q := u.Query()
+	searchTerm.Price_min = queryNumber(q, "search[filter_float_price:from]")
+	searchTerm.Price_max = queryNumber(q, "search[filter_float_price:to]")
+	searchTerm.Size_min = queryNumber(q, "search[filter_float_m:from]")
+	searchTerm.Size_max = queryNumber(q, "search[filter_float_m:to]")
+	searchTerm.Bedrooms = olxEnumValues(q, "search[filter_enum_rooms]")
+	searchTerm.Floors = olxEnumValues(q, "search[filter_enum_floor_select]")
+	searchTerm.Furnished = q.Get(olxFurnishedFilter+"[0]") == "yes"
+	searchTerm.Pets = q.Get(olxPetsFilter+"[0]") == "yes"
+	searchTerm.Elevator = q.Get(olxElevatorFilter+"[0]") == "yes"
+
+	return searchTerm, nil
+}
+
+// Get the values of the indexed OLX filter, e.g. "search[filter_enum_rooms][0]", in the order of the indexes.
+func olxEnumValues(q url.Values, filter string) []string {
+	indexes := make([]int, 0)
+	values := make(map[int]string)
+	for key, value := range q {
+		if !strings.HasPrefix(key, filter+"[") || len(value) == 0 {
+			continue
+		}
+		index, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(key, filter+"["), "]"))
+		if err != nil {
+			continue
+		}
+		indexes = append(indexes, index)
+		values[index] = value[0]
+	}
+	if len(indexes) == 0 {
+		return nil
+	}
+
+	sort.Ints(indexes)
+	result := make([]string, len(indexes))
+	for i, index := range indexes {
+		result[i] = values[index]
+	}
+	return result
+}
+
+// Only the searches of the real estate category are supported, their results are parsed as apartments.
+func (olxSource) NormalizeUrl(url_string string) (string, error) {
+	u, err := url.Parse(url_string)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(u.Path, "/nieruchomosci/") || olxListingIdPattern.MatchString(u.Path) {
+		return "", errors.New("not an OLX real estate search url: " + url_string)
+	}
+	return normalizeQuery(url_string, []string{"search[order]=created_at:desc"}, "page"), nil
+}
+
+func (olxSource) Filters() []Filter {
+	return []Filter{FilterRooms, FilterArea, FilterFloors, FilterFurnished, FilterPets, FilterElevator}
+}
+
+func (source olxSource) SearchShortInfo(url_string string) (string, error) {
+	searchTerm, err := source.ParseUrl(url_string)
+	if err != nil {
+		return "", err
+	}
+	return searchShortInfo(searchTerm), nil
+}
+
+func (source olxSource) SearchFullInfo(url_string string) (string, error) {
+	searchTerm, err := source.ParseUrl(url_string)
+	if err != nil {
+		return "", err
+	}
+	return searchFullInfo(searchTerm, source.DisplayName(), url_string), nil
+}
+
+// Name of the variable holding the state of the OLX offer page
+const olxStateVariable = "window.__PRERENDERED_STATE__"
+
+// Size of the OLX images, the urls contain a size template
+const olxImageSize = "1000x700"
+
+// Part of the OLX page state describing the offer.
+type olxAd struct {
+	Id              int64  `json:"id"`
+	Title           string `json:"title"`
+	Description     string `json:"description"`
+	CreatedTime     string `json:"createdTime"`
+	LastRefreshTime string `json:"lastRefreshTime"`
+	IsBusiness      bool   `json:"isBusiness"`
+	Price           struct {
+		RegularPrice struct {
+			Value float64 `json:"value"`
+		} `json:"regularPrice"`
+	} `json:"price"`
+	Params []struct {
+		Key             string `json:"key"`
+		Name            string `json:"name"`
+		Value           string `json:"value"`
+		NormalizedValue string `json:"normalizedValue"`
+	} `json:"params"`
+	Location struct {
+		CityName     string `json:"cityName"`
+		DistrictName string `json:"districtName"`
+	} `json:"location"`
+	Map struct {
+		Lat float64 `json:"lat"`
+		Lon float64 `json:"lon"`
+	} `json:"map"`
+	Photos []string `json:"photos"`
+}
+
+// Parse the olx offer from the JSON state embedded in the offer page.
+//
+// Parameters:
+//
+//	offer: The offer to parse.
+//	text: The HTML code of the offer page.
+//
+// Returns:
+//
+//	The parsed offer and an error if the page has no valid state.
+func parseOlxPrerenderedState(offer Offer, text string) (Offer, error) {
+	state, err := extractOlxState(text)
+	if err != nil {
+		return offer, err
+	}
+
+	var data struct {
+		Ad struct {
+			Ad *olxAd `json:"ad"`
+		} `json:"ad"`
+	}
+	if err := json.Unmarshal([]byte(state), &data); err != nil {
+		return offer, err
+	}
+	ad := data.Ad.Ad
+	if ad == nil || ad.Id == 0 {
+		return offer, errors.New("olx page state does not contain the offer")
+	}
+
+	if offer.Title == "" {
+		offer.Title = ad.Title
+	}
+	if offer.Price == 0 {
+		offer.Price = int(ad.Price.RegularPrice.Value)
+	}
+	if offer.Location == "" {
+		offer.Location = ad.Location.CityName
+		if ad.Location.DistrictName != "" {
+			offer.Location += ", " + ad.Location.DistrictName
+		}
+	}
+	if offer.PostedAt.IsZero() {
+		for _, value := range []string{ad.LastRefreshTime, ad.CreatedTime} {
+			if postedAt, err := time.Parse(time.RFC3339, value); err == nil {
+				offer.PostedAt = postedAt.In(Warsaw)
+				break
+			}
+		}
+	}
+
+	offer.Description = htmlToText(ad.Description)
+	offer.Latitude = ad.Map.Lat
+	offer.Longitude = ad.Map.Lon
+	offer.IsBusiness = ad.IsBusiness
+
+	for _, param := range ad.Params {
+		label := param.Name + ": " + param.Value
+		switch param.Key {
+		case "rent":
+			rent := strings.ReplaceAll(param.NormalizedValue, " ", "")
+			if value, err := strconv.ParseFloat(rent, 64); err == nil {
+				offer.AdditionalPayment = int(value)
+			}
+		case "rooms":
+			offer.Rooms = label
+		case "m":
+			offer.Area = label
+		case "floor_select":
+			offer.Floor = label
+		}
+	}
+
+	offer.Images = make([]string, 0, len(ad.Photos))
+	for _, photo := range ad.Photos {
+		photo = strings.ReplaceAll(photo, "{width}x{height}", olxImageSize)
+		offer.Images = append(offer.Images, photo)
+	}
+
+	normalizeOffer(&offer)
+	return offer, nil
+}
+
+// Extract the JSON of the OLX page state from the HTML code.
+// The state is assigned either as a JSON encoded string or as an object literal.
+//
+// Parameters:
+//
+//	text: The HTML code of the offer page.
+//
+// Returns:
+//
+//	The JSON of the state and an error if the page has no state.
+func extractOlxState(text string) (string, error) {
+	i := strings.Index(text, olxStateVariable)
+	if i < 0 {
+		return "", errors.New("olx page does not contain " + olxStateVariable)
+	}
+	text = strings.TrimLeft(text[i+len(olxStateVariable):], " \t\r\n")
+	if !strings.HasPrefix(text, "=") {
+		return "", errors.New("olx page does not assign " + olxStateVariable)
+	}
+	text = strings.TrimLeft(text[1:], " \t\r\n")
+
+	// The decoder stops after the first value, ignoring the rest of the script
+	decoder := json.NewDecoder(strings.NewReader(text))
+	if strings.HasPrefix(text, "\"") {
+		var state string
+		if err := decoder.Decode(&state); err != nil {
+			return "", err
+		}
+		return state, nil
+	}
+
+	var state json.RawMessage
+	if err := decoder.Decode(&state); err != nil {
+		return "", err
+	}
+	return string(state), nil
+}
+
+// Convert the HTML description to plain text, keeping the line breaks.
+//
+// Parameters:
+//
+//	text: The HTML code of the description.
+//
+// Returns:
+//
+//	The text of the description.
+func htmlToText(text string) string {
+	tkn := html.NewTokenizer(strings.NewReader(text))
+	var builder strings.Builder
+
+	for {
+		switch tkn.Next() {
+		case html.ErrorToken:
+			return strings.TrimSpace(builder.String())
+		case html.TextToken:
+			builder.Write(tkn.Text())
+		case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+			name, _ := tkn.TagName()
+			switch string(name) {
+			case "br":
+				builder.WriteString("\n")
+			case "p", "div":
+				if builder.Len() > 0 && !strings.HasSuffix(builder.String(), "\n") {
+					builder.WriteString("\n")
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,494 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+func init() {
+	RegisterSource(otodomSource{})
+	registerConfig("otodom", OtodomConfig)
+}
+
+// Source of offers from https://www.otodom.pl.
+type otodomSource struct{}
+
+func (otodomSource) Name() string {
+	return "otodom"
+}
+
+func (otodomSource) DisplayName() string {
+	return "Otodom"
+}
+
+func (otodomSource) Match(url string) bool {
+	return strings.HasPrefix(url, "https://www.otodom.pl")
+}
+
+func (otodomSource) ParseSearchPage(text string) ([]Offer, error) {
+	return parseOtodomSearchPage(text)
+}
+
+func (otodomSource) PageUrl(url string, page int) string {
+	return setPageParam(url, page)
+}
+
+// Pattern of the id at the end of the Otodom offer urls, e.g. "mieszkanie-przy-parku-ID4bbbb"
+var otodomListingIdPattern = regexp.MustCompile(`/oferta/[^/?#]*-ID([0-9A-Za-z]+)(?:[/?#]|$)`)
+
+// The id is read from the url, so the offers linked from other sources have the same id as the ones found on Otodom.
+func (otodomSource) ListingId(url string) string {
+	if match := otodomListingIdPattern.FindStringSubmatch(url); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+func (otodomSource) ParseOffer(offer Offer) Offer {
+	return parseOtodomOffer(offer)
+}
+
+// Default configuration for Otodom, the search results are parsed from JSON
+var OtodomConfig = ExtractorConfig{
+	DescriptionSelector: Selector{
+		Tag:       "div",
+		Attribute: "data-cy",
+		Value:     "adPageAdDescription",
+	},
+	ParameterSelector: Selector{
+		Tag:       "p",
+		Attribute: "class",
+		Value:     "e1wd2yzk2 css-1airkmu",
+	},
+	ParameterLabelSelector: Selector{
+		Tag:       "p",
+		Attribute: "data-sentry-element",
+		Value:     "Item",
+	},
+	BaseURL: "https://www.otodom.pl",
+}
+
+// Generate the URL of the Otodom search results page for the given search term.
+func (otodomSource) CreateUrl(searchTerm SearchTerm) (string, error) {
+	if searchTerm.Location == "" {
+		return "", errors.New("No location specified in search term.")
+	}
+
+	location, ok := otodomLocations[searchTerm.Location]
+	if !ok {
+		return "", errors.New("unsupported otodom location: " + searchTerm.Location)
+	}
+
+	var builder strings.Builder
+	builder.WriteString("https://www.otodom.pl/pl/wyniki/wynajem/mieszkanie/")
+	builder.WriteString(location)
+	builder.WriteString("?by=LATEST&direction=DESC")
+
+	if searchTerm.Price_min != 0 {
+		fmt.Fprintf(&builder, "&priceMin=%g", searchTerm.Price_min)
+	}
+
+	if searchTerm.Price_max != 0 {
+		fmt.Fprintf(&builder, "&priceMax=%g", searchTerm.Price_max)
+	}
+
+	if searchTerm.Size_min != 0 {
+		fmt.Fprintf(&builder, "&areaMin=%g", searchTerm.Size_min)
+	}
+
+	if searchTerm.Size_max != 0 {
+		fmt.Fprintf(&builder, "&areaMax=%g", searchTerm.Size_max)
+	}
+
+	if len(searchTerm.Bedrooms) > 0 {
+		values := make([]string, len(searchTerm.Bedrooms))
+		for i, bedroom := range searchTerm.Bedrooms {
+			// OLX room codes ("one", "two", ...) match the Otodom ones
+			values[i] = strings.ToUpper(bedroom)
+		}
+		builder.WriteString("&roomsNumber=%5B" + strings.Join(values, "%2C") + "%5D")
+	}
+
+	if len(searchTerm.Floors) > 0 {
+		values := make([]string, 0, len(searchTerm.Floors))
+		for _, floor := range searchTerm.Floors {
+			if value, ok := otodomFloorFilters[floor]; ok {
+				values = append(values, value)
+			}
+		}
+		if len(values) > 0 {
+			builder.WriteString("&floors=%5B" + strings.Join(values, "%2C") + "%5D")
+		}
+	}
+
+	if searchTerm.Furnished {
+		builder.WriteString("&equipmentTypes=%5BFURNITURE%5D")
+	}
+
+	if searchTerm.Elevator {
+		builder.WriteString("&extras=%5BLIFT%5D")
+	}
+
+	return builder.String(), nil
+}
+
+func (otodomSource) ParseUrl(url_string string) (SearchTerm, error) {
+	u, err := url.Parse(url_string)
+	if err != nil {
+		return SearchTerm{}, err
+	}
+
+	searchTerm := SearchTerm{Location: otodomCity(u)}
+
+	q := u.Query()
+	searchTerm.Price_min = queryNumber(q, "priceMin")
+	searchTerm.Price_max = queryNumber(q, "priceMax")
+	searchTerm.Size_min = queryNumber(q, "areaMin")
+	searchTerm.Size_max = queryNumber(q, "areaMax")
+
+	for _, room := range otodomList(q.Get("roomsNumber")) {
+		searchTerm.Bedrooms = append(searchTerm.Bedrooms, strings.ToLower(room))
+	}
+	for _, floor := range otodomList(q.Get("floors")) {
+		for code, value := range otodomFloorFilters {
+			if value == floor {
+				searchTerm.Floors = append(searchTerm.Floors, code)
+			}
+		}
+	}
+
+	for _, equipment := range otodomList(q.Get("equipmentTypes")) {
+		searchTerm.Furnished = searchTerm.Furnished || equipment == "FURNITURE"
+	}
+	for _, extra := range otodomList(q.Get("extras")) {
+		searchTerm.Elevator = searchTerm.Elevator || extra == "LIFT"
+	}
+
+	return searchTerm, nil
+}
+
+// Split the Otodom list query value, e.g. "[TWO,THREE]".
+func otodomList(value string) []string {
+	value = strings.Trim(value, "[]")
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// Get the city code from the path of the Otodom search url.
+// The location path is made of the voivodeship, the county, the commune and the city,
+// e.g. "wielkopolskie/poznan/poznan/poznan", optionally followed by the district.
+//
+// Returns:
+//
+//	The city code, empty if the url searches a whole voivodeship or country.
+func otodomCity(u *url.URL) string {
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i, part := range parts {
+		if part == "mieszkanie" && i+4 < len(parts) {
+			return parts[i+4]
+		}
+	}
+	return ""
+}
+
+func (otodomSource) NormalizeUrl(url_string string) (string, error) {
+	u, err := url.Parse(url_string)
+	if err != nil {
+		return "", err
+	}
+	if !strings.Contains(u.Path, "/wyniki/") {
+		return "", errors.New("not an Otodom search url: " + url_string)
+	}
+	return normalizeQuery(url_string, []string{"by=LATEST", "direction=DESC"}, "page"), nil
+}
+
+// Otodom does not filter the offers allowing pets.
+func (otodomSource) Filters() []Filter {
+	return []Filter{FilterRooms, FilterArea, FilterFloors, FilterFurnished, FilterElevator}
+}
+
+func (source otodomSource) SearchShortInfo(url_string string) (string, error) {
+	searchTerm, err := source.ParseUrl(url_string)
+	if err != nil {
+		return "", err
+	}
+	return searchShortInfo(searchTerm), nil
+}
+
+func (source otodomSource) SearchFullInfo(url_string string) (string, error) {
+	searchTerm, err := source.ParseUrl(url_string)
+	if err != nil {
+		return "", err
+	}
+	return searchFullInfo(searchTerm, "Otodom", url_string), nil
+}
+
+// Part of the Otodom search results JSON describing a single offer.
+type otodomSearchItem struct {
+	Slug       string `json:"slug"`
+	Title      string `json:"title"`
+	IsPromoted bool   `json:"isPromoted"`
+	Location   struct {
+		Address struct {
+			Street struct {
+				Name   string `json:"name"`
+				Number string `json:"number"`
+			} `json:"street"`
+			City struct {
+				Name string `json:"name"`
+			} `json:"city"`
+		} `json:"address"`
+		ReverseGeocoding struct {
+			Locations []struct {
+				LocationLevel string `json:"locationLevel"`
+				Name          string `json:"name"`
+			} `json:"locations"`
+		} `json:"reverseGeocoding"`
+	} `json:"location"`
+	Images []struct {
+		Medium string `json:"medium"`
+		Large  string `json:"large"`
+	} `json:"images"`
+	TotalPrice struct {
+		Value float64 `json:"value"`
+	} `json:"totalPrice"`
+	RentPrice struct {
+		Value float64 `json:"value"`
+	} `json:"rentPrice"`
+	AreaInSquareMeters float64 `json:"areaInSquareMeters"`
+	RoomsNumber        string  `json:"roomsNumber"`
+	FloorNumber        string  `json:"floorNumber"`
+	DateCreated        string  `json:"dateCreated"`
+}
+
+// Parse the Otodom search results page.
+// Offers are read from the JSON embedded in the __NEXT_DATA__ script.
+//
+// Parameters:
+//
+//	text: The HTML code of the search results page.
+//
+// Returns:
+//
+//	The non-promoted offers from the page and an error if the JSON could not be decoded.
+func parseOtodomSearchPage(text string) ([]Offer, error) {
+	jsonText := extractScript(text, "__NEXT_DATA__")
+	if jsonText == "" {
+		return nil, errors.New("otodom search page does not contain __NEXT_DATA__")
+	}
+
+	var data struct {
+		Props struct {
+			PageProps struct {
+				Data struct {
+					SearchAds struct {
+						Items []otodomSearchItem `json:"items"`
+					} `json:"searchAds"`
+				} `json:"data"`
+			} `json:"pageProps"`
+		} `json:"props"`
+	}
+	if err := json.Unmarshal([]byte(jsonText), &data); err != nil {
+		return nil, err
+	}
+
+	offers := make([]Offer, 0)
+	for _, item := range data.Props.PageProps.Data.SearchAds.Items {
+		if item.IsPromoted || item.Slug == "" {
+			continue
+		}
+		offers = append(offers, otodomItemToOffer(item))
+	}
+	return offers, nil
+}
+
+// Convert the offer from the Otodom search results JSON.
+func otodomItemToOffer(item otodomSearchItem) Offer {
+	offer := Offer{
+		Title:             item.Title,
+		Price:             int(item.TotalPrice.Value),
+		Url:               "https://www.otodom.pl/pl/oferta/" + item.Slug,
+		AdditionalPayment: int(item.RentPrice.Value),
+	}
+	offer.ListingId = otodomSource{}.ListingId(offer.Url)
+
+	location := []string{item.Location.Address.City.Name}
+	for _, l := range item.Location.ReverseGeocoding.Locations {
+		if l.LocationLevel == "district" && l.Name != item.Location.Address.City.Name {
+			location = append(location, l.Name)
+		}
+	}
+	if street := strings.TrimSpace(item.Location.Address.Street.Name + " " + item.Location.Address.Street.Number); street != "" {
+		location = append(location, street)
+	}
+	offer.Location = strings.Join(location, ", ")
+
+	if item.AreaInSquareMeters != 0 {
+		offer.Area = "Powierzchnia: " + strconv.FormatFloat(item.AreaInSquareMeters, 'f', -1, 64) + " m²"
+	}
+	if rooms, ok := otodomNumbers[item.RoomsNumber]; ok {
+		offer.Rooms = "Liczba pokoi: " + rooms
+	}
+	if floor, ok := otodomFloors[item.FloorNumber]; ok {
+		offer.Floor = "Piętro: " + floor
+	}
+	normalizeOffer(&offer)
+
+	// Otodom renders the creation date in the local Polish time
+	if created, err := time.ParseInLocation("2006-01-02 15:04:05", item.DateCreated, Warsaw); err == nil {
+		offer.PostedAt = created
+	}
+
+	for _, image := range item.Images {
+		offer.Images = append(offer.Images, image.Large)
+	}
+
+	return offer
+}
+
+// Parse the otodom offer.
+//
+// Parameters:
+//
+//	offer: The offer to parse.
+//
+// Returns:
+//
+//	The parsed offer.
+func parseOtodomOffer(offer Offer) Offer {
+	text, err := FetchHTMLPage(offer.Url)
+	if err != nil {
+		log.Printf("Error fetching the Otodom page: %v", err)
+		return offer
+	}
+
+	config := GetConfig("otodom")
+	tkn := html.NewTokenizer(strings.NewReader(text))
+
+	var (
+		isDescription, isJson bool
+		currentTag            string
+		isTagLabel            bool
+		isTagValue            bool
+		jsonText              string
+	)
+
+	for {
+		tt := tkn.Next()
+		switch tt {
+		case html.ErrorToken:
+			// End of the document
+			normalizeOffer(&offer)
+			return offer
+
+		case html.StartTagToken:
+			t := tkn.Token()
+
+			if matchesSelector(t, config.ParameterSelector) {
+				if matchesSelector(t, config.ParameterLabelSelector) {
+					isTagLabel = true
+				} else {
+					isTagValue = true
+				}
+			}
+
+			isDescription = matchesSelector(t, config.DescriptionSelector)
+			isJson = (t.Data == "script") && checkAttr(t.Attr, "type", "application/json")
+
+		case html.TextToken:
+			text := strings.TrimSpace(string(tkn.Text()))
+
+			if isTagLabel {
+				currentTag = strings.TrimSuffix(text, ":")
+				isTagLabel = false
+			} else if isTagValue && currentTag != "" {
+				switch currentTag {
+				case "Powierzchnia":
+					offer.Area = currentTag + ": " + text
+				case "Liczba pokoi":
+					offer.Rooms = currentTag + ": " + text
+				case "Piętro":
+					offer.Floor = currentTag + ": " + text
+				case "Czynsz":
+					val := strings.ReplaceAll(text, " ", "")
+					val = regexp.MustCompile(`\d+`).FindString(val)
+					if v, err := strconv.Atoi(val); err == nil {
+						offer.AdditionalPayment = v
+					}
+				}
+				currentTag = ""
+				isTagValue = false
+			}
+
+			if isDescription {
+				offer.Description += text + "\n"
+			}
+
+			if isJson {
+				jsonText += text
+			}
+
+		case html.EndTagToken:
+			t := tkn.Token()
+
+			if t.Data == "script" && isJson {
+				isJson = false
+				offer.Images, err = parseOtodomImages(jsonText)
+				if err != nil {
+					log.Println(err)
+				}
+			} else if t.Data == config.DescriptionSelector.Tag && isDescription {
+				isDescription = false
+				if len(offer.Description) > 0 {
+					offer.Description = strings.TrimSuffix(offer.Description, "\n")
+				}
+			}
+
+		}
+	}
+}
+
+// Parse the images of the Otodom offer page from the JSON embedded in the __NEXT_DATA__ script.
+//
+// Parameters:
+//
+//	json_string: The JSON of the offer page.
+//
+// Returns:
+//
+//	The urls of the large images and an error if the JSON could not be decoded.
+func parseOtodomImages(json_string string) ([]string, error) {
+	var data struct {
+		Props struct {
+			PageProps struct {
+				Ad struct {
+					Images []struct {
+						Large string `json:"large"`
+					} `json:"images"`
+				} `json:"ad"`
+			} `json:"pageProps"`
+		} `json:"props"`
+	}
+	if err := json.Unmarshal([]byte(json_string), &data); err != nil {
+		return nil, err
+	}
+
+	// The ad is stored under "props" -> "pageProps" -> "ad"
+	ad := data.Props.PageProps.Ad
+	var images []string
+	for _, image := range ad.Images {
+		images = append(images, image.Large)
+	}
+	return images, nil
+}
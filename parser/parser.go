@@ -20,79 +20,85 @@ import (
 //	Title: The title of the offer.
 //	Price: The price of the offer.
 //	Location: The location of the offer.
-//	Time: The time offer was posted or updated.
+//	PostedAt: The time offer was posted or refreshed at, zero if unknown.
 //	Url: The url of the offer.
+//	ListingId: The id of the offer on its source, empty if unknown.
 //	AdditionalPayment: The additional payment for the offer.
 //	Description: The description of the offer.
-//	Rooms: The number of rooms of the offer.
-//	Area: The area of the offer.
-//	Floor: The floor of the offer.
+//	Rooms: The number of rooms of the offer as shown on the website.
+//	Area: The area of the offer as shown on the website.
+//	Floor: The floor of the offer as shown on the website.
+//	RoomCount: The number of rooms, 0 if unknown.
+//	AreaM2: The area in square meters, 0 if unknown.
+//	FloorNumber: The floor number, only valid if Floor is not empty.
+//	TotalFloors: The number of floors in the building, 0 if unknown.
+//	Images: The urls of the images of the offer.
+//	Source: The name of the source the offer belongs to.
+//	Latitude: The latitude of the offer, 0 if unknown.
+//	Longitude: The longitude of the offer, 0 if unknown.
+//	IsBusiness: True if the offer is posted by an agency or a company.
+//	ImageHashes: The perceptual hashes of the images, see HashImages.
 type Offer struct {
 	Title             string
 	Price             int
 	Location          string
-	Time              string
+	PostedAt          time.Time
 	Url               string
+	ListingId         string
 	AdditionalPayment int
 	Description       string
 	Rooms             string
 	Area              string
 	Floor             string
+	RoomCount         int
+	AreaM2            float64
+	FloorNumber       int
+	TotalFloors       int
 	Images            []string
+	Source            string
+	Latitude          float64
+	Longitude         float64
+	IsBusiness        bool
+	ImageHashes       []uint64
 }
 
 // ExtractorConfig holds configuration for the offer extractor
 type ExtractorConfig struct {
-	// Selectors for finding elements
-	TitleSelector      Selector
-	PriceSelector      Selector
-	LocationSelector   Selector
-	URLSelector        Selector
+	// Selectors for finding elements of the search results
+	OfferSelector    Selector
+	PromotedSelector Selector // Matches the promoted offers, which are skipped
+	TitleSelector    Selector
+	PriceSelector    Selector
+	LocationSelector Selector
+	URLSelector      Selector
+
+	// Selectors for finding elements of the offer page
+	DescriptionSelector    Selector
+	ParameterSelector      Selector
+	ParameterLabelSelector Selector
+	ImageSelector          Selector
 
 	// Parsing configuration
-	DatePattern        *regexp.Regexp
-	TimePattern        *regexp.Regexp
-	PricePattern       *regexp.Regexp
-	TodayKeyword       string
-	BaseURL            string
-	TimezoneOffset     time.Duration
+	DatePattern      *regexp.Regexp
+	TimePattern      *regexp.Regexp
+	PricePattern     *regexp.Regexp
+	TodayKeyword     string
+	YesterdayKeyword string
+	BaseURL          string
+	RemovedPattern   *regexp.Regexp // Matches the pages of taken down offers, DefaultRemovedPattern if nil
+
+	// Time configuration
+	SourceLocation *time.Location   // Time zone the times are rendered in, UTC if nil
+	Location       *time.Location   // Time zone of the offer timestamps, Warsaw if nil
+	Now            func() time.Time // Clock used for relative dates, time.Now if nil
+	TodayOnly      bool             // Skip the offers not posted today
 }
 
 // Selector represents how to find an element
 type Selector struct {
-	Tag       string
-	Attribute string
-	Value     string
-}
-
-// Default configuration for OLX
-var OLXConfig = ExtractorConfig{
-	TitleSelector: Selector{
-		Tag:       "h4",  // More stable than h6
-		Attribute: "",
-		Value:     "",
-	},
-	PriceSelector: Selector{
-		Tag:       "p",
-		Attribute: "data-testid",
-		Value:     "ad-price",
-	},
-	LocationSelector: Selector{
-		Tag:       "p",
-		Attribute: "data-testid",
-		Value:     "location-date",
-	},
-	URLSelector: Selector{
-		Tag:       "a",
-		Attribute: "href",
-		Value:     "",
-	},
-	DatePattern:    regexp.MustCompile(`\d{1,2}\s+\w+\s+\d{4}`),
-	TimePattern:    regexp.MustCompile(`\d{2}:\d{2}`),
-	PricePattern:   regexp.MustCompile(`\d+`),
-	TodayKeyword:   "Dzisiaj",
-	BaseURL:        "https://www.olx.pl",
-	TimezoneOffset: 2 * time.Hour, // Poland is UTC+2
+	Tag       string `json:"tag"`
+	Attribute string `json:"attribute"`
+	Value     string `json:"value"`
 }
 
 // Check if the given attribute is present in the given list of attributes.
@@ -134,204 +140,41 @@ func getAttr(attrs []html.Attribute, key string) string {
 	return ""
 }
 
-// Parse the given offer by following the url and extracting the missing data.
-//
-// Parameters:
-//
-//	offer: The offer to parse.
-//
-// Returns:
-//
-//	The parsed offer.
-func ParseOffer(offer Offer) Offer {
-	// If url starts with www.olx.pl
-	if strings.HasPrefix(offer.Url, "https://www.olx.pl") {
-		offer = parseOlxOffer(offer)
-	} else if strings.HasPrefix(offer.Url, "https://www.otodom.pl") {
-		offer = parseOtodomOffer(offer)
-	}
-	return offer
-}
-
-// Parse the olx offer.
+// Extract the text of the script with the given id.
 //
 // Parameters:
 //
-//	offer: The offer to parse.
+//	text: The HTML code to search in.
+//	id: The id attribute of the script.
 //
 // Returns:
 //
-//	The parsed offer.
-func parseOlxOffer(offer Offer) Offer {
-	text, err := FetchHTMLPage(offer.Url)
-
-	if err != nil {
-		log.Printf("Error fetching the OLX page: %v", err)
-		return offer
-	}
-
+//	The content of the script, empty if there is no such script.
+func extractScript(text, id string) string {
 	tkn := html.NewTokenizer(strings.NewReader(text))
 
-	var isDescription bool
-	var isTag bool
+	var isScript bool
+	var content string
 
 	for {
 		tt := tkn.Next()
 		switch tt {
 		case html.ErrorToken:
-			// End of the document, we're done
-			return offer
+			return content
 
 		case html.StartTagToken:
 			t := tkn.Token()
-			switch t.Data {
-			case "div":
-				isDescription = checkAttr(t.Attr, "class", "css-19duwlz")
-			case "p":
-				isTag = checkAttr(t.Attr, "class", "css-5l1a1j")
-			}
+			isScript = t.Data == "script" && checkAttr(t.Attr, "id", id)
 
 		case html.TextToken:
-			if isDescription {
-				offer.Description += string(tkn.Text())
-			} else if isTag {
-				data := string(tkn.Text())
-				if strings.HasPrefix(data, "Czynsz") {
-					data = strings.ReplaceAll(data, " ", "")
-					data = regexp.MustCompile(`\d+`).FindString(data)
-					if data == "" {
-						offer.AdditionalPayment = 0
-					}
-					offer.AdditionalPayment, err = strconv.Atoi(data)
-					if err != nil {
-						offer.AdditionalPayment = 0
-					}
-				} else if strings.HasPrefix(data, "Liczba pokoi") {
-					// TODO: Extract the number of rooms and convert it to a number
-					offer.Rooms += data
-				} else if strings.HasPrefix(data, "Powierzchnia") {
-					// TODO: Extract the area number and convert it to a number
-					offer.Area += data
-				} else if strings.HasPrefix(data, "Poziom") {
-					// TODO: Extract the floor number and convert it to a number
-					offer.Floor += data
-				}
-			}
-		case html.EndTagToken:
-			t := tkn.Token()
-			if t.Data == "div" && isDescription {
-				isDescription = false
-			} else if t.Data == "p" && isTag {
-				isTag = false
-			}
-
-		case html.SelfClosingTagToken:
-			t := tkn.Token()
-			if t.Data == "img" {
-				if checkAttr(t.Attr, "class", "css-1bmvjcs") {
-					offer.Images = append(offer.Images, getAttr(t.Attr, "src"))
-				}
-			}
-		}
-	}
-}
-
-// Parse the otodom offer.
-//
-// Parameters:
-//
-//	offer: The offer to parse.
-//
-// Returns:
-//
-//	The parsed offer.
-func parseOtodomOffer(offer Offer) Offer {
-	text, err := FetchHTMLPage(offer.Url)
-	if err != nil {
-		log.Printf("Error fetching the Otodom page: %v", err)
-		return offer
-	}
-
-	tkn := html.NewTokenizer(strings.NewReader(text))
-
-	var (
-		isDescription, isJson bool
-		currentTag            string
-		isTagLabel            bool
-		isTagValue            bool
-		jsonText              string
-	)
-
-	for {
-		tt := tkn.Next()
-		switch tt {
-		case html.ErrorToken:
-			// End of the document
-			return offer
-
-		case html.StartTagToken:
-			t := tkn.Token()
-
-			if t.Data == "p" && getAttr(t.Attr, "class") == "e1wd2yzk2 css-1airkmu" {
-				if getAttr(t.Attr, "data-sentry-element") == "Item" {
-					isTagLabel = true
-				} else {
-					isTagValue = true
-				}
-			}
-
-			isDescription = getAttr(t.Attr, "data-cy") == "adPageAdDescription"
-			isJson = (t.Data == "script") && checkAttr(t.Attr, "type", "application/json")
-
-		case html.TextToken:
-			text := strings.TrimSpace(string(tkn.Text()))
-
-			if isTagLabel {
-				currentTag = strings.TrimSuffix(text, ":")
-				isTagLabel = false
-			} else if isTagValue && currentTag != "" {
-				switch currentTag {
-				case "Powierzchnia":
-					offer.Area = currentTag + ": " + text
-				case "Liczba pokoi":
-					offer.Rooms = currentTag + ": " + text
-				case "Piętro":
-					offer.Floor = currentTag + ": " + text
-				case "Czynsz":
-					val := strings.ReplaceAll(text, " ", "")
-					val = regexp.MustCompile(`\d+`).FindString(val)
-					if v, err := strconv.Atoi(val); err == nil {
-						offer.AdditionalPayment = v
-					}
-				}
-				currentTag = ""
-				isTagValue = false
-			}
-
-			if isDescription {
-				offer.Description += text + "\n"
-			}
-
-			if isJson {
-				jsonText += text
+			if isScript {
+				content += string(tkn.Text())
 			}
 
 		case html.EndTagToken:
-			t := tkn.Token()
-
-			if t.Data == "script" && isJson {
-				isJson = false
-				offer.Images, err = parseOtodomImages(jsonText)
-				if err != nil {
-					log.Println(err)
-				}
-			} else if t.Data == "div" && isDescription {
-				isDescription = false
-				if len(offer.Description) > 0 {
-					offer.Description = strings.TrimSuffix(offer.Description, "\n")
-				}
+			if isScript {
+				return content
 			}
-
 		}
 	}
 }
@@ -346,7 +189,7 @@ func parseOtodomOffer(offer Offer) Offer {
 //
 //	The offer extracted from the block of code.
 func extractOffer(text string) Offer {
-	return extractOfferWithConfig(text, OLXConfig)
+	return extractOfferWithConfig(text, GetConfig("olx"))
 }
 
 func extractOfferWithConfig(text string, config ExtractorConfig) Offer {
@@ -370,6 +213,10 @@ func extractOfferWithConfig(text string, config ExtractorConfig) Offer {
 			if offer.Url == "" {
 				return Offer{}
 			}
+			if config.TodayOnly && !postedToday(offer, config) {
+				log.Printf("[DEBUG] Skipping non-today offer: %s", offer.Url)
+				return Offer{}
+			}
 			return offer
 
 		case html.StartTagToken:
@@ -378,7 +225,9 @@ func extractOfferWithConfig(text string, config ExtractorConfig) Offer {
 			// Track if we're inside a link
 			if t.Data == "a" {
 				isInLink = true
-				// Extract URL
+			}
+			// Extract URL from the first link matching the selector
+			if matchesSelector(t, config.URLSelector) {
 				if url := getAttr(t.Attr, "href"); url != "" && offer.Url == "" {
 					offer.Url = normalizeURL(url, config.BaseURL)
 				}
@@ -431,14 +280,14 @@ func extractOfferWithConfig(text string, config ExtractorConfig) Offer {
 				}
 
 			case "location-date":
-				location, timeStr := extractLocationAndTime(text, config)
+				location, postedAt := extractLocationAndTime(text, config)
 				if offer.Location == "" && location != "" {
 					offer.Location = location
 					log.Printf("[DEBUG] Found location: %s", location)
 				}
-				if offer.Time == "" && timeStr != "" {
-					offer.Time = timeStr
-					log.Printf("[DEBUG] Found time: %s", timeStr)
+				if offer.PostedAt.IsZero() && !postedAt.IsZero() {
+					offer.PostedAt = postedAt
+					log.Printf("[DEBUG] Found time: %s", postedAt)
 				}
 			}
 		}
@@ -451,13 +300,37 @@ func matchesSelector(token html.Token, selector Selector) bool {
 	if selector.Tag != "" && token.Data != selector.Tag {
 		return false
 	}
+	if selector.Attribute == "class" && selector.Value != "" {
+		return hasClasses(getAttr(token.Attr, "class"), selector.Value)
+	}
 	if selector.Attribute != "" && selector.Value != "" {
 		return checkAttr(token.Attr, selector.Attribute, selector.Value)
 	}
 	return selector.Tag == token.Data
 }
 
+// Check if the class attribute contains all the given classes, in any order.
+func hasClasses(attr, classes string) bool {
+	present := strings.Fields(attr)
+	for _, class := range strings.Fields(classes) {
+		found := false
+		for _, p := range present {
+			if p == class {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
 func normalizeURL(url, baseURL string) string {
+	if strings.HasPrefix(url, "//") {
+		return "https:" + url
+	}
 	if strings.HasPrefix(url, "/") {
 		return baseURL + url
 	}
@@ -483,99 +356,34 @@ func extractPrice(text string, pattern *regexp.Regexp) int {
 	return 0
 }
 
-func extractLocationAndTime(text string, config ExtractorConfig) (location, timeStr string) {
+func extractLocationAndTime(text string, config ExtractorConfig) (location string, postedAt time.Time) {
 	// Split by common separators
 	parts := strings.Split(text, " - ")
 	if len(parts) >= 2 {
 		location = strings.TrimSpace(parts[0])
 		dateTimeStr := strings.TrimSpace(parts[1])
 
-		// Check if it's today
-		if !strings.Contains(dateTimeStr, config.TodayKeyword) {
-			log.Printf("[DEBUG] Skipping non-today offer: %s", dateTimeStr)
-			return location, ""
-		}
-
-		// Extract time
-		if matches := config.TimePattern.FindStringSubmatch(dateTimeStr); len(matches) > 0 {
-			if t, err := time.Parse("15:04", matches[0]); err == nil {
-				// Adjust timezone
-				t = t.Add(config.TimezoneOffset)
-				timeStr = t.Format("15:04")
-			}
+		var ok bool
+		if postedAt, ok = parsePostedAt(dateTimeStr, config); !ok {
+			log.Printf("[DEBUG] Could not parse the time of the offer: %s", dateTimeStr)
 		}
 	} else {
 		// Try to extract location from the whole text
 		location = text
 	}
 
-	return location, timeStr
+	return location, postedAt
 }
 
-// Parse the HTML code and extract all the offers.
-//
-// Parameters:
-//
-//	text: The HTML code to parse.
-//
-// Returns:
-//
-//	The offers extracted from the HTML code.
-func ParseHtml(text string) []Offer {
-	tokenizer := html.NewTokenizer(strings.NewReader(text))
-
-	offers := make([]Offer, 0)
-	isOffer := false
-	var offerContent string
-	offerSeparator := "css-1sw7q4x"
-	depth := 0
-
-	for {
-		tokenType := tokenizer.Next()
-
-		switch tokenType {
-		case html.ErrorToken:
-			// End of the document, we're done
-			return offers
-
-		case html.StartTagToken:
-			token := tokenizer.Token()
-			if !isOffer {
-				if token.Data == "div" {
-					isOffer = checkAttr(token.Attr, "class", offerSeparator)
-				}
-			} else {
-				if token.Data == "div" {
-					depth++
-				}
-				offerContent += token.String()
-			}
-
-		case html.EndTagToken:
-			token := tokenizer.Token()
-			if isOffer && token.Data == "div" && depth == 0 {
-				isOffer = false
-				offer := extractOffer(offerContent)
-
-				// TODO: For some reason, the last div recognized as offer is empty
-				// Inspect this later
-				if offer.Title != "" {
-					offers = append(offers, offer)
-				}
-				offerContent = ""
-				depth = 0
-			} else if isOffer {
-				if token.Data == "div" {
-					depth--
-				}
-				offerContent += token.String()
-			}
-
-		default:
-			if isOffer {
-				offerContent += tokenizer.Token().String()
-				continue
-			}
-		}
+// Check if the offer was posted today according to the clock of the configuration.
+// Offers without a known time are treated as not posted today.
+func postedToday(offer Offer, config ExtractorConfig) bool {
+	if offer.PostedAt.IsZero() {
+		return false
+	}
+	location := config.Location
+	if location == nil {
+		location = Warsaw
 	}
+	return sameDay(offer.PostedAt, config.now(), location)
 }
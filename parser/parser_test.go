@@ -1,8 +1,24 @@
 package parser
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
 	"regexp"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestExtractOffer(t *testing.T) {
@@ -21,7 +37,9 @@ func TestExtractOffer(t *testing.T) {
 		</div>
 	</div>`
 
-	offer := extractOffer(sampleHTML)
+	config := OLXConfig
+	config.Now = func() time.Time { return time.Date(2026, time.October, 12, 18, 0, 0, 0, time.UTC) }
+	offer := extractOfferWithConfig(sampleHTML, config)
 
 	// Verify extracted data
 	if offer.Title != "Wynajmę kawalerkę na osiedlu przy ul. Cukrowej w Szczecinie" {
@@ -40,9 +58,10 @@ func TestExtractOffer(t *testing.T) {
 		t.Errorf("URL not extracted correctly: got %q", offer.Url)
 	}
 
-	// Time should be adjusted for timezone (14:30 + 2 hours = 16:30)
-	if offer.Time != "16:30" {
-		t.Errorf("Time not extracted/adjusted correctly: got %q, want 16:30", offer.Time)
+	// Time is rendered in UTC, 14:30 UTC is 16:30 in Warsaw during summer time
+	want := time.Date(2026, time.October, 12, 16, 30, 0, 0, Warsaw)
+	if !offer.PostedAt.Equal(want) {
+		t.Errorf("Time not extracted/adjusted correctly: got %v, want %v", offer.PostedAt, want)
 	}
 }
 
@@ -50,7 +69,7 @@ func TestExtractOfferWithCustomConfig(t *testing.T) {
 	// Test with a custom configuration to show flexibility
 	customConfig := ExtractorConfig{
 		TitleSelector: Selector{
-			Tag:       "h3",  // Different tag
+			Tag:       "h3", // Different tag
 			Attribute: "",
 			Value:     "",
 		},
@@ -69,11 +88,10 @@ func TestExtractOfferWithCustomConfig(t *testing.T) {
 			Attribute: "href",
 			Value:     "",
 		},
-		PricePattern:   regexp.MustCompile(`\d+`),
-		TimePattern:    regexp.MustCompile(`\d{2}:\d{2}`),
-		TodayKeyword:   "Today",
-		BaseURL:        "https://example.com",
-		TimezoneOffset: 0,
+		PricePattern: regexp.MustCompile(`\d+`),
+		TimePattern:  regexp.MustCompile(`\d{2}:\d{2}`),
+		TodayKeyword: "Today",
+		BaseURL:      "https://example.com",
 	}
 
 	customHTML := `<div>
@@ -122,46 +140,102 @@ func TestExtractPrice(t *testing.T) {
 
 func TestExtractLocationAndTime(t *testing.T) {
 	config := OLXConfig
+	config.Now = func() time.Time { return time.Date(2026, time.January, 15, 12, 0, 0, 0, time.UTC) }
 
 	tests := []struct {
 		name         string
 		input        string
 		wantLocation string
-		wantTime     string
+		wantTime     time.Time
 	}{
 		{
 			name:         "Today with time",
 			input:        "Warszawa, Mokotów - Dzisiaj o 14:30",
 			wantLocation: "Warszawa, Mokotów",
-			wantTime:     "16:30", // +2 hours timezone
+			wantTime:     time.Date(2026, time.January, 15, 15, 30, 0, 0, Warsaw), // +1 hour in winter
+		},
+		{
+			name:         "Yesterday with time",
+			input:        "Warszawa - Wczoraj o 23:30",
+			wantLocation: "Warszawa",
+			wantTime:     time.Date(2026, time.January, 15, 0, 30, 0, 0, Warsaw),
 		},
 		{
-			name:         "Not today",
+			name:         "Full date",
 			input:        "Kraków - 02 sierpnia 2025",
 			wantLocation: "Kraków",
-			wantTime:     "", // Should be empty as it's not today
+			wantTime:     time.Date(2025, time.August, 2, 0, 0, 0, 0, Warsaw),
+		},
+		{
+			name:         "Refreshed",
+			input:        "Kraków - Odświeżono dnia 12 października 2025",
+			wantLocation: "Kraków",
+			wantTime:     time.Date(2025, time.October, 12, 0, 0, 0, 0, Warsaw),
 		},
 		{
 			name:         "Location only",
 			input:        "Gdańsk",
 			wantLocation: "Gdańsk",
-			wantTime:     "",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			location, timeStr := extractLocationAndTime(tt.input, config)
+			location, postedAt := extractLocationAndTime(tt.input, config)
 			if location != tt.wantLocation {
 				t.Errorf("Location = %q, want %q", location, tt.wantLocation)
 			}
-			if timeStr != tt.wantTime {
-				t.Errorf("Time = %q, want %q", timeStr, tt.wantTime)
+			if !postedAt.Equal(tt.wantTime) {
+				t.Errorf("Time = %v, want %v", postedAt, tt.wantTime)
 			}
 		})
 	}
 }
 
+func TestExtractOfferTodayOnly(t *testing.T) {
+	sampleHTML := `<div>
+		<a href="/d/oferta/test-ID1.html"><h4>Test</h4></a>
+		<p data-testid="ad-price">2000 zł</p>
+		<p data-testid="location-date">Poznań - 02 sierpnia 2025</p>
+	</div>`
+
+	if !OLXConfig.TodayOnly {
+		t.Error("OLX offers should be filtered by the today-only policy by default")
+	}
+
+	config := OLXConfig
+	config.Now = func() time.Time { return time.Date(2026, time.October, 12, 12, 0, 0, 0, time.UTC) }
+
+	config.TodayOnly = false
+	if offer := extractOfferWithConfig(sampleHTML, config); offer.Title != "Test" {
+		t.Errorf("Offer should be kept without the today-only policy, got %+v", offer)
+	}
+
+	config.TodayOnly = true
+	if offer := extractOfferWithConfig(sampleHTML, config); offer.Url != "" {
+		t.Errorf("Offer should be skipped with the today-only policy, got %+v", offer)
+	}
+}
+
+func TestExtractOfferURLSelector(t *testing.T) {
+	sampleHTML := `<div>
+		<a href="/oferty/promowane/"><span>Promowane</span></a>
+		<a class="offer-link" href="/d/oferta/test-ID2.html"><h4>Test</h4></a>
+		<p data-testid="ad-price">2000 zł</p>
+	</div>`
+
+	config := OLXConfig
+	config.TodayOnly = false
+	if offer := extractOfferWithConfig(sampleHTML, config); offer.Url != "https://www.olx.pl/oferty/promowane/" {
+		t.Errorf("Default selector should take the first link, got %q", offer.Url)
+	}
+
+	config.URLSelector = Selector{Tag: "a", Attribute: "class", Value: "offer-link"}
+	if offer := extractOfferWithConfig(sampleHTML, config); offer.Url != "https://www.olx.pl/d/oferta/test-ID2.html" {
+		t.Errorf("Custom selector should take the matching link, got %q", offer.Url)
+	}
+}
+
 func TestNormalizeURL(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -198,3 +272,1493 @@ func TestNormalizeURL(t *testing.T) {
 		})
 	}
 }
+
+func TestFindSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		want    string
+		wantErr bool
+	}{
+		{"OLX search", "https://www.olx.pl/nieruchomosci/mieszkania/wynajem/poznan/", "olx", false},
+		{"Otodom offer", "https://www.otodom.pl/pl/oferta/mieszkanie-ID4abcd", "otodom", false},
+		{"Unsupported", "https://example.com/offer/1", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, err := FindSource(tt.url)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("FindSource(%q) expected error, got %q", tt.url, source.Name())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FindSource(%q) unexpected error = %v", tt.url, err)
+			}
+			if source.Name() != tt.want {
+				t.Errorf("FindSource(%q) = %q, want %q", tt.url, source.Name(), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOtodomSearchPage(t *testing.T) {
+	sampleHTML := `<html><head>
+	<script id="__NEXT_DATA__" type="application/json">{"props":{"pageProps":{"data":{"searchAds":{"items":[
+		{"slug":"promowane-mieszkanie-ID4aaaa","title":"Promowane","isPromoted":true},
+		{"id":65123456,"slug":"mieszkanie-2-pokojowe-jezyce-ID4bbbb","title":"Mieszkanie 2 pokojowe, Jeżyce","isPromoted":false,
+		 "location":{"address":{"street":{"name":"ul. Kościelna","number":"12"},"city":{"name":"Poznań"}},
+		  "reverseGeocoding":{"locations":[{"locationLevel":"city","name":"Poznań"},{"locationLevel":"district","name":"Jeżyce"}]}},
+		 "images":[{"medium":"https://img.otodom.pl/1-m.jpg","large":"https://img.otodom.pl/1-l.jpg"}],
+		 "totalPrice":{"value":2800,"currency":"PLN"},"rentPrice":{"value":450,"currency":"PLN"},
+		 "areaInSquareMeters":45.5,"roomsNumber":"TWO","floorNumber":"GROUND","dateCreated":"2025-08-02 10:15:00"}
+	]}}}}}</script>
+	</head><body></body></html>`
+
+	offers, err := ParseSearchPage("https://www.otodom.pl/pl/wyniki/wynajem/mieszkanie/wielkopolskie/poznan/poznan/poznan", sampleHTML)
+	if err != nil {
+		t.Fatalf("ParseSearchPage() unexpected error = %v", err)
+	}
+	if len(offers) != 1 {
+		t.Fatalf("ParseSearchPage() returned %d offers, want 1", len(offers))
+	}
+
+	offer := offers[0]
+	if offer.Title != "Mieszkanie 2 pokojowe, Jeżyce" {
+		t.Errorf("Title = %q", offer.Title)
+	}
+	if offer.Url != "https://www.otodom.pl/pl/oferta/mieszkanie-2-pokojowe-jezyce-ID4bbbb" {
+		t.Errorf("Url = %q", offer.Url)
+	}
+	if offer.Price != 2800 || offer.AdditionalPayment != 450 {
+		t.Errorf("Price = %d + %d, want 2800 + 450", offer.Price, offer.AdditionalPayment)
+	}
+	if offer.Location != "Poznań, Jeżyce, ul. Kościelna 12" {
+		t.Errorf("Location = %q", offer.Location)
+	}
+	if offer.Area != "Powierzchnia: 45.5 m²" || offer.Rooms != "Liczba pokoi: 2" || offer.Floor != "Piętro: parter" {
+		t.Errorf("Area, Rooms, Floor = %q, %q, %q", offer.Area, offer.Rooms, offer.Floor)
+	}
+	if offer.AreaM2 != 45.5 || offer.RoomCount != 2 || offer.FloorNumber != FloorGround {
+		t.Errorf("AreaM2, RoomCount, FloorNumber = %g, %d, %d", offer.AreaM2, offer.RoomCount, offer.FloorNumber)
+	}
+	if len(offer.Images) != 1 || offer.Images[0] != "https://img.otodom.pl/1-l.jpg" {
+		t.Errorf("Images = %v", offer.Images)
+	}
+	if offer.Source != "otodom" || offer.ListingId != "4bbbb" {
+		t.Errorf("Source, ListingId = %q, %q, want otodom, 4bbbb", offer.Source, offer.ListingId)
+	}
+}
+
+func TestParseOtodomOffer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body>
+	<div data-cy="adPageAdDescription">Mieszkanie przy parku</div>
+	<script id="__NEXT_DATA__" type="application/json">{"props":{"pageProps":{"ad":{"id":65123456,"images":[
+		{"medium":"https://img.otodom.pl/1-m.jpg","large":"https://img.otodom.pl/1-l.jpg"}
+	]}}}}</script>
+	</body></html>`))
+	}))
+	defer server.Close()
+
+	var delays []time.Duration
+	fetcher := newTestFetcher(&delays)
+	fetcher.MaxRetries = 0
+	fetcher.Client = &http.Client{Transport: redirectTransport{server}}
+	defaultFetcher := DefaultFetcher
+	DefaultFetcher = fetcher
+	defer func() { DefaultFetcher = defaultFetcher }()
+
+	url := "https://www.otodom.pl/pl/oferta/mieszkanie-przy-parku-ID4bbbb"
+	source, err := FindSource(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offer := source.ParseOffer(Offer{Url: url, Source: "otodom", ListingId: source.ListingId(url)})
+	if offer.ListingId != "4bbbb" {
+		t.Errorf("ListingId = %q, want 4bbbb", offer.ListingId)
+	}
+	if len(offer.Images) != 1 || offer.Images[0] != "https://img.otodom.pl/1-l.jpg" {
+		t.Errorf("Images = %v", offer.Images)
+	}
+	if offer.Description != "Mieszkanie przy parku" {
+		t.Errorf("Description = %q", offer.Description)
+	}
+
+	// The offer found in the Otodom search results is the same listing as the parsed one
+	found, err := ParseSearchPage("https://www.otodom.pl/pl/wyniki/wynajem/mieszkanie/mazowieckie/warszawa/warszawa/warszawa", `<script id="__NEXT_DATA__" type="application/json">{"props":{"pageProps":{"data":{"searchAds":{"items":[
+		{"id":65123456,"slug":"mieszkanie-przy-parku-ID4bbbb","title":"Mieszkanie przy parku"}
+	]}}}}}</script>`)
+	if err != nil || len(found) != 1 {
+		t.Fatalf("ParseSearchPage() = %v, %v, want 1 offer", found, err)
+	}
+	found[0].Url += "?source=search"
+	if found[0].ListingId != offer.ListingId || !offer.SameListing(found[0]) {
+		t.Errorf("ListingId of the search results = %q, want the same listing as %q", found[0].ListingId, offer.ListingId)
+	}
+}
+
+func TestListingId(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://www.olx.pl/d/oferta/wynajme-kawalerke-CID3-ID16SdDt.html", "16SdDt"},
+		{"https://www.olx.pl/d/oferta/wynajme-kawalerke-CID3-ID16SdDt.html?reason=extended_search", "16SdDt"},
+		{"https://www.olx.pl/d/oferta/bez-id.html", ""},
+		{"https://www.otodom.pl/pl/oferta/mieszkanie-ID4bbbb", "4bbbb"},
+		{"https://www.otodom.pl/pl/oferta/mieszkanie-ID4bbbb?ref=olx", "4bbbb"},
+		{"https://www.otodom.pl/pl/oferta/mieszkanie-bez-id", ""},
+		{"https://gratka.pl/nieruchomosci/mieszkanie-poznan-jezyce/ob/31234567", "31234567"},
+		{"https://www.morizon.pl/oferta/wynajem-mieszkanie-krakow-mzn2041234567", "2041234567"},
+		{"https://wroclaw.nieruchomosci-online.pl/mieszkanie,z-balkonem/25123456.html", "25123456"},
+		{"https://www.domiporta.pl/nieruchomosci/wynajme-mieszkanie-gdansk-oliwa/154123457", "154123457"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			source, err := FindSource(tt.url)
+			if err != nil {
+				t.Fatalf("FindSource() unexpected error = %v", err)
+			}
+			if got := source.ListingId(tt.url); got != tt.want {
+				t.Errorf("ListingId() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// Listings keep their identity when the title in the url changes
+	a := Offer{Url: "https://www.olx.pl/d/oferta/stary-tytul-CID3-ID16SdDt.html", Source: "olx", ListingId: "16SdDt"}
+	b := Offer{Url: "https://www.olx.pl/d/oferta/nowy-tytul-CID3-ID16SdDt.html", Source: "olx", ListingId: "16SdDt"}
+	c := Offer{Url: "https://www.olx.pl/d/oferta/stary-tytul-CID3-ID16SdDu.html", Source: "olx", ListingId: "16SdDu"}
+	if !a.SameListing(b) || a.SameListing(c) || a.SameListing(Offer{Url: "https://gratka.pl/1"}) {
+		t.Error("SameListing() does not compare the listing ids")
+	}
+}
+
+func TestCreateOtodomUrl(t *testing.T) {
+	url, err := CreateUrl(SearchTerm{
+		Source:    "otodom",
+		Location:  "poznan",
+		Price_min: 1000,
+		Price_max: 2500,
+		Bedrooms:  []string{"two", "three"},
+	})
+	if err != nil {
+		t.Fatalf("CreateUrl() unexpected error = %v", err)
+	}
+
+	want := "https://www.otodom.pl/pl/wyniki/wynajem/mieszkanie/wielkopolskie/poznan/poznan/poznan?by=LATEST&direction=DESC&priceMin=1000&priceMax=2500&roomsNumber=%5BTWO%2CTHREE%5D"
+	if url != want {
+		t.Errorf("CreateUrl() = %q, want %q", url, want)
+	}
+
+	info, err := GetSearchShortInfo(url)
+	if err != nil {
+		t.Fatalf("GetSearchShortInfo() unexpected error = %v", err)
+	}
+	if info != "Poznan(1000-2500) " {
+		t.Errorf("GetSearchShortInfo() = %q", info)
+	}
+}
+
+func TestCreateUrlFilters(t *testing.T) {
+	term := SearchTerm{
+		Location:  "poznan",
+		Price_max: 3000,
+		Floors:    []string{"floor_0", "floor_11"},
+		Furnished: true,
+		Pets:      true,
+		Elevator:  true,
+	}
+
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{
+			source: "olx",
+			want:   "https://www.olx.pl/nieruchomosci/mieszkania/wynajem/poznan/q-mieszkanie/?search[order]=created_at:desc&search[filter_float_price:to]=3000&search[filter_enum_floor_select][0]=floor_0&search[filter_enum_floor_select][1]=floor_11&search[filter_enum_furniture][0]=yes&search[filter_enum_pets][0]=yes&search[filter_enum_elevator][0]=yes",
+		},
+		{
+			// Otodom has no filter of the pets
+			source: "otodom",
+			want:   "https://www.otodom.pl/pl/wyniki/wynajem/mieszkanie/wielkopolskie/poznan/poznan/poznan?by=LATEST&direction=DESC&priceMax=3000&floors=%5BGROUND%2CABOVE_TENTH%5D&equipmentTypes=%5BFURNITURE%5D&extras=%5BLIFT%5D",
+		},
+		{
+			// Portals only filter the rooms and the area
+			source: "gratka",
+			want:   "https://gratka.pl/nieruchomosci/mieszkania/poznan/wynajem?sort=newest&cena-calkowita:max=3000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			term.Source = tt.source
+			url, err := CreateUrl(term)
+			if err != nil {
+				t.Fatalf("CreateUrl() unexpected error = %v", err)
+			}
+			if url != tt.want {
+				t.Errorf("CreateUrl() = %q, want %q", url, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSearchUrl(t *testing.T) {
+	tests := []struct {
+		url  string
+		want SearchTerm
+	}{
+		{
+			url:  "https://www.olx.pl/nieruchomosci/mieszkania/wynajem/poznan/q-mieszkanie/?search[order]=created_at:desc&search[filter_float_price:from]=1000&search[filter_enum_rooms][1]=three&search[filter_enum_rooms][0]=two&search[filter_enum_pets][0]=yes",
+			want: SearchTerm{Source: "olx", Location: "poznan", Price_min: 1000, Bedrooms: []string{"two", "three"}, Pets: true},
+		},
+		{
+			url:  "https://www.otodom.pl/pl/wyniki/wynajem/mieszkanie/wielkopolskie/poznan/poznan/poznan?by=LATEST&direction=DESC&priceMax=2500&areaMin=40&floors=%5BGROUND%5D&extras=%5BLIFT%5D",
+			want: SearchTerm{Source: "otodom", Location: "poznan", Price_max: 2500, Size_min: 40, Floors: []string{"floor_0"}, Elevator: true},
+		},
+		{
+			url:  "https://gratka.pl/nieruchomosci/mieszkania/poznan/wynajem?sort=newest&liczba-pokoi:min=2",
+			want: SearchTerm{Source: "gratka", Location: "poznan", Bedrooms: []string{"two", "three", "four"}},
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseSearchUrl(tt.url)
+		if err != nil {
+			t.Fatalf("ParseSearchUrl(%q) unexpected error = %v", tt.url, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseSearchUrl(%q) = %+v, want %+v", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestSearchUrlRoundTrip(t *testing.T) {
+	terms := []SearchTerm{
+		{Location: "poznan"},
+		{Location: "krakow", Price_min: 1000, Price_max: 2500},
+		{Location: "warszawa", Price_max: 3000, Size_min: 40.5, Size_max: 60},
+		{
+			Location:  "poznan",
+			Price_min: 1500,
+			Size_max:  70,
+			Bedrooms:  []string{"two", "three"},
+			Floors:    []string{"floor_0", "floor_4", "floor_17"},
+			Furnished: true,
+			Pets:      true,
+			Elevator:  true,
+		},
+	}
+
+	for _, source := range Sources() {
+		for _, term := range terms {
+			// Filters the source does not support are lost by CreateUrl
+			term.Source = source.Name()
+			if !SupportsFilter(source, FilterFloors) {
+				term.Floors = nil
+			}
+			term.Furnished = term.Furnished && SupportsFilter(source, FilterFurnished)
+			term.Pets = term.Pets && SupportsFilter(source, FilterPets)
+			term.Elevator = term.Elevator && SupportsFilter(source, FilterElevator)
+
+			url, err := CreateUrl(term)
+			if err != nil {
+				t.Fatalf("CreateUrl(%+v) unexpected error = %v", term, err)
+			}
+			got, err := ParseSearchUrl(url)
+			if err != nil {
+				t.Fatalf("ParseSearchUrl(%q) unexpected error = %v", url, err)
+			}
+			if !reflect.DeepEqual(got, term) {
+				t.Errorf("ParseSearchUrl(%q) = %+v, want %+v", url, got, term)
+			}
+			if _, err := ParseEditableSearchUrl(url); err != nil {
+				t.Errorf("ParseEditableSearchUrl(%q) unexpected error = %v", url, err)
+			}
+		}
+	}
+}
+
+func TestParseEditableSearchUrl(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		wantErr bool
+	}{
+		{
+			name: "created by the bot",
+			url:  "https://www.olx.pl/nieruchomosci/mieszkania/wynajem/warszawa/q-mieszkanie/?search[order]=created_at:desc&search[filter_float_price:to]=3000",
+		},
+		{
+			name: "escaped parameters in another order",
+			url:  "https://www.olx.pl/nieruchomosci/mieszkania/wynajem/warszawa/q-mieszkanie?search%5Bfilter_float_price:to%5D=3000&search%5Border%5D=created_at:desc",
+		},
+		{
+			name:    "olx district",
+			url:     "https://www.olx.pl/nieruchomosci/mieszkania/wynajem/warszawa/q-mieszkanie/?search[order]=created_at:desc&search[district_id]=353&search[filter_float_price:to]=3000",
+			wantErr: true,
+		},
+		{
+			name:    "otodom district",
+			url:     "https://www.otodom.pl/pl/wyniki/wynajem/mieszkanie/mazowieckie/warszawa/warszawa/warszawa/mokotow?by=LATEST&direction=DESC&priceMax=3000",
+			wantErr: true,
+		},
+		{
+			name:    "pasted without the keyword",
+			url:     "https://www.olx.pl/nieruchomosci/mieszkania/wynajem/warszawa/?search[order]=created_at:desc&search[filter_float_price:to]=3000",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseEditableSearchUrl(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseEditableSearchUrl() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (got.Location != "warszawa" || got.Price_max != 3000) {
+				t.Errorf("ParseEditableSearchUrl() = %+v", got)
+			}
+		})
+	}
+}
+
+func TestSearchInfo(t *testing.T) {
+	tests := []struct {
+		name      string
+		url       string
+		wantShort string
+		wantFull  []string
+	}{
+		{
+			name:      "olx",
+			url:       "https://www.olx.pl/nieruchomosci/mieszkania/wynajem/poznan/q-mieszkanie/?search[order]=created_at:desc&search[filter_float_price:from]=1000&search[filter_float_price:to]=2000&search[filter_float_m:from]=40&search[filter_enum_rooms][0]=two&search[filter_enum_floor_select][0]=floor_1",
+			wantShort: "Poznan(1000-2000) ",
+			wantFull: []string{
+				"🏠 Full info of the search (OLX):\n\n📍 Poznan\n💰 Price: 1000 - 2000\n📐 Area: 40- m²\n🛏 Bedrooms:\n    - Two\n🏢 Floors:\n    - First\n",
+			},
+		},
+		{
+			name:      "olx without a city",
+			url:       "https://www.olx.pl/nieruchomosci/mieszkania/wynajem/?search[filter_float_price:to]=2000",
+			wantShort: "Poland(0-2000) ",
+			wantFull:  []string{"📍 Poland\n💰 Price: 0 - 2000\n"},
+		},
+		{
+			name:      "otodom",
+			url:       "https://www.otodom.pl/pl/wyniki/wynajem/mieszkanie/malopolskie/krakow/krakow/krakow?by=LATEST&direction=DESC&priceMin=1500&extras=%5BLIFT%5D",
+			wantShort: "Krakow(1500) ",
+			wantFull:  []string{"(Otodom)", "📍 Krakow\n💰 Price: 1500\n✨ Elevator\n"},
+		},
+		{
+			name:      "otodom without a city",
+			url:       "https://www.otodom.pl/pl/wyniki/wynajem/mieszkanie/cala-polska",
+			wantShort: "Poland(0) ",
+			wantFull:  []string{"📍 Poland\n"},
+		},
+		{
+			name:      "portal",
+			url:       "https://www.morizon.pl/do-wynajecia/mieszkania/gdansk/?ps%5Bprice_to%5D=3000&ps%5Bnumber_of_rooms_from%5D=3",
+			wantShort: "Gdansk(0-3000) ",
+			wantFull:  []string{"(Morizon)", "🛏 Bedrooms:\n    - Three, Four\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			short, err := GetSearchShortInfo(tt.url)
+			if err != nil {
+				t.Fatalf("GetSearchShortInfo() unexpected error = %v", err)
+			}
+			if short != tt.wantShort {
+				t.Errorf("GetSearchShortInfo() = %q, want %q", short, tt.wantShort)
+			}
+
+			full, err := GetSearchFullInfo(tt.url)
+			if err != nil {
+				t.Fatalf("GetSearchFullInfo() unexpected error = %v", err)
+			}
+			for _, want := range tt.wantFull {
+				if !strings.Contains(full, want) {
+					t.Errorf("GetSearchFullInfo() = %q, want it to contain %q", full, want)
+				}
+			}
+		})
+	}
+}
+
+func TestNormalizeSearchUrl(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "olx order and tracking",
+			url:  "https://www.olx.pl/nieruchomosci/mieszkania/wynajem/poznan/?search%5Border%5D=filter_float_price:asc&search%5Bdistrict_id%5D=325&utm_source=app&page=3#top",
+			want: "https://www.olx.pl/nieruchomosci/mieszkania/wynajem/poznan/?search[order]=created_at:desc&search%5Bdistrict_id%5D=325",
+		},
+		{
+			name: "olx without scheme and www",
+			url:  " olx.pl/nieruchomosci/mieszkania/wynajem/krakow/ ",
+			want: "https://www.olx.pl/nieruchomosci/mieszkania/wynajem/krakow/?search[order]=created_at:desc",
+		},
+		{
+			name:    "olx offer",
+			url:     "https://www.olx.pl/d/oferta/mieszkanie-2-pokoje-CID3-IDabc123.html",
+			wantErr: true,
+		},
+		{
+			name:    "olx other category",
+			url:     "https://www.olx.pl/motoryzacja/samochody/",
+			wantErr: true,
+		},
+		{
+			name: "otodom",
+			url:  "http://www.otodom.pl/pl/wyniki/wynajem/mieszkanie/mazowieckie/warszawa/warszawa/warszawa?limit=36&by=PRICE&direction=ASC&fbclid=abc&viewType=listing",
+			want: "https://www.otodom.pl/pl/wyniki/wynajem/mieszkanie/mazowieckie/warszawa/warszawa/warszawa?by=LATEST&direction=DESC&limit=36&viewType=listing",
+		},
+		{
+			name:    "otodom offer",
+			url:     "https://www.otodom.pl/pl/oferta/mieszkanie-2-pokoje-ID4abc",
+			wantErr: true,
+		},
+		{
+			name: "portal",
+			url:  "https://gratka.pl/nieruchomosci/mieszkania/poznan/wynajem?page=2&cena-calkowita:max=3000",
+			want: "https://gratka.pl/nieruchomosci/mieszkania/poznan/wynajem?sort=newest&cena-calkowita:max=3000",
+		},
+		{
+			name:    "unsupported",
+			url:     "https://example.com/search?q=mieszkanie",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeSearchUrl(tt.url)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("NormalizeSearchUrl() = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NormalizeSearchUrl() unexpected error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeSearchUrl() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSupportsFilter(t *testing.T) {
+	tests := []struct {
+		source string
+		filter Filter
+		want   bool
+	}{
+		{"olx", FilterPets, true},
+		{"olx", FilterFloors, true},
+		{"otodom", FilterElevator, true},
+		{"otodom", FilterPets, false},
+		{"morizon", FilterArea, true},
+		{"morizon", FilterFurnished, false},
+	}
+
+	for _, tt := range tests {
+		source, err := GetSource(tt.source)
+		if err != nil {
+			t.Fatalf("GetSource(%q) unexpected error = %v", tt.source, err)
+		}
+		if got := SupportsFilter(source, tt.filter); got != tt.want {
+			t.Errorf("SupportsFilter(%q, %q) = %v, want %v", tt.source, tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestParseRoomCount(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int
+	}{
+		{"Liczba pokoi: 2 pokoje", 2},
+		{"Liczba pokoi: Kawalerka", 1},
+		{"Liczba pokoi: 4 i więcej", 4},
+		{"Liczba pokoi: 3", 3},
+		{"Liczba pokoi: ", 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseRoomCount(tt.input); got != tt.want {
+			t.Errorf("parseRoomCount(%q) = %d, want %d", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseArea(t *testing.T) {
+	tests := []struct {
+		input string
+		want  float64
+	}{
+		{"Powierzchnia: 38 m²", 38},
+		{"Powierzchnia: 38,50 m²", 38.5},
+		{"Powierzchnia: 45.5 m²", 45.5},
+		{"Powierzchnia: 1 200 m²", 1200},
+		{"Powierzchnia: brak", 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseArea(tt.input); got != tt.want {
+			t.Errorf("parseArea(%q) = %g, want %g", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParseFloor(t *testing.T) {
+	tests := []struct {
+		input     string
+		wantFloor int
+		wantTotal int
+		wantOk    bool
+	}{
+		{"Poziom: 2", 2, 0, true},
+		{"Poziom: Parter", FloorGround, 0, true},
+		{"Poziom: Suterena", FloorBasement, 0, true},
+		{"Poziom: Poddasze", FloorAttic, 0, true},
+		{"Poziom: Powyżej 10", FloorAboveTenth, 0, true},
+		{"Piętro: 3/4", 3, 4, true},
+		{"Piętro: parter/3", FloorGround, 3, true},
+		{"Piętro: > 10", FloorAboveTenth, 0, true},
+		{"Piętro: brak informacji", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		floor, total, ok := parseFloor(tt.input)
+		if floor != tt.wantFloor || total != tt.wantTotal || ok != tt.wantOk {
+			t.Errorf("parseFloor(%q) = %d, %d, %v, want %d, %d, %v", tt.input, floor, total, ok, tt.wantFloor, tt.wantTotal, tt.wantOk)
+		}
+	}
+}
+
+func TestPageUrl(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		page int
+		want string
+	}{
+		{
+			"OLX first page",
+			"https://www.olx.pl/nieruchomosci/mieszkania/wynajem/poznan/q-mieszkanie/?search[order]=created_at:desc",
+			1,
+			"https://www.olx.pl/nieruchomosci/mieszkania/wynajem/poznan/q-mieszkanie/?search[order]=created_at:desc",
+		},
+		{
+			"OLX next page",
+			"https://www.olx.pl/nieruchomosci/mieszkania/wynajem/poznan/q-mieszkanie/?search[order]=created_at:desc&search[filter_float_price:to]=2000",
+			3,
+			"https://www.olx.pl/nieruchomosci/mieszkania/wynajem/poznan/q-mieszkanie/?search[order]=created_at:desc&search[filter_float_price:to]=2000&page=3",
+		},
+		{
+			"Existing page replaced",
+			"https://www.otodom.pl/pl/wyniki/wynajem/mieszkanie/wielkopolskie/poznan/poznan/poznan?page=2&by=LATEST",
+			4,
+			"https://www.otodom.pl/pl/wyniki/wynajem/mieszkanie/wielkopolskie/poznan/poznan/poznan?by=LATEST&page=4",
+		},
+		{
+			"Without query",
+			"https://www.olx.pl/nieruchomosci/mieszkania/wynajem/poznan/",
+			2,
+			"https://www.olx.pl/nieruchomosci/mieszkania/wynajem/poznan/?page=2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, err := FindSource(tt.url)
+			if err != nil {
+				t.Fatalf("FindSource(%q) unexpected error = %v", tt.url, err)
+			}
+			if got := source.PageUrl(tt.url, tt.page); got != tt.want {
+				t.Errorf("PageUrl(%q, %d) = %q, want %q", tt.url, tt.page, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchSearchOffers(t *testing.T) {
+	// Offer ids on the pages of every search, missing pages fail
+	searches := map[string][][]int{
+		"known":   {{1, 2}, {3, 4}, {5, 6}},
+		"empty":   {{1, 2}, {}, {3, 4}},
+		"limit":   {{1}, {2}, {3}, {4}},
+		"failing": {{1, 2}},
+		"moved":   {{1, 2}, {2, 3}},
+	}
+	requests := make(map[string][]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		search := pathSegment(r.URL, 2)
+		page := 1
+		if value := r.URL.Query().Get("page"); value != "" {
+			page, _ = strconv.Atoi(value)
+		}
+		requests[search] = append(requests[search], page)
+
+		pages := searches[search]
+		if page > len(pages) {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		for _, id := range pages[page-1] {
+			fmt.Fprintf(w, `<div class="css-1sw7q4x"><a href="/d/oferta/mieszkanie-CID3-ID%d.html"><h4>Offer %d</h4></a></div>`, id, id)
+		}
+	}))
+	defer server.Close()
+
+	var delays []time.Duration
+	fetcher := newTestFetcher(&delays)
+	fetcher.MaxRetries = 0
+	fetcher.Client = &http.Client{Transport: redirectTransport{server}}
+	defaultFetcher := DefaultFetcher
+	DefaultFetcher = fetcher
+	defer func() { DefaultFetcher = defaultFetcher }()
+
+	// The test offers have no time
+	if err := SetTodayOnly("olx", false); err != nil {
+		t.Fatal(err)
+	}
+	defer SetTodayOnly("olx", true)
+
+	tests := []struct {
+		name         string
+		search       string
+		maxPages     int
+		known        string
+		wantIds      []string
+		wantRequests []int
+		wantErr      bool
+	}{
+		{"stops at a known offer", "known", 5, "3", []string{"1", "2", "3", "4"}, []int{1, 2}, false},
+		{"stops at an empty page", "empty", 5, "", []string{"1", "2"}, []int{1, 2}, false},
+		{"stops at the page limit", "limit", 3, "", []string{"1", "2", "3"}, []int{1, 2, 3}, false},
+		{"fetches the first page without a limit", "limit", 0, "", []string{"1"}, []int{1}, false},
+		{"keeps the offers of a failed next page", "failing", 5, "", []string{"1", "2"}, []int{1, 2}, false},
+		{"skips the offers moved to the next page", "moved", 2, "", []string{"1", "2", "3"}, []int{1, 2}, false},
+		{"fails on the first page", "missing", 5, "", nil, []int{1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delete(requests, tt.search)
+			url := "https://www.olx.pl/nieruchomosci/mieszkania/" + tt.search + "/?search[order]=created_at:desc"
+			offers, err := FetchSearchOffers(url, tt.maxPages, func(offer Offer) (bool, error) {
+				return offer.ListingId == tt.known, nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FetchSearchOffers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var ids []string
+			for _, offer := range offers {
+				ids = append(ids, offer.ListingId)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIds) {
+				t.Errorf("FetchSearchOffers() offers = %v, want %v", ids, tt.wantIds)
+			}
+			if !reflect.DeepEqual(requests[tt.search], tt.wantRequests) {
+				t.Errorf("FetchSearchOffers() fetched pages %v, want %v", requests[tt.search], tt.wantRequests)
+			}
+		})
+	}
+
+	failure := errors.New("database failure")
+	_, err := FetchSearchOffers("https://www.olx.pl/nieruchomosci/mieszkania/known/", 5, func(offer Offer) (bool, error) {
+		return false, failure
+	})
+	if err != failure {
+		t.Errorf("FetchSearchOffers() error = %v, want the error of the known check", err)
+	}
+}
+
+// Create a fetcher for the tests recording the delays instead of sleeping.
+func newTestFetcher(delays *[]time.Duration) *Fetcher {
+	fetcher := NewFetcher()
+	fetcher.Rate = 0
+	fetcher.sleep = func(delay time.Duration) {
+		*delays = append(*delays, delay)
+	}
+	return fetcher
+}
+
+func TestFetcherRetries(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gzipWriter := gzip.NewWriter(w)
+		gzipWriter.Write([]byte("<html>ok</html>"))
+		gzipWriter.Close()
+	}))
+	defer server.Close()
+
+	var delays []time.Duration
+	fetcher := newTestFetcher(&delays)
+	fetcher.MaxDelay = 5 * time.Minute
+	resp, err := fetcher.Fetch(server.URL, nil)
+	if err != nil {
+		t.Fatalf("Fetch() unexpected error = %v", err)
+	}
+	if string(resp.Body) != "<html>ok</html>" {
+		t.Errorf("Fetch() body = %q", resp.Body)
+	}
+	if attempts != 3 {
+		t.Errorf("Fetch() made %d attempts, want 3", attempts)
+	}
+	if len(delays) != 2 || delays[0] != 120*time.Second || delays[1] != 120*time.Second {
+		t.Errorf("Fetch() delays = %v, want Retry-After of 2m0s twice", delays)
+	}
+}
+
+func TestFetcherRetryAfterLimit(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.Header().Set("Retry-After", "86400")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		if attempts == 2 {
+			w.Header().Set("Retry-After", time.Now().Add(48*time.Hour).UTC().Format(http.TimeFormat))
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("<html>ok</html>"))
+	}))
+	defer server.Close()
+
+	var delays []time.Duration
+	fetcher := newTestFetcher(&delays)
+	if _, err := fetcher.Fetch(server.URL, nil); err != nil {
+		t.Fatalf("Fetch() unexpected error = %v", err)
+	}
+	if len(delays) != 2 || delays[0] != fetcher.MaxDelay || delays[1] != fetcher.MaxDelay {
+		t.Errorf("Fetch() delays = %v, want Retry-After limited to %v twice", delays, fetcher.MaxDelay)
+	}
+}
+
+func TestFetcherErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/failing":
+			w.WriteHeader(http.StatusBadGateway)
+		case "/large":
+			w.Write(make([]byte, 2048))
+		}
+	}))
+	defer server.Close()
+
+	var delays []time.Duration
+	fetcher := newTestFetcher(&delays)
+	fetcher.MaxRetries = 2
+	fetcher.MaxBodySize = 1024
+
+	if _, err := fetcher.Fetch(server.URL+"/missing", nil); !IsStatus(err, http.StatusNotFound) {
+		t.Errorf("Fetch(/missing) error = %v, want status 404", err)
+	}
+	if len(delays) != 0 {
+		t.Errorf("Fetch(/missing) should not be retried, delays = %v", delays)
+	}
+
+	if _, err := fetcher.Fetch(server.URL+"/failing", nil); !IsStatus(err, http.StatusBadGateway) {
+		t.Errorf("Fetch(/failing) error = %v, want status 502", err)
+	}
+	if len(delays) != 2 {
+		t.Errorf("Fetch(/failing) should be retried twice, delays = %v", delays)
+	}
+
+	if _, err := fetcher.Fetch(server.URL+"/large", nil); err == nil {
+		t.Errorf("Fetch(/large) expected error for the body over the limit")
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Date(2026, time.October, 12, 12, 0, 0, 0, time.UTC)
+	bucket := newTokenBucket(2, 2)
+
+	// The burst is available at once, then a token is added every 500ms
+	want := []time.Duration{0, 0, 500 * time.Millisecond, time.Second}
+	for i, w := range want {
+		if got := bucket.reserve(now); got != w {
+			t.Errorf("reserve() #%d = %v, want %v", i, got, w)
+		}
+	}
+
+	if got := bucket.reserve(now.Add(3 * time.Second)); got != 0 {
+		t.Errorf("reserve() after refill = %v, want 0", got)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, time.October, 12, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		input  string
+		want   time.Duration
+		wantOk bool
+	}{
+		{"30", 30 * time.Second, true},
+		{"Mon, 12 Oct 2026 12:01:00 GMT", time.Minute, true},
+		{"", 0, false},
+		{"soon", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.input, now)
+		if got != tt.want || ok != tt.wantOk {
+			t.Errorf("parseRetryAfter(%q) = %v, %v, want %v, %v", tt.input, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
+
+func TestCacheRevalidation(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("image"))
+	}))
+	defer server.Close()
+
+	cache, err := NewCache(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatalf("NewCache() unexpected error = %v", err)
+	}
+	now := time.Date(2026, time.October, 12, 12, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+
+	var delays []time.Duration
+	fetcher := newTestFetcher(&delays)
+	fetcher.Cache = cache
+
+	fetch := func(wantRequests int) {
+		t.Helper()
+		resp, err := fetcher.FetchCached(server.URL, nil)
+		if err != nil {
+			t.Fatalf("FetchCached() unexpected error = %v", err)
+		}
+		if string(resp.Body) != "image" {
+			t.Errorf("FetchCached() body = %q, want image", resp.Body)
+		}
+		if requests != wantRequests {
+			t.Errorf("FetchCached() made %d requests, want %d", requests, wantRequests)
+		}
+	}
+
+	fetch(1)
+	// Fresh entry is served without a request
+	fetch(1)
+	// Stale entry is revalidated and served after 304
+	now = now.Add(2 * time.Hour)
+	fetch(2)
+	fetch(2)
+
+	if err := cache.Prune(time.Hour); err != nil {
+		t.Fatalf("Prune() unexpected error = %v", err)
+	}
+	now = now.Add(2 * time.Hour)
+	if err := cache.Prune(time.Hour); err != nil {
+		t.Fatalf("Prune() unexpected error = %v", err)
+	}
+	if _, _, ok := cache.load(server.URL); ok {
+		t.Errorf("Prune() should remove the entry older than the max age")
+	}
+}
+
+func TestLoadSelectors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "selectors.json")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer LoadSelectors(filepath.Join("..", "selectors.example.json"))
+
+	// The sample offer has no time, the setting is kept by the reloads
+	if err := SetTodayOnly("olx", false); err != nil {
+		t.Fatalf("SetTodayOnly() unexpected error = %v", err)
+	}
+	defer SetTodayOnly("olx", true)
+
+	sampleHTML := `<div data-cy="l-card" class="css-new">
+		<a href="/d/oferta/test-ID1.html"><h4>Test</h4></a>
+		<p data-testid="ad-price">2000 zł</p>
+	</div>`
+
+	if offers := ParseHtml(sampleHTML); len(offers) != 0 {
+		t.Fatalf("ParseHtml() with the default selectors returned %d offers, want 0", len(offers))
+	}
+
+	write(`{"olx": {"offer": {"tag": "div", "attribute": "data-cy", "value": "l-card"}}}`)
+	if err := LoadSelectors(path); err != nil {
+		t.Fatalf("LoadSelectors() unexpected error = %v", err)
+	}
+	if offers := ParseHtml(sampleHTML); len(offers) != 1 || offers[0].Title != "Test" {
+		t.Errorf("ParseHtml() with the loaded selectors = %+v", offers)
+	}
+	if GetConfig("olx").PriceSelector != OLXConfig.PriceSelector {
+		t.Errorf("Selectors missing in the file should keep the defaults")
+	}
+	if GetConfig("olx").TodayOnly {
+		t.Errorf("Reloading the selectors should keep the today-only setting")
+	}
+
+	write(`{"unknown": {}}`)
+	if err := LoadSelectors(path); err == nil {
+		t.Errorf("LoadSelectors() expected error for an unknown source")
+	}
+	if GetConfig("olx").OfferSelector.Value != "l-card" {
+		t.Errorf("Invalid file should keep the previous selectors")
+	}
+}
+
+func TestSelectorsExample(t *testing.T) {
+	if err := LoadSelectors(filepath.Join("..", "selectors.example.json")); err != nil {
+		t.Fatalf("LoadSelectors() unexpected error = %v", err)
+	}
+	defaults := map[string]ExtractorConfig{
+		"olx":                  OLXConfig,
+		"otodom":               OtodomConfig,
+		"gratka":               GratkaConfig,
+		"morizon":              MorizonConfig,
+		"nieruchomosci-online": NieruchomosciOnlineConfig,
+		"domiporta":            DomiportaConfig,
+	}
+	for name, want := range defaults {
+		got := GetConfig(name)
+		if got.OfferSelector != want.OfferSelector || got.PromotedSelector != want.PromotedSelector || got.DescriptionSelector != want.DescriptionSelector ||
+			got.ParameterSelector != want.ParameterSelector || got.ParameterLabelSelector != want.ParameterLabelSelector ||
+			got.ImageSelector != want.ImageSelector || got.TitleSelector != want.TitleSelector ||
+			got.PriceSelector != want.PriceSelector || got.LocationSelector != want.LocationSelector || got.URLSelector != want.URLSelector {
+			t.Errorf("Example selectors of %s differ from the defaults", name)
+		}
+	}
+}
+
+func TestHealthMonitor(t *testing.T) {
+	var alerts []string
+	monitor := &HealthMonitor{
+		Thresholds: HealthThresholds{Window: 2, MinOffersPerPage: 1, MaxMissingRatio: 0.5, MaxEmptyRatio: 0.5},
+		Alert: func(source, message string) {
+			alerts = append(alerts, source+": "+message)
+		},
+	}
+
+	good := Offer{Title: "Test", Price: 2000, Location: "Poznań", Description: "Test", Images: []string{"image"}}
+	noPrice := Offer{Title: "Test", Location: "Poznań"}
+
+	monitor.RecordSearchPage("olx", []Offer{good, good})
+	monitor.RecordSearchPage("olx", []Offer{good, good})
+	if len(alerts) != 0 {
+		t.Fatalf("Healthy source raised alerts: %v", alerts)
+	}
+
+	// Selector of the price stopped matching
+	monitor.RecordSearchPage("olx", []Offer{noPrice, noPrice})
+	monitor.RecordSearchPage("olx", []Offer{good, noPrice})
+	if len(alerts) != 1 || !strings.Contains(alerts[0], "75% of 4 offers without price") {
+		t.Fatalf("Alerts = %v, want missing price alert", alerts)
+	}
+
+	// Alert is raised once while the source stays unhealthy
+	monitor.RecordSearchPage("olx", []Offer{})
+	monitor.RecordSearchPage("olx", []Offer{})
+	if len(alerts) != 1 {
+		t.Fatalf("Alerts = %v, want a single alert", alerts)
+	}
+
+	monitor.RecordSearchPage("olx", []Offer{good})
+	monitor.RecordSearchPage("olx", []Offer{good})
+	if len(alerts) != 2 || !strings.Contains(alerts[1], "recovered") {
+		t.Fatalf("Alerts = %v, want recovery alert", alerts)
+	}
+
+	monitor.RecordOfferPage("otodom", Offer{Images: []string{"image"}})
+	monitor.RecordOfferPage("otodom", Offer{Images: []string{"image"}})
+	if len(alerts) != 3 || !strings.Contains(alerts[2], "otodom: layout of the offer pages") || !strings.Contains(alerts[2], "without description") {
+		t.Fatalf("Alerts = %v, want empty description alert", alerts)
+	}
+}
+
+func TestParseOlxPrerenderedState(t *testing.T) {
+	state := `{"ad":{"ad":{"id":912345678,"title":"Mieszkanie 2 pokoje Jeżyce","description":"Przytulne mieszkanie.<br />Blisko centrum.<p>Zapraszam</p>",
+		"createdTime":"2026-10-10T09:00:00+02:00","lastRefreshTime":"2026-10-12T14:30:00+02:00","isBusiness":true,
+		"price":{"regularPrice":{"value":2500,"currencyCode":"PLN"}},
+		"params":[{"key":"rent","name":"Czynsz (dodatkowo)","value":"600 zł","normalizedValue":"600"},
+			{"key":"rooms","name":"Liczba pokoi","value":"2 pokoje","normalizedValue":"two"},
+			{"key":"m","name":"Powierzchnia","value":"38 m²","normalizedValue":"38"},
+			{"key":"floor_select","name":"Poziom","value":"Parter","normalizedValue":"floor_0"}],
+		"location":{"cityName":"Poznań","districtName":"Jeżyce"},
+		"map":{"lat":52.41,"lon":16.9},
+		"photos":["https://ireland.apollo.olxcdn.com/v1/files/abc/image;s={width}x{height}"]}}}`
+	encoded, err := json.Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := `<html><body><script type="text/javascript">window.__PRERENDERED_STATE__= ` + string(encoded) + `;
+		window.__TAURUS__ = {};</script></body></html>`
+
+	offer, err := parseOlxPrerenderedState(Offer{Url: "https://www.olx.pl/d/oferta/test-ID1.html"}, page)
+	if err != nil {
+		t.Fatalf("parseOlxPrerenderedState() unexpected error = %v", err)
+	}
+
+	if offer.Title != "Mieszkanie 2 pokoje Jeżyce" || offer.Price != 2500 || offer.AdditionalPayment != 600 {
+		t.Errorf("Title, Price, AdditionalPayment = %q, %d, %d", offer.Title, offer.Price, offer.AdditionalPayment)
+	}
+	if offer.Location != "Poznań, Jeżyce" {
+		t.Errorf("Location = %q", offer.Location)
+	}
+	if offer.Description != "Przytulne mieszkanie.\nBlisko centrum.\nZapraszam" {
+		t.Errorf("Description = %q", offer.Description)
+	}
+	if offer.RoomCount != 2 || offer.AreaM2 != 38 || offer.Floor != "Poziom: Parter" || offer.FloorNumber != FloorGround {
+		t.Errorf("RoomCount, AreaM2, Floor = %d, %g, %q", offer.RoomCount, offer.AreaM2, offer.Floor)
+	}
+	if offer.Latitude != 52.41 || offer.Longitude != 16.9 || !offer.IsBusiness {
+		t.Errorf("Latitude, Longitude, IsBusiness = %g, %g, %v", offer.Latitude, offer.Longitude, offer.IsBusiness)
+	}
+	if !offer.PostedAt.Equal(time.Date(2026, time.October, 12, 14, 30, 0, 0, Warsaw)) {
+		t.Errorf("PostedAt = %v", offer.PostedAt)
+	}
+	if len(offer.Images) != 1 || offer.Images[0] != "https://ireland.apollo.olxcdn.com/v1/files/abc/image;s=1000x700" {
+		t.Errorf("Images = %v", offer.Images)
+	}
+
+	if _, err := parseOlxPrerenderedState(Offer{}, "<html></html>"); err == nil {
+		t.Errorf("parseOlxPrerenderedState() expected error for a page without state")
+	}
+}
+
+func TestPortalSources(t *testing.T) {
+	tests := []struct {
+		source     string
+		searchUrl  string
+		wantOffers int
+		wantSearch Offer
+		promoted   string
+		wantOffer  Offer
+		wantImages []string
+		wantUrl    string
+		wantInfo   string
+	}{
+		{
+			source:     "gratka",
+			wantOffers: 2,
+			wantSearch: Offer{
+				Title:    "Mieszkanie 2 pokoje, Jeżyce",
+				Url:      "https://gratka.pl/nieruchomosci/mieszkanie-poznan-jezyce-ul-koscielna/ob/31234567",
+				Price:    2800,
+				Location: "Poznań, Jeżyce, ul. Kościelna",
+			},
+			promoted:   "https://gratka.pl/nieruchomosci/mieszkanie-poznan-grunwald/ob/31230001",
+			wantOffer:  Offer{AdditionalPayment: 450, RoomCount: 2, AreaM2: 45.5, FloorNumber: 3, TotalFloors: 4, Description: "Do wynajęcia mieszkanie po remoncie.\nBlisko tramwaju."},
+			wantImages: []string{"https://d-gr.cdngr.pl/kadry/k/r/gr-ogl/1a/31234567_1.jpg", "https://d-gr.cdngr.pl/kadry/k/r/gr-ogl/1a/31234567_2.jpg"},
+			wantUrl:    "https://gratka.pl/nieruchomosci/mieszkania/poznan/wynajem?sort=newest&cena-calkowita:min=1000&cena-calkowita:max=3000&powierzchnia-w-m2:min=30&liczba-pokoi:min=2&liczba-pokoi:max=3",
+			wantInfo:   "Poznan(1000-3000) ",
+		},
+		{
+			source:     "morizon",
+			wantOffers: 2,
+			wantSearch: Offer{
+				Title:    "Słoneczne mieszkanie na Kazimierzu",
+				Url:      "https://www.morizon.pl/oferta/wynajem-mieszkanie-krakow-kazimierz-dietla-40m2-mzn2041234567",
+				Price:    3200,
+				Location: "Kraków, Stare Miasto, Kazimierz",
+			},
+			wantOffer:  Offer{AdditionalPayment: 650, RoomCount: 2, AreaM2: 40, FloorNumber: FloorGround, TotalFloors: 3, Description: "Mieszkanie w kamienicy przy ul. Dietla."},
+			wantImages: []string{"https://img.morizon.pl/2041234567/1.jpg"},
+			wantUrl:    "https://www.morizon.pl/do-wynajecia/mieszkania/poznan/?ps[sort]=date_desc&ps[price_from]=1000&ps[price_to]=3000&ps[living_area_from]=30&ps[number_of_rooms_from]=2&ps[number_of_rooms_to]=3",
+			wantInfo:   "Poznan(1000-3000) ",
+		},
+		{
+			source:     "nieruchomosci-online",
+			wantOffers: 2,
+			wantSearch: Offer{
+				Title:    "Mieszkanie z balkonem, Krzyki",
+				Url:      "https://wroclaw.nieruchomosci-online.pl/mieszkanie,z-balkonem/25123456.html",
+				Price:    2600,
+				Location: "Wrocław, Krzyki",
+			},
+			wantOffer:  Offer{AdditionalPayment: 500, RoomCount: 3, AreaM2: 52, FloorNumber: 2, Description: "Mieszkanie z balkonem w nowym budownictwie."},
+			wantImages: []string{"https://static.nieruchomosci-online.pl/images/25123456/1.jpg"},
+			wantUrl:    "https://poznan.nieruchomosci-online.pl/mieszkania,do-wynajecia/?sort=data_dodania_desc&cena_od=1000&cena_do=3000&powierzchnia_od=30&pokoje_od=2&pokoje_do=3",
+			wantInfo:   "Poznan(1000-3000) ",
+		},
+		{
+			source:     "domiporta",
+			wantOffers: 2,
+			wantSearch: Offer{
+				Title:    "Mieszkanie Wrzeszcz, Jaśkowa Dolina",
+				Url:      "https://www.domiporta.pl/nieruchomosci/wynajme-mieszkanie-gdansk-wrzeszcz-jaskowa-dolina-48m2/154123456",
+				Price:    3100,
+				Location: "Gdańsk, Wrzeszcz, Jaśkowa Dolina",
+			},
+			wantOffer:  Offer{RoomCount: 2, AreaM2: 48, FloorNumber: FloorAttic, Description: "Mieszkanie na poddaszu w zielonej okolicy."},
+			wantImages: []string{"https://img.domiporta.pl/154123456/1.jpg", "https://img.domiporta.pl/154123456/2.jpg"},
+			wantUrl:    "https://www.domiporta.pl/mieszkanie/wynajme/wielkopolskie/poznan?SortType=DataDodaniaDesc&Cena.From=1000&Cena.To=3000&Powierzchnia.From=30&LiczbaPokoi.From=2&LiczbaPokoi.To=3",
+			wantInfo:   "Poznan(1000-3000) ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			source, err := GetSource(tt.source)
+			if err != nil {
+				t.Fatalf("GetSource(%q) unexpected error = %v", tt.source, err)
+			}
+
+			searchPage, err := os.ReadFile(filepath.Join("testdata", tt.source+"_search.html"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			offers, err := source.ParseSearchPage(string(searchPage))
+			if err != nil {
+				t.Fatalf("ParseSearchPage() unexpected error = %v", err)
+			}
+			if len(offers) != tt.wantOffers {
+				t.Fatalf("ParseSearchPage() returned %d offers, want %d", len(offers), tt.wantOffers)
+			}
+			for _, offer := range offers {
+				if tt.promoted != "" && offer.Url == tt.promoted {
+					t.Errorf("ParseSearchPage() returned the promoted offer %s", offer.Url)
+				}
+			}
+			got := offers[0]
+			if got.Title != tt.wantSearch.Title || got.Url != tt.wantSearch.Url || got.Price != tt.wantSearch.Price || got.Location != tt.wantSearch.Location {
+				t.Errorf("ParseSearchPage() first offer = %+v, want %+v", got, tt.wantSearch)
+			}
+			if found, err := FindSource(got.Url); err != nil || found.Name() != tt.source {
+				t.Errorf("FindSource(%q) does not match the source", got.Url)
+			}
+
+			offerPage, err := os.ReadFile(filepath.Join("testdata", tt.source+"_offer.html"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			offer, err := parseDetailPage(got, string(offerPage), GetConfig(tt.source))
+			if err != nil {
+				t.Fatalf("parseDetailPage() unexpected error = %v", err)
+			}
+			if offer.AdditionalPayment != tt.wantOffer.AdditionalPayment || offer.RoomCount != tt.wantOffer.RoomCount || offer.AreaM2 != tt.wantOffer.AreaM2 ||
+				offer.FloorNumber != tt.wantOffer.FloorNumber || offer.TotalFloors != tt.wantOffer.TotalFloors {
+				t.Errorf("parseDetailPage() AdditionalPayment, RoomCount, AreaM2, FloorNumber, TotalFloors = %d, %d, %g, %d, %d, want %d, %d, %g, %d, %d",
+					offer.AdditionalPayment, offer.RoomCount, offer.AreaM2, offer.FloorNumber, offer.TotalFloors,
+					tt.wantOffer.AdditionalPayment, tt.wantOffer.RoomCount, tt.wantOffer.AreaM2, tt.wantOffer.FloorNumber, tt.wantOffer.TotalFloors)
+			}
+			if offer.Description != tt.wantOffer.Description {
+				t.Errorf("parseDetailPage() Description = %q, want %q", offer.Description, tt.wantOffer.Description)
+			}
+			if strings.Join(offer.Images, " ") != strings.Join(tt.wantImages, " ") {
+				t.Errorf("parseDetailPage() Images = %v, want %v", offer.Images, tt.wantImages)
+			}
+
+			url, err := CreateUrl(SearchTerm{
+				Source:    tt.source,
+				Location:  "poznan",
+				Price_min: 1000,
+				Price_max: 3000,
+				Size_min:  30,
+				Bedrooms:  []string{"three", "two"},
+			})
+			if err != nil {
+				t.Fatalf("CreateUrl() unexpected error = %v", err)
+			}
+			if url != tt.wantUrl {
+				t.Errorf("CreateUrl() = %q, want %q", url, tt.wantUrl)
+			}
+			if found, err := FindSource(url); err != nil || found.Name() != tt.source {
+				t.Errorf("FindSource(%q) does not match the source", url)
+			}
+
+			info, err := GetSearchShortInfo(url)
+			if err != nil {
+				t.Fatalf("GetSearchShortInfo() unexpected error = %v", err)
+			}
+			if info != tt.wantInfo {
+				t.Errorf("GetSearchShortInfo() = %q, want %q", info, tt.wantInfo)
+			}
+			if _, err := GetSearchFullInfo(url); err != nil {
+				t.Errorf("GetSearchFullInfo() unexpected error = %v", err)
+			}
+		})
+	}
+}
+
+func TestImageHash(t *testing.T) {
+	// Gradient with a dark square, optionally mirrored
+	draw := func(width, height int, mirrored bool) []byte {
+		img := image.NewRGBA(image.Rect(0, 0, width, height))
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				px := x
+				if mirrored {
+					px = width - 1 - x
+				}
+				v := uint8(255 * px / width)
+				if px > width/4 && px < width/2 && y > height/4 && y < height/2 {
+					v = 0
+				}
+				img.Set(x, y, color.RGBA{v, v, 255 - v, 255})
+			}
+		}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, nil); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	large, err := ImageHash(draw(640, 480, false))
+	if err != nil {
+		t.Fatalf("ImageHash() error = %v", err)
+	}
+	small, err := ImageHash(draw(160, 120, false))
+	if err != nil {
+		t.Fatalf("ImageHash() error = %v", err)
+	}
+	other, err := ImageHash(draw(640, 480, true))
+	if err != nil {
+		t.Fatalf("ImageHash() error = %v", err)
+	}
+
+	threshold := DefaultDuplicateDetector.Thresholds.MaxHashDistance
+	if d := HashDistance(large, small); d > threshold {
+		t.Errorf("distance of the resized image = %d, want <= %d", d, threshold)
+	}
+	if d := HashDistance(large, other); d <= threshold {
+		t.Errorf("distance of a different image = %d, want > %d", d, threshold)
+	}
+	if _, err := ImageHash([]byte("not an image")); err == nil {
+		t.Error("ImageHash() expected an error for invalid data")
+	}
+}
+
+func TestStreetAddress(t *testing.T) {
+	tests := []struct {
+		location string
+		want     bool
+	}{
+		{"ul. Puławska, Mokotów, Warszawa", true},
+		{"Kraków, al. Pokoju", true},
+		{"Poznań, os. Piastowskie", true},
+		{"Warszawa, Mokotów", false},
+		{"Warszawa, ul.", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := streetAddress(tt.location); got != tt.want {
+			t.Errorf("streetAddress(%q) = %v, want %v", tt.location, got, tt.want)
+		}
+	}
+}
+
+func TestDuplicateDetector(t *testing.T) {
+	olx := Offer{
+		Url:      "https://www.olx.pl/d/oferta/mieszkanie-ID1.html",
+		Location: "Warszawa, Mokotów, ul. Puławska",
+		Price:    3200,
+		Rooms:    "Liczba pokoi: 2 pokoje",
+		Area:     "Powierzchnia: 48 m²",
+		Floor:    "Poziom: 3",
+	}
+	otodom := Offer{
+		Url:               "https://www.otodom.pl/pl/oferta/mieszkanie-ID2",
+		Location:          "ul. Puławska, Mokotów, Warszawa, mazowieckie",
+		Price:             2700,
+		AdditionalPayment: 500,
+		Rooms:             "Liczba pokoi: 2",
+		Area:              "Powierzchnia: 48,2 m²",
+		Floor:             "Piętro: 3/5",
+	}
+
+	// Offers only naming the district are the same apartment only if their images match
+	districtImages := olx
+	districtImages.Location, districtImages.ImageHashes = "Warszawa, Mokotów", []uint64{0xff00ff00ff00ff00, 0x0f0f0f0f0f0f0f0f, 0x3333333333333333}
+	otodomImages := otodom
+	otodomImages.ImageHashes = []uint64{0xff00ff00ff00ff01, 0x0f0f0f0f0f0f0f0e, 0xcccccccccccccccc}
+	// Offers of different apartments often share a photo of the building
+	sharedImage := otodomImages
+	sharedImage.ImageHashes = []uint64{0xff00ff00ff00ff01, 0xf0f0f0f0f0f0f0f0, 0xcccccccccccccccc}
+
+	tests := []struct {
+		name string
+		a, b Offer
+		want bool
+	}{
+		{"same apartment on two sources", olx, otodom, true},
+		{"same url", Offer{Url: olx.Url}, Offer{Url: olx.Url, Price: 1}, true},
+		{"same district only", func() Offer { o := olx; o.Location = "Warszawa, Mokotów"; return o }(), otodom, false},
+		{"same district with matching images", districtImages, otodomImages, true},
+		{"same district with one shared image", districtImages, sharedImage, false},
+		{"other street", olx, func() Offer { o := otodom; o.Location = "ul. Wołoska, Mokotów, Warszawa"; return o }(), false},
+		{"other district", olx, func() Offer { o := otodom; o.Location = "Warszawa, Wola"; return o }(), false},
+		{"other area", olx, func() Offer { o := otodom; o.Area = "Powierzchnia: 60 m²"; return o }(), false},
+		{"other rooms", olx, func() Offer { o := otodom; o.Rooms = "Liczba pokoi: 3"; return o }(), false},
+		{"other floor", olx, func() Offer { o := otodom; o.Floor = "Piętro: parter"; return o }(), false},
+		{"other price", olx, func() Offer { o := otodom; o.Price, o.AdditionalPayment = 4000, 0; return o }(), false},
+		{"too little known", Offer{Url: "a", Location: "Warszawa", Price: 3000}, Offer{Url: "b", Location: "Warszawa", Price: 3000}, false},
+		{
+			"matching images",
+			Offer{Url: "a", Location: "Warszawa", Price: 3000, ImageHashes: []uint64{0xff00ff00ff00ff00, 0x0f0f0f0f0f0f0f0f}},
+			Offer{Url: "b", Location: "Warszawa", Price: 3050, ImageHashes: []uint64{1, 0xff00ff00ff00ff01, 0x0f0f0f0f0f0f0f0f}},
+			true,
+		},
+		{
+			"single matching image",
+			Offer{Url: "a", Location: "Warszawa", Price: 3000, ImageHashes: []uint64{0xff00ff00ff00ff00}},
+			Offer{Url: "b", Location: "Warszawa", Price: 3050, ImageHashes: []uint64{1, 0xff00ff00ff00ff01}},
+			false,
+		},
+		{
+			// The same image posted twice matches one image of the other offer
+			"repeated image",
+			Offer{Url: "a", Location: "Warszawa", Price: 3000, ImageHashes: []uint64{0xff00ff00ff00ff00, 0xff00ff00ff00ff00}},
+			Offer{Url: "b", Location: "Warszawa", Price: 3050, ImageHashes: []uint64{0xff00ff00ff00ff01, 0x0f0f0f0f0f0f0f0f}},
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DefaultDuplicateDetector.IsDuplicate(tt.a, tt.b); got != tt.want {
+				t.Errorf("IsDuplicate() = %v, want %v", got, tt.want)
+			}
+			if got := DefaultDuplicateDetector.IsDuplicate(tt.b, tt.a); got != tt.want {
+				t.Errorf("IsDuplicate() reversed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	other := Offer{Url: "https://gratka.pl/3", Location: "Kraków, Podgórze", Price: 2500, Area: "Powierzchnia: 40 m²", Rooms: "Pokoje: 2"}
+	clusters := DefaultDuplicateDetector.Cluster([]Offer{olx, other, otodom})
+	if len(clusters) != 2 || len(clusters[0]) != 2 || clusters[0][1].Url != otodom.Url || clusters[1][0].Url != other.Url {
+		t.Errorf("Cluster() = %v, want the OLX and Otodom offers together", clusters)
+	}
+}
+
+// Transport sending all the requests to the test server, the responses keep the requested urls.
+type redirectTransport struct {
+	server *httptest.Server
+}
+
+func (t redirectTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	server_request := r.Clone(r.Context())
+	server_request.URL.Scheme, server_request.URL.Host = "http", strings.TrimPrefix(t.server.URL, "http://")
+	resp, err := http.DefaultTransport.RoundTrip(server_request)
+	if resp != nil {
+		resp.Request = r
+	}
+	return resp, err
+}
+
+func TestCheckRemoved(t *testing.T) {
+	// Pages of the offers, by their path
+	pages := map[string]string{
+		"/d/oferta/aktualne-CID3-ID3.html":                                      "olx_offer.html",
+		"/d/oferta/nowy-tytul-CID3-ID5.html":                                    "olx_offer.html",
+		"/d/oferta/nieaktualne-CID3-ID2.html":                                   "olx_removed.html",
+		"/pl/oferta/mieszkanie-przy-parku-ID4bbbb":                              "otodom_offer.html",
+		"/pl/oferta/mieszkanie-nieaktualne-ID4cccc":                             "otodom_removed.html",
+		"/nieruchomosci/mieszkanie-poznan-jezyce-ul-koscielna/ob/31234567":      "gratka_offer.html",
+		"/nieruchomosci/mieszkanie-poznan-jezyce-ul-koscielna/ob/31234568":      "gratka_removed.html",
+		"/oferta/wynajem-mieszkanie-krakow-kazimierz-dietla-40m2-mzn2041234567": "morizon_offer.html",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if file, ok := pages[r.URL.Path]; ok {
+			page, err := os.ReadFile(filepath.Join("testdata", file))
+			if err != nil {
+				t.Error(err)
+			}
+			w.Write(page)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/d/oferta/usuniete-CID3-ID1.html":
+			w.WriteHeader(http.StatusNotFound)
+		case "/d/oferta/stary-tytul-CID3-ID5.html":
+			http.Redirect(w, r, "/d/oferta/nowy-tytul-CID3-ID5.html", http.StatusMovedPermanently)
+		case "/d/oferta/przekierowane-CID3-ID6.html":
+			http.Redirect(w, r, "/nieruchomosci/mieszkania/wynajem/warszawa/", http.StatusFound)
+		case "/nieruchomosci/mieszkania/wynajem/warszawa/":
+			w.Write([]byte(`<html><div class="css-1sw7q4x"><a href="/d/oferta/kawalerka-CID3-ID8.html"><h4>Kawalerka</h4></a></div></html>`))
+		case "/d/oferta/nieznane-CID3-ID7.html":
+			// The notice in a script is not shown to the users
+			w.Write([]byte(`<html><script>var notice = "Ogłoszenie nieaktualne";</script><h4>Mieszkanie</h4></html>`))
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	var delays []time.Duration
+	fetcher := newTestFetcher(&delays)
+	fetcher.MaxRetries = 0
+	fetcher.Client = &http.Client{Transport: redirectTransport{server}}
+	defaultFetcher := DefaultFetcher
+	DefaultFetcher = fetcher
+	defer func() { DefaultFetcher = defaultFetcher }()
+
+	tests := []struct {
+		url     string
+		want    bool
+		wantErr bool
+	}{
+		{"https://www.olx.pl/d/oferta/usuniete-CID3-ID1.html", true, false},
+		{"https://www.olx.pl/d/oferta/nieaktualne-CID3-ID2.html", true, false},
+		// The live pages link to reporting outdated offers and have the notices in their scripts
+		{"https://www.olx.pl/d/oferta/aktualne-CID3-ID3.html", false, false},
+		{"https://www.olx.pl/d/oferta/blad-CID3-ID4.html", false, true},
+		// Offers are redirected to their new url after a change of the title
+		{"https://www.olx.pl/d/oferta/stary-tytul-CID3-ID5.html", false, false},
+		// Taken down offers are redirected to the search results
+		{"https://www.olx.pl/d/oferta/przekierowane-CID3-ID6.html", true, false},
+		{"https://www.olx.pl/d/oferta/nieznane-CID3-ID7.html", false, true},
+		{"https://www.otodom.pl/pl/oferta/mieszkanie-przy-parku-ID4bbbb", false, false},
+		{"https://www.otodom.pl/pl/oferta/mieszkanie-nieaktualne-ID4cccc", true, false},
+		{"https://gratka.pl/nieruchomosci/mieszkanie-poznan-jezyce-ul-koscielna/ob/31234567", false, false},
+		{"https://gratka.pl/nieruchomosci/mieszkanie-poznan-jezyce-ul-koscielna/ob/31234568", true, false},
+		{"https://www.morizon.pl/oferta/wynajem-mieszkanie-krakow-kazimierz-dietla-40m2-mzn2041234567", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			got, err := CheckRemoved(Offer{Url: tt.url})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckRemoved() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("CheckRemoved() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Names of the query parameters of a portal search url.
+type searchParams struct {
+	PriceMin string
+	PriceMax string
+	AreaMin  string
+	AreaMax  string
+	RoomsMin string
+	RoomsMax string
+}
+
+// Source of offers from a portal whose search url is made of a city specific
+// path and query parameters. The pages are parsed with the selectors of the
+// configuration registered under the name of the source.
+//
+// Attributes:
+//
+//	name: The name of the source.
+//	displayName: The name of the portal shown to the users.
+//	host: The host of the portal, its subdomains match as well.
+//	order: The query parameter sorting the results from the newest.
+//	pageParam: The name of the query parameter of the page number.
+//	params: The names of the filter query parameters.
+//	cityUrl: Builds the search url of the city, without the query.
+//	city: Extracts the city code from the search url.
+//	listingId: Matches the id of the offer in its url as the first group.
+type portalSource struct {
+	name        string
+	displayName string
+	host        string
+	order       string
+	pageParam   string
+	params      searchParams
+	cityUrl     func(city string) (string, error)
+	city        func(u *url.URL) string
+	listingId   *regexp.Regexp
+}
+
+func (p portalSource) Name() string {
+	return p.name
+}
+
+func (p portalSource) DisplayName() string {
+	return p.displayName
+}
+
+func (p portalSource) Match(url_string string) bool {
+	u, err := url.Parse(url_string)
+	if err != nil || u.Scheme != "https" {
+		return false
+	}
+	host := strings.TrimPrefix(u.Hostname(), "www.")
+	return host == p.host || strings.HasSuffix(host, "."+p.host)
+}
+
+func (p portalSource) ParseSearchPage(text string) ([]Offer, error) {
+	return parseCards(text, GetConfig(p.name))
+}
+
+func (p portalSource) PageUrl(url string, page int) string {
+	return setQueryPage(url, p.pageParam, page)
+}
+
+func (p portalSource) ListingId(url string) string {
+	if match := p.listingId.FindStringSubmatch(url); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+func (p portalSource) ParseOffer(offer Offer) Offer {
+	text, err := FetchHTMLPage(offer.Url)
+	if err != nil {
+		log.Printf("Error fetching the %s page: %v", p.displayName, err)
+		return offer
+	}
+
+	parsed, err := parseDetailPage(offer, text, GetConfig(p.name))
+	if err != nil {
+		log.Printf("Error parsing the %s page: %v", p.displayName, err)
+		return offer
+	}
+	return parsed
+}
+
+// Generate the URL of the search results page of the portal for the given search term.
+func (p portalSource) CreateUrl(searchTerm SearchTerm) (string, error) {
+	if searchTerm.Location == "" {
+		return "", errors.New("No location specified in search term.")
+	}
+
+	base, err := p.cityUrl(searchTerm.Location)
+	if err != nil {
+		return "", err
+	}
+
+	var builder strings.Builder
+	builder.WriteString(base)
+	builder.WriteString("?" + p.order)
+
+	filters := []struct {
+		name  string
+		value float64
+	}{
+		{p.params.PriceMin, searchTerm.Price_min},
+		{p.params.PriceMax, searchTerm.Price_max},
+		{p.params.AreaMin, searchTerm.Size_min},
+		{p.params.AreaMax, searchTerm.Size_max},
+	}
+	for _, filter := range filters {
+		if filter.value != 0 {
+			fmt.Fprintf(&builder, "&%s=%g", filter.name, filter.value)
+		}
+	}
+
+	// The portals filter by a range of rooms instead of a list
+	if min, max, ok := roomsRange(searchTerm.Bedrooms); ok {
+		fmt.Fprintf(&builder, "&%s=%d", p.params.RoomsMin, min)
+		if max != 0 {
+			fmt.Fprintf(&builder, "&%s=%d", p.params.RoomsMax, max)
+		}
+	}
+
+	return builder.String(), nil
+}
+
+func (p portalSource) ParseUrl(url_string string) (SearchTerm, error) {
+	u, err := url.Parse(url_string)
+	if err != nil {
+		return SearchTerm{}, err
+	}
+
+	searchTerm := SearchTerm{Location: p.city(u)}
+
+	q := u.Query()
+	searchTerm.Price_min = queryNumber(q, p.params.PriceMin)
+	searchTerm.Price_max = queryNumber(q, p.params.PriceMax)
+	searchTerm.Size_min = queryNumber(q, p.params.AreaMin)
+	searchTerm.Size_max = queryNumber(q, p.params.AreaMax)
+	searchTerm.Bedrooms = roomCodes(int(queryNumber(q, p.params.RoomsMin)), int(queryNumber(q, p.params.RoomsMax)))
+
+	return searchTerm, nil
+}
+
+func (p portalSource) NormalizeUrl(url_string string) (string, error) {
+	if p.ListingId(url_string) != "" {
+		return "", errors.New("not a " + p.displayName + " search url: " + url_string)
+	}
+	return normalizeQuery(url_string, []string{p.order}, p.pageParam), nil
+}
+
+// The portals are searched by the price, the area and the rooms only.
+func (p portalSource) Filters() []Filter {
+	return []Filter{FilterRooms, FilterArea}
+}
+
+func (p portalSource) SearchShortInfo(url_string string) (string, error) {
+	searchTerm, err := p.ParseUrl(url_string)
+	if err != nil {
+		return "", err
+	}
+	return searchShortInfo(searchTerm), nil
+}
+
+func (p portalSource) SearchFullInfo(url_string string) (string, error) {
+	searchTerm, err := p.ParseUrl(url_string)
+	if err != nil {
+		return "", err
+	}
+	return searchFullInfo(searchTerm, p.displayName, url_string), nil
+}
+
+// Convert the OLX room codes ("one", "two", ...) to a range of the number of rooms.
+//
+// Parameters:
+//
+//	bedrooms: The room codes of the search term.
+//
+// Returns:
+//
+//	The minimum and the maximum number of rooms, 0 if there is no maximum.
+//	False if no valid room code was given.
+func roomsRange(bedrooms []string) (int, int, bool) {
+	min, max, ok := 0, 0, false
+	unbounded := false
+
+	for _, bedroom := range bedrooms {
+		number, found := otodomNumbers[strings.ToUpper(bedroom)]
+		if !found {
+			continue
+		}
+		rooms, err := strconv.Atoi(strings.TrimSuffix(number, "+"))
+		if err != nil {
+			continue
+		}
+		unbounded = unbounded || strings.HasSuffix(number, "+")
+
+		if !ok || rooms < min {
+			min = rooms
+		}
+		if rooms > max {
+			max = rooms
+		}
+		ok = true
+	}
+
+	if unbounded {
+		max = 0
+	}
+	return min, max, ok
+}
+
+// Convert a range of the number of rooms to the OLX room codes, the inverse of roomsRange.
+// The last code ("four") stands for four rooms or more.
+//
+// Parameters:
+//
+//	min: The minimum number of rooms, 0 if there is no minimum.
+//	max: The maximum number of rooms, 0 if there is no maximum.
+//
+// Returns:
+//
+//	The room codes, nil if the range does not limit the rooms.
+func roomCodes(min, max int) []string {
+	if min <= 0 && max <= 0 {
+		return nil
+	}
+	codes := []string{"one", "two", "three", "four"}
+	if min < 1 {
+		min = 1
+	}
+	if max <= 0 || max > len(codes) {
+		max = len(codes)
+	}
+	if min > len(codes) {
+		min = len(codes)
+	}
+
+	result := make([]string, 0, max-min+1)
+	for rooms := min; rooms <= max; rooms++ {
+		result = append(result, codes[rooms-1])
+	}
+	return result
+}
+
+// Capitalize the first letter of the text.
+func capitalize(text string) string {
+	if text == "" {
+		return ""
+	}
+	return strings.ToUpper(text[:1]) + text[1:]
+}
+
+// Get the path segment of the url with the given index, empty if there is no such segment.
+func pathSegment(u *url.URL, index int) string {
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if index < 0 {
+		index += len(parts)
+	}
+	if index < 0 || index >= len(parts) {
+		return ""
+	}
+	return parts[index]
+}
+
+// Get the voivodeship of the city code, e.g. "wielkopolskie" for "poznan".
+func voivodeship(city string) (string, error) {
+	location, ok := otodomLocations[city]
+	if !ok {
+		return "", errors.New("unsupported location: " + city)
+	}
+	return strings.ReplaceAll(strings.Split(location, "/")[0], "--", "-"), nil
+}
@@ -0,0 +1,194 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Selectors of a source as stored in the selectors file.
+// Missing selectors keep the built-in defaults of the source.
+//
+// Example of the file:
+//
+//	{
+//	    "olx": {
+//	        "offer": {"tag": "div", "attribute": "data-cy", "value": "l-card"},
+//	        "description": {"tag": "div", "attribute": "data-cy", "value": "ad_description"}
+//	    }
+//	}
+type Selectors struct {
+	Offer          *Selector `json:"offer,omitempty"`
+	Promoted       *Selector `json:"promoted,omitempty"`
+	Title          *Selector `json:"title,omitempty"`
+	Price          *Selector `json:"price,omitempty"`
+	Location       *Selector `json:"location,omitempty"`
+	URL            *Selector `json:"url,omitempty"`
+	Description    *Selector `json:"description,omitempty"`
+	Parameter      *Selector `json:"parameter,omitempty"`
+	ParameterLabel *Selector `json:"parameter_label,omitempty"`
+	Image          *Selector `json:"image,omitempty"`
+}
+
+// Configurations of the sources, built-in defaults overridden by the selectors file
+var (
+	configsMutex   sync.RWMutex
+	defaultConfigs = make(map[string]ExtractorConfig)
+	configs        = make(map[string]ExtractorConfig)
+)
+
+// Register the default configuration of the source with the given name.
+func registerConfig(name string, config ExtractorConfig) {
+	configsMutex.Lock()
+	defer configsMutex.Unlock()
+
+	defaultConfigs[name] = config
+	configs[name] = config
+}
+
+// Get the current configuration of the source.
+//
+// Parameters:
+//
+//	name: The name of the source, e.g. "olx".
+//
+// Returns:
+//
+//	The configuration with the selectors from the selectors file applied.
+func GetConfig(name string) ExtractorConfig {
+	configsMutex.RLock()
+	defer configsMutex.RUnlock()
+
+	return configs[name]
+}
+
+// Enable or disable skipping the offers of the source not posted today.
+// The setting is kept when the selectors file is reloaded.
+//
+// Parameters:
+//
+//	name: The name of the source, e.g. "olx".
+//	enabled: True to skip the offers not posted today.
+//
+// Returns:
+//
+//	An error if the source is unknown.
+func SetTodayOnly(name string, enabled bool) error {
+	configsMutex.Lock()
+	defer configsMutex.Unlock()
+
+	config, ok := defaultConfigs[name]
+	if !ok {
+		return errors.New("unknown source: " + name)
+	}
+	config.TodayOnly = enabled
+	defaultConfigs[name] = config
+
+	config = configs[name]
+	config.TodayOnly = enabled
+	configs[name] = config
+	return nil
+}
+
+// Apply the selectors over the configuration.
+func (selectors Selectors) apply(config ExtractorConfig) ExtractorConfig {
+	fields := []struct {
+		from *Selector
+		to   *Selector
+	}{
+		{selectors.Offer, &config.OfferSelector},
+		{selectors.Promoted, &config.PromotedSelector},
+		{selectors.Title, &config.TitleSelector},
+		{selectors.Price, &config.PriceSelector},
+		{selectors.Location, &config.LocationSelector},
+		{selectors.URL, &config.URLSelector},
+		{selectors.Description, &config.DescriptionSelector},
+		{selectors.Parameter, &config.ParameterSelector},
+		{selectors.ParameterLabel, &config.ParameterLabelSelector},
+		{selectors.Image, &config.ImageSelector},
+	}
+	for _, field := range fields {
+		if field.from != nil {
+			*field.to = *field.from
+		}
+	}
+	return config
+}
+
+// Load the selectors of the sources from the given JSON file.
+// The configurations are replaced only if the whole file is valid,
+// sources missing in the file are reset to their defaults.
+//
+// Parameters:
+//
+//	path: The path of the selectors file.
+//
+// Returns:
+//
+//	An error if the file could not be read, decoded or names an unknown source.
+func LoadSelectors(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var file map[string]Selectors
+	if err := json.Unmarshal(data, &file); err != nil {
+		return err
+	}
+
+	configsMutex.Lock()
+	defer configsMutex.Unlock()
+
+	loaded := make(map[string]ExtractorConfig)
+	for name, config := range defaultConfigs {
+		loaded[name] = config
+	}
+	for name, selectors := range file {
+		config, ok := defaultConfigs[name]
+		if !ok {
+			return errors.New("selectors for unknown source: " + name)
+		}
+		loaded[name] = selectors.apply(config)
+	}
+
+	configs = loaded
+	return nil
+}
+
+// Reload the selectors file whenever it changes.
+// Invalid files are logged and the previous selectors are kept. Never returns.
+//
+// Parameters:
+//
+//	path: The path of the selectors file.
+//	interval: The time between the checks of the file.
+func WatchSelectors(path string, interval time.Duration) {
+	var modified time.Time
+	if info, err := os.Stat(path); err == nil {
+		modified = info.ModTime()
+	}
+
+	for {
+		time.Sleep(interval)
+
+		info, err := os.Stat(path)
+		if err != nil {
+			log.Printf("Error checking the selectors file: %v", err)
+			continue
+		}
+		if info.ModTime().Equal(modified) {
+			continue
+		}
+		modified = info.ModTime()
+
+		if err := LoadSelectors(path); err != nil {
+			log.Printf("Error reloading the selectors file: %v", err)
+			continue
+		}
+		log.Printf("Reloaded the selectors from %s", path)
+	}
+}
@@ -0,0 +1,767 @@
+package parser
+
+import (
+	"errors"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Source of apartment offers, e.g. a listing portal.
+//
+// Every supported portal implements this interface in its own file
+// and registers itself with RegisterSource in an init function.
+type Source interface {
+	// Name returns the unique name of the source, e.g. "olx".
+	Name() string
+
+	// DisplayName returns the name of the portal shown to the users, e.g. "OLX".
+	DisplayName() string
+
+	// Match reports whether the given url belongs to the source.
+	Match(url string) bool
+
+	// ParseSearchPage extracts all the offers from the HTML code of a search results page.
+	ParseSearchPage(text string) ([]Offer, error)
+
+	// ListingId extracts the id of the offer from its url, empty if the url does not contain it.
+	ListingId(url string) string
+
+	// ParseOffer follows the url of the offer and extracts the missing data.
+	ParseOffer(offer Offer) Offer
+
+	// PageUrl returns the url of the given page of the search results, counting from 1.
+	PageUrl(url string, page int) string
+
+	// CreateUrl generates the URL of a search results page for the given search term.
+	CreateUrl(searchTerm SearchTerm) (string, error)
+
+	// ParseUrl extracts the search term from a search url generated by CreateUrl,
+	// the location is empty if the url does not name a city.
+	ParseUrl(url string) (SearchTerm, error)
+
+	// NormalizeUrl validates a search url pasted by a user and returns it sorted from the newest offers,
+	// without the tracking and the page parameters.
+	NormalizeUrl(url string) (string, error)
+
+	// Filters returns the optional filters of the search term supported by CreateUrl.
+	Filters() []Filter
+
+	// SearchShortInfo returns a one line summary of the search url.
+	SearchShortInfo(url string) (string, error)
+
+	// SearchFullInfo returns a detailed HTML description of the search url.
+	SearchFullInfo(url string) (string, error)
+}
+
+// Optional filter of a search term.
+type Filter string
+
+// Optional filters of a search term, supported by some of the sources.
+const (
+	FilterRooms     Filter = "rooms"
+	FilterArea      Filter = "area"
+	FilterFloors    Filter = "floors"
+	FilterFurnished Filter = "furnished"
+	FilterPets      Filter = "pets"
+	FilterElevator  Filter = "elevator"
+)
+
+// Check if the source supports the filter.
+//
+// Parameters:
+//
+//	source: The source to check.
+//	filter: The filter to check.
+//
+// Returns:
+//
+//	True if CreateUrl of the source uses the filter, false otherwise.
+func SupportsFilter(source Source, filter Filter) bool {
+	for _, f := range source.Filters() {
+		if f == filter {
+			return true
+		}
+	}
+	return false
+}
+
+// Describe the apartment features required by a search, e.g. "✨ Furnished, Elevator".
+//
+// Returns:
+//
+//	The line describing the features, empty if no feature is required.
+func featuresToText(furnished, pets, elevator bool) string {
+	features := make([]string, 0)
+	if furnished {
+		features = append(features, "Furnished")
+	}
+	if pets {
+		features = append(features, "Pets allowed")
+	}
+	if elevator {
+		features = append(features, "Elevator")
+	}
+	if len(features) == 0 {
+		return ""
+	}
+	return "✨ " + strings.Join(features, ", ") + "\n"
+}
+
+// Name of the source used when the search term does not specify one.
+const DefaultSource = "olx"
+
+// Registered sources in the order of registration.
+var sources = make([]Source, 0)
+
+// Register a new source of offers.
+// Panics if a source with the same name is already registered.
+//
+// Parameters:
+//
+//	source: The source to register.
+func RegisterSource(source Source) {
+	for _, s := range sources {
+		if s.Name() == source.Name() {
+			panic("parser: source " + source.Name() + " registered twice")
+		}
+	}
+	sources = append(sources, source)
+}
+
+// List all the registered sources.
+//
+// Returns:
+//
+//	The registered sources in the order of registration.
+func Sources() []Source {
+	return append([]Source(nil), sources...)
+}
+
+// Find the source the given url belongs to.
+//
+// Parameters:
+//
+//	url: The url of a search or an offer.
+//
+// Returns:
+//
+//	The matching source and an error if no source matches the url.
+func FindSource(url string) (Source, error) {
+	for _, source := range sources {
+		if source.Match(url) {
+			return source, nil
+		}
+	}
+	return nil, errors.New("unsupported url: " + url)
+}
+
+// Get the source with the given name.
+//
+// Parameters:
+//
+//	name: The name of the source, e.g. "olx".
+//
+// Returns:
+//
+//	The source and an error if no source with such name is registered.
+func GetSource(name string) (Source, error) {
+	for _, source := range sources {
+		if source.Name() == name {
+			return source, nil
+		}
+	}
+	return nil, errors.New("unknown source: " + name)
+}
+
+// Parse the HTML code of a search results page using the source the url belongs to.
+//
+// Parameters:
+//
+//	url: The url of the search results page.
+//	text: The HTML code of the page.
+//
+// Returns:
+//
+//	The offers extracted from the page and an error if the url is not supported.
+func ParseSearchPage(url, text string) ([]Offer, error) {
+	source, err := FindSource(url)
+	if err != nil {
+		return nil, err
+	}
+
+	offers, err := source.ParseSearchPage(text)
+	if err != nil {
+		return nil, err
+	}
+	DefaultHealthMonitor.RecordSearchPage(source.Name(), offers)
+	if len(offers) == 0 {
+		log.Printf("No offers found on %s", url)
+	}
+
+	// Search pages may link to offers hosted by other sources
+	for i := range offers {
+		offerSource, err := FindSource(offers[i].Url)
+		if err != nil {
+			offerSource = source
+		}
+		offers[i].Source = offerSource.Name()
+		if offers[i].ListingId == "" {
+			offers[i].ListingId = offerSource.ListingId(offers[i].Url)
+		}
+	}
+	return offers, nil
+}
+
+// Get the key identifying the offer, its source and listing id if known, its url otherwise.
+func (offer Offer) identity() string {
+	if offer.ListingId != "" {
+		return offer.Source + "|" + offer.ListingId
+	}
+	return offer.Url
+}
+
+// Check if the offers are the same listing of a source,
+// even if their titles, prices or urls changed.
+//
+// Parameters:
+//
+//	other: The offer to compare with.
+//
+// Returns:
+//
+//	True if the offers have the same source and listing id or the same url.
+func (offer Offer) SameListing(other Offer) bool {
+	if offer.Url != "" && offer.Url == other.Url {
+		return true
+	}
+	return offer.ListingId != "" && offer.identity() == other.identity()
+}
+
+// Fetch and parse the pages of the search results until a known offer is found.
+// Pages are followed using the pagination of the source the url belongs to,
+// stopping after the first page with a known offer, an empty page or maxPages pages.
+//
+// Parameters:
+//
+//	url: The url of the search.
+//	maxPages: The maximum number of pages to fetch, at least one page is always fetched.
+//	known: Reports whether the offer was already processed, e.g. stored in the database.
+//
+// Returns:
+//
+//	The offers from all the fetched pages without duplicates and an error if the first page could not be fetched.
+func FetchSearchOffers(url string, maxPages int, known func(Offer) (bool, error)) ([]Offer, error) {
+	source, err := FindSource(url)
+	if err != nil {
+		return nil, err
+	}
+
+	offers := make([]Offer, 0)
+	seen := make(map[string]bool)
+
+	for page := 1; page == 1 || page <= maxPages; page++ {
+		pageUrl := source.PageUrl(url, page)
+		// Search results change between the polls, so they are never cached
+		text, err := fetchHTMLPage(pageUrl, false)
+		if err != nil {
+			if page == 1 {
+				return nil, err
+			}
+			log.Printf("Error fetching page %d of %s: %v", page, url, err)
+			break
+		}
+
+		pageOffers, err := ParseSearchPage(pageUrl, text)
+		if err != nil {
+			if page == 1 {
+				return nil, err
+			}
+			log.Printf("Error parsing page %d of %s: %v", page, url, err)
+			break
+		}
+
+		reachedKnown := len(pageOffers) == 0
+		for _, offer := range pageOffers {
+			// Offers may move to the next page between the requests
+			if seen[offer.identity()] {
+				continue
+			}
+			seen[offer.identity()] = true
+			offers = append(offers, offer)
+
+			exists, err := known(offer)
+			if err != nil {
+				return offers, err
+			}
+			reachedKnown = reachedKnown || exists
+		}
+
+		if reachedKnown {
+			break
+		}
+	}
+
+	return offers, nil
+}
+
+// Matches the notices shown by the sources on the pages of taken down offers,
+// e.g. "Ogłoszenie nieaktualne" or "To ogłoszenie nie jest już dostępne".
+// The notices are only looked for in the visible text of the pages without the description of the offer.
+var DefaultRemovedPattern = regexp.MustCompile(`(?i)ogłoszenie (jest )?(już )?(nieaktualne|archiwalne|usunięte|zakończone)|ogłoszenie nie jest już dostępne`)
+
+// Check if the offer was taken down from its source.
+// The page of the offer is fetched bypassing the cache, so the checks are rate limited by DefaultFetcher.
+// Pages with the description of the offer found by the DescriptionSelector of the source are live.
+//
+// Parameters:
+//
+//	offer: The offer to check.
+//
+// Returns:
+//
+//	True if the page of the offer is gone, redirects to another page, e.g. the search results,
+//	or shows a notice matching the RemovedPattern of the source instead of the offer,
+//	and an error if the page could not be fetched or shows neither the offer nor the notice.
+func CheckRemoved(offer Offer) (bool, error) {
+	source, err := FindSource(offer.Url)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := fetchHTML(offer.Url, false)
+	if IsStatus(err, http.StatusNotFound) || IsStatus(err, http.StatusGone) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !redirectedToOffer(source, offer.Url, resp.Url) {
+		return true, nil
+	}
+
+	config := GetConfig(source.Name())
+	if config.RemovedPattern == nil {
+		config.RemovedPattern = DefaultRemovedPattern
+	}
+	return offerPageRemoved(offer.Url, string(resp.Body), config)
+}
+
+// Check if the page of the offer was served at the url of the offer, or redirected to another url of the offer.
+// The sources redirect the offers to their current url after a change of the title,
+// and the taken down offers to the search results or the home page.
+//
+// Parameters:
+//
+//	source: The source of the offer.
+//	offer_url: The url of the offer.
+//	page_url: The url of the page after the redirects.
+//
+// Returns:
+//
+//	True if the page is a page of the offer.
+func redirectedToOffer(source Source, offer_url, page_url string) bool {
+	if page_url == "" || page_url == offer_url {
+		return true
+	}
+	if !source.Match(page_url) {
+		return false
+	}
+	if id := source.ListingId(offer_url); id != "" {
+		return source.ListingId(page_url) == id
+	}
+
+	// Offers without a listing id in the url are only redirected within the same path
+	offer, err := url.Parse(offer_url)
+	if err != nil {
+		return false
+	}
+	page, err := url.Parse(page_url)
+	return err == nil && page.Host == offer.Host && page.Path == offer.Path
+}
+
+// Set the page query parameter of the url, used by the sources paginated with "page=N".
+// The first page is the url without the parameter.
+//
+// Parameters:
+//
+//	url: The url of the search.
+//	page: The number of the page, counting from 1.
+//
+// Returns:
+//
+//	The url of the page.
+func setPageParam(url string, page int) string {
+	return setQueryPage(url, "page", page)
+}
+
+// Set the page query parameter with the given name, see setPageParam.
+func setQueryPage(url, name string, page int) string {
+	params := make([]string, 0)
+	if page > 1 {
+		params = append(params, name+"="+strconv.Itoa(page))
+	}
+	return rebuildQuery(url, nil, func(param string) bool { return param != name }, params)
+}
+
+// Rebuild the query of the url with the order parameters first, dropping the tracking parameters,
+// the page parameter and the previous order parameters.
+//
+// Parameters:
+//
+//	url_string: The url to normalize.
+//	order: The parameters sorting the results from the newest, e.g. "by=LATEST".
+//	pageParam: The name of the query parameter of the page number.
+//
+// Returns:
+//
+//	The url with the normalized query.
+func normalizeQuery(url_string string, order []string, pageParam string) string {
+	if i := strings.Index(url_string, "#"); i >= 0 {
+		url_string = url_string[:i]
+	}
+
+	dropped := map[string]bool{pageParam: true}
+	for _, param := range order {
+		dropped[strings.SplitN(param, "=", 2)[0]] = true
+	}
+	return rebuildQuery(url_string, order, func(name string) bool { return !dropped[name] && !isTrackingParam(name) }, nil)
+}
+
+// Rebuild the query of the url from the first parameters, the parameters of the url kept by the filter
+// and the last parameters.
+// The query is rebuilt by hand to keep the order and the encoding of the parameters.
+//
+// Parameters:
+//
+//	url_string: The url with the query.
+//	first: The parameters put before the ones of the url, e.g. "by=LATEST".
+//	keep: Reports whether the parameter of the url with the given decoded name is kept.
+//	last: The parameters put after the ones of the url, e.g. "page=2".
+//
+// Returns:
+//
+//	The url with the rebuilt query, without the question mark if the query is empty.
+func rebuildQuery(url_string string, first []string, keep func(name string) bool, last []string) string {
+	base, query := url_string, ""
+	if i := strings.Index(url_string, "?"); i >= 0 {
+		base, query = url_string[:i], url_string[i+1:]
+	}
+
+	params := append([]string(nil), first...)
+	for _, param := range strings.Split(query, "&") {
+		if param == "" {
+			continue
+		}
+		name := strings.SplitN(param, "=", 2)[0]
+		if decoded, err := url.QueryUnescape(name); err == nil {
+			name = decoded
+		}
+		if keep(name) {
+			params = append(params, param)
+		}
+	}
+	params = append(params, last...)
+
+	if len(params) == 0 {
+		return base
+	}
+	return base + "?" + strings.Join(params, "&")
+}
+
+// Check if the query parameter only tracks the visitor, e.g. "utm_source" or "fbclid".
+func isTrackingParam(name string) bool {
+	return strings.HasPrefix(name, "utm_") || trackingParams[name]
+}
+
+// Parse the given offer by following the url and extracting the missing data.
+//
+// Parameters:
+//
+//	offer: The offer to parse.
+//
+// Returns:
+//
+//	The parsed offer.
+func ParseOffer(offer Offer) Offer {
+	source, err := FindSource(offer.Url)
+	if err != nil {
+		log.Println(err)
+		return offer
+	}
+
+	offer = source.ParseOffer(offer)
+	DefaultHealthMonitor.RecordOfferPage(source.Name(), offer)
+	return offer
+}
+
+// CreateUrl function is used to generate the URL for a given search term.
+// Accepts a SearchTerm struct as input which contains the search term.
+// The URL is built by the source named in the search term, OLX by default.
+// Requires the location to be specified in the search term.
+// Returns the URL as a string and an error.
+//
+// Example:
+//
+//		url, err := CreateUrl(SearchTerm{
+//		    Location: "Poznan",
+//		    Price_min: 1000,
+//		    Price_max: 2000,
+//		    Bedrooms: []string{"2", "3"},
+//	     })
+//		if err != nil {
+//		    // handle error
+//		}
+func CreateUrl(searchTerm SearchTerm) (string, error) {
+	name := searchTerm.Source
+	if name == "" {
+		name = DefaultSource
+	}
+
+	source, err := GetSource(name)
+	if err != nil {
+		return "", err
+	}
+	return source.CreateUrl(searchTerm)
+}
+
+// Extract the search term from the search url, the inverse of CreateUrl.
+// Filters which can not be expressed by a search term are ignored.
+//
+// Parameters:
+//
+//	url_string: The url of the search.
+//
+// Returns:
+//
+//	The search term with the source set and an error if the url is not supported.
+func ParseSearchUrl(url_string string) (SearchTerm, error) {
+	source, err := FindSource(url_string)
+	if err != nil {
+		return SearchTerm{}, err
+	}
+
+	searchTerm, err := source.ParseUrl(url_string)
+	if err != nil {
+		return SearchTerm{}, err
+	}
+	searchTerm.Source = source.Name()
+	return searchTerm, nil
+}
+
+// Extract the search term from the search url, only if CreateUrl recreates the same search from it.
+// Searches with filters which can not be expressed by a search term, e.g. the districts of pasted urls,
+// are rejected, as recreating them would drop the filters and widen the search.
+//
+// Parameters:
+//
+//	url_string: The url of the search.
+//
+// Returns:
+//
+//	The search term with the source set and an error if the url is not supported or can not be recreated.
+func ParseEditableSearchUrl(url_string string) (SearchTerm, error) {
+	searchTerm, err := ParseSearchUrl(url_string)
+	if err != nil {
+		return SearchTerm{}, err
+	}
+
+	recreated, err := CreateUrl(searchTerm)
+	if err != nil {
+		return SearchTerm{}, err
+	}
+	if !sameSearchUrl(url_string, recreated) {
+		return SearchTerm{}, errors.New("the search url has filters which can not be recreated: " + url_string)
+	}
+	return searchTerm, nil
+}
+
+// Check if the urls describe the same search, ignoring the order and the escaping of the query parameters.
+func sameSearchUrl(a, b string) bool {
+	a_url, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	b_url, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	if a_url.Host != b_url.Host || strings.TrimSuffix(a_url.Path, "/") != strings.TrimSuffix(b_url.Path, "/") {
+		return false
+	}
+
+	a_query, b_query := a_url.Query(), b_url.Query()
+	if len(a_query) != len(b_query) {
+		return false
+	}
+	for key, values := range a_query {
+		if !slices.Equal(values, b_query[key]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate a search url pasted by a user and normalize it, see Source.NormalizeUrl.
+// Urls without the scheme or the "www." prefix of the host are accepted as well.
+//
+// Parameters:
+//
+//	url_string: The url of the search.
+//
+// Returns:
+//
+//	The normalized url and an error if the url is not a search url of a supported source.
+func NormalizeSearchUrl(url_string string) (string, error) {
+	url_string = strings.TrimSpace(url_string)
+	if !strings.Contains(url_string, "://") {
+		url_string = "https://" + url_string
+	}
+
+	u, err := url.Parse(url_string)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", errors.New("unsupported url: " + url_string)
+	}
+	u.Scheme = "https"
+	u.Fragment = ""
+
+	source, err := FindSource(u.String())
+	if err != nil && !strings.HasPrefix(u.Host, "www.") {
+		u.Host = "www." + u.Host
+		source, err = FindSource(u.String())
+	}
+	if err != nil {
+		return "", err
+	}
+	return source.NormalizeUrl(u.String())
+}
+
+// Get a one line summary of the search term, e.g. "Poznan(1000-2000) ".
+func searchShortInfo(searchTerm SearchTerm) string {
+	text := locationName(searchTerm.Location) + "(" + formatNumber(searchTerm.Price_min)
+	if searchTerm.Price_max != 0 {
+		text += "-" + formatNumber(searchTerm.Price_max)
+	}
+	return text + ") "
+}
+
+// Get a detailed HTML description of the search term.
+//
+// Parameters:
+//
+//	searchTerm: The search term to describe.
+//	name: The name of the source shown to the users.
+//	url_string: The url of the search, linked at the end.
+//
+// Returns:
+//
+//	The description of the search.
+func searchFullInfo(searchTerm SearchTerm, name, url_string string) string {
+	text := "🏠 Full info of the search (" + name + "):\n\n"
+	text += "📍 " + locationName(searchTerm.Location) + "\n"
+
+	text += "💰 Price: " + formatNumber(searchTerm.Price_min)
+	if searchTerm.Price_max != 0 {
+		text += " - " + formatNumber(searchTerm.Price_max)
+	}
+	text += "\n"
+
+	if searchTerm.Size_min != 0 || searchTerm.Size_max != 0 {
+		text += "📐 Area: "
+		if searchTerm.Size_min != 0 {
+			text += formatNumber(searchTerm.Size_min)
+		}
+		text += "-"
+		if searchTerm.Size_max != 0 {
+			text += formatNumber(searchTerm.Size_max)
+		}
+		text += " m²\n"
+	}
+
+	if len(searchTerm.Bedrooms) > 0 {
+		bedrooms := make([]string, len(searchTerm.Bedrooms))
+		for i, bedroom := range searchTerm.Bedrooms {
+			bedrooms[i] = capitalize(bedroom)
+		}
+		text += "🛏 Bedrooms:\n    - " + strings.Join(bedrooms, ", ") + "\n"
+	}
+
+	if len(searchTerm.Floors) > 0 {
+		floors := make([]string, len(searchTerm.Floors))
+		for i, floor := range searchTerm.Floors {
+			floors[i] = floorEncodings[floor]
+		}
+		text += "🏢 Floors:\n    - " + strings.Join(floors, ", ") + "\n"
+	}
+
+	text += featuresToText(searchTerm.Furnished, searchTerm.Pets, searchTerm.Elevator)
+
+	// Print the url as an hyperlink
+	text += "\n🔗 <a href=\"" + html.EscapeString(url_string) + "\">Link to the search</a>"
+
+	return text
+}
+
+// Get the capitalized name of the location, "Poland" if the search has no location.
+func locationName(location string) string {
+	if location == "" {
+		return "Poland"
+	}
+	return capitalize(location)
+}
+
+// Format the number of the search term without trailing zeros, e.g. "1500" or "45.5".
+func formatNumber(number float64) string {
+	return strconv.FormatFloat(number, 'f', -1, 64)
+}
+
+// Get the number in the query parameter, 0 if it is missing or invalid.
+func queryNumber(q url.Values, name string) float64 {
+	number, err := strconv.ParseFloat(q.Get(name), 64)
+	if err != nil {
+		return 0
+	}
+	return number
+}
+
+// Get a one line summary of the search url, e.g. "Poznan(1000-2000) ".
+//
+// Parameters:
+//
+//	url_string: The url of the search.
+//
+// Returns:
+//
+//	The summary and an error if the url is not supported.
+func GetSearchShortInfo(url_string string) (string, error) {
+	source, err := FindSource(url_string)
+	if err != nil {
+		return "", err
+	}
+	return source.SearchShortInfo(url_string)
+}
+
+// Get a detailed HTML description of the search url.
+//
+// Parameters:
+//
+//	url_string: The url of the search.
+//
+// Returns:
+//
+//	The description and an error if the url is not supported.
+func GetSearchFullInfo(url_string string) (string, error) {
+	source, err := FindSource(url_string)
+	if err != nil {
+		return "", err
+	}
+	return source.SearchFullInfo(url_string)
+}
@@ -1,14 +1,7 @@
 package parser
 
 import (
-	"encoding/json"
-	"errors"
-	"fmt"
-	"io"
 	"net/http"
-	"net/url"
-	"strconv"
-	"strings"
 )
 
 // Struct to hold the search term.
@@ -20,17 +13,29 @@ import (
 //   - bedrooms: 3
 //   - size_min: 100
 //   - size_max: 200
+//
+// Source is the name of the source to search in, OLX if empty.
+// Bedrooms are the OLX room codes ("one", "two", "three", "four")
+// and Floors the OLX floor codes ("floor_0", "floor_1", ..., "floor_17").
+// Filters not supported by the source, see Source.Filters, are ignored.
 type SearchTerm struct {
+	Source    string
 	Location  string
 	Price_min float64
 	Price_max float64
 	Bedrooms  []string
 	Size_min  float64
 	Size_max  float64
+	Floors    []string
+	Furnished bool
+	Pets      bool
+	Elevator  bool
 }
 
 // FetchHTMLPage fetches the HTML page from the given URL
 // and returns the HTML page as a string.
+// The page is fetched with DefaultFetcher, retrying temporary failures,
+// and served from its cache if the page was fetched recently.
 // If an error occurs, it returns an empty string and the error.
 //
 // Example:
@@ -40,232 +45,43 @@ type SearchTerm struct {
 //	    // handle error
 //	}
 func FetchHTMLPage(url_string string) (string, error) {
-	req, err := http.NewRequest("GET", url_string, nil)
-	if err != nil {
-		return "", err
-	}
-	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64; rv:123.0) Gecko/20100101 Firefox/123.0")
-	req.Header.Set("Accept", "text/html")
-	req.Header.Set("TZ", "Europe/Warsaw")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
-	} else if resp.StatusCode != 200 {
-		return "", errors.New("Status code: " + strconv.Itoa(resp.StatusCode))
-	}
-
-	defer resp.Body.Close()
+	return fetchHTMLPage(url_string, true)
+}
 
-	body, err := io.ReadAll(resp.Body)
+// Fetch the HTML page, optionally bypassing the cache for pages which change often.
+func fetchHTMLPage(url_string string, cached bool) (string, error) {
+	resp, err := fetchHTML(url_string, cached)
 	if err != nil {
 		return "", err
 	}
 
-	return string(body), nil
-}
-
-// CreateUrl function is used to generate the URL for a given search term.
-// Accepts a SearchTerm struct as input which contains the search term.
-// Requires the location to be specified in the search term.
-// Returns the URL as a string and an error.
-//
-// Example:
-//
-//		url, err := CreateUrl(SearchTerm{
-//		    Location: "Poznan",
-//		    Price_min: 1000,
-//		    Price_max: 2000,
-//		    Bedrooms: []string{"2", "3"},
-//	     })
-//		if err != nil {
-//		    // handle error
-//		}
-func CreateUrl(searchTerm SearchTerm) (string, error) {
-	var builder strings.Builder
-	builder.WriteString("https://www.olx.pl/nieruchomosci/mieszkania/wynajem/")
-
-	// Check if the search term has a location.
-	if searchTerm.Location == "" {
-		return "", errors.New("No location specified in search term.")
-	}
-	builder.WriteString(searchTerm.Location)
-	builder.WriteString("/q-mieszkanie/?search[order]=created_at:desc")
-
-	if searchTerm.Price_min != 0 {
-		fmt.Fprintf(&builder, "&search[filter_float_price:from]=%g", searchTerm.Price_min)
-	}
-
-	if searchTerm.Price_max != 0 {
-		fmt.Fprintf(&builder, "&search[filter_float_price:to]=%g", searchTerm.Price_max)
-	}
-
-	if searchTerm.Size_min != 0 {
-		fmt.Fprintf(&builder, "&search[filter_float_m:from]=%g", searchTerm.Size_min)
-	}
-
-	if searchTerm.Size_max != 0 {
-		fmt.Fprintf(&builder, "&search[filter_float_m:to]=%g", searchTerm.Size_max)
-	}
-
-	if len(searchTerm.Bedrooms) > 0 {
-		values := make([]string, len(searchTerm.Bedrooms))
-		for i, bedroom := range searchTerm.Bedrooms {
-			values[i] = "search[filter_enum_rooms][" + strconv.Itoa(i) + "]=" + bedroom
-		}
-		builder.WriteString("&")
-		builder.WriteString(strings.Join(values, "&"))
-	}
-
-	return builder.String(), nil
+	return string(resp.Body), nil
 }
 
-func GetSearchShortInfo(url_string string) (string, error) {
-	// If URL starts with "olx.pl"
-	if strings.HasPrefix(url_string, "https://www.olx.pl") {
-		// Split the URL into parts
-		parts := strings.Split(url_string, "/")
-
-		// Get the city
-		text := strings.ToUpper(parts[6][:1]) + parts[6][1:]
-
-		u, err := url.Parse(url_string)
+// Fetch the response with the HTML page, see fetchHTMLPage.
+func fetchHTML(url_string string, cached bool) (*Response, error) {
+	header := http.Header{}
+	header.Set("Accept", "text/html")
+	header.Set("TZ", "Europe/Warsaw")
 
-		if err != nil {
-			return "", err
-		}
-
-		// Get the from price, if not present - set 0
-		fromPrice, ok := u.Query()["search[filter_float_price:from]"]
-		if !ok || len(fromPrice) == 0 {
-			fromPrice = []string{"0"}
-		}
-		// Get the to price, if not present keep it empty, else prepend '-'
-		toPrice, ok := u.Query()["search[filter_float_price:to]"]
-		if !ok || len(toPrice) == 0 {
-			toPrice = []string{""}
-		} else {
-			toPrice[0] = "-" + toPrice[0]
-		}
-
-		text += "(" + fromPrice[0] + toPrice[0] + ") "
-
-		return text, nil
-	} else {
-		return "", errors.New("Invalid URL")
+	fetch := DefaultFetcher.Fetch
+	if cached {
+		fetch = DefaultFetcher.FetchCached
 	}
-}
-
-func GetSearchFullInfo(url_string string) (string, error) {
-	// If URL starts with "olx.pl"
-	if strings.HasPrefix(url_string, "https://www.olx.pl") {
-		// Split the URL into parts
-		parts := strings.Split(url_string, "/")
-
-		text := "🏠 Full info of the search:\n\n"
-		// Get the city
-		text += "📍 " + strings.ToUpper(parts[6][:1]) + parts[6][1:] + "\n"
-
-		u, err := url.Parse(url_string)
-
-		if err != nil {
-			return "", err
-		}
-
-		q := u.Query()
-
-		text += "💰 Price: "
-		if price_from, ok := q["search[filter_float_price:from]"]; ok {
-				text += price_from[0]
-			} else {
-				text += "0"
-			}
-		if price_to, ok := q["search[filter_float_price:to]"]; ok {
-			text += " - " + price_to[0]
-		}
-
-		if size_from, ok := q["search[filter_float_m:from]"]; ok {
-			if size_to, ok := q["search[filter_float_m:to]"]; ok {
-				text += "📐 Area: " + size_from[0] + "-" + size_to[0] + " m²\n"
-			}
-		}
-
-		bedrooms := make([]string, 0)
-		floors := make([]string, 0)
-
-		for key, value := range q {
-			if strings.HasPrefix(key, "search[filter_enum_floor_select]") {
-				floors = append(floors, value[0])
-			} else if strings.HasPrefix(key, "search[filter_enum_rooms]") {
-				bedrooms = append(bedrooms, value[0])
-			}
-		}
-
-		if len(bedrooms) > 0 {
-			text += "🛏 Bedrooms:\n    - "
-			for k, bedroom := range bedrooms {
-				if k != len(bedrooms)-1 {
-					text += strings.ToUpper(bedroom[:1]) + bedroom[1:] + ", "
-				} else {
-					text += strings.ToUpper(bedroom[:1]) + bedroom[1:] + "\n"
-				}
-			}
-		}
-
-		if len(floors) > 0 {
-			text += "🏢 Floors:\n    - "
-			for k, floor := range floors {
-				if k != len(floors)-1 {
-					text += floorEncodings[floor] + ", "
-				} else {
-					text += floorEncodings[floor] + "\n"
-				}
-			}
-		}
 
-		// Print the url as an hyperlink
-		text += "\n🔗 <a href=\"" + url_string + "\">Link to the search</a>"
-
-		return text, nil
-	} else {
-		return "", errors.New("Invalid URL")
-	}
+	return fetch(url_string, header)
 }
 
+// DownloadImage downloads the image from the given URL using the cache of DefaultFetcher.
+// If an error occurs, it returns nil and the error.
 func DownloadImage(image_url string) ([]byte, error) {
-	resp, err := http.Get(image_url)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+	header := http.Header{}
+	header.Set("Accept", "image/*")
 
-	imageData, err := io.ReadAll(resp.Body)
+	resp, err := DefaultFetcher.FetchCached(image_url, header)
 	if err != nil {
 		return nil, err
 	}
 
-	return imageData, nil
-}
-
-func parseOtodomImages(json_string string) ([]string, error) {
-	var images []string
-
-	// Create a new JSON decoder
-	decoder := json.NewDecoder(strings.NewReader(json_string))
-
-	// Decode the JSON
-	var data map[string]interface{}
-	err := decoder.Decode(&data)
-	if err != nil {
-		return nil, err
-	}
-
-	// Images are stored under "props" -> "pageProps" -> "ad" -> "images"
-	images_data := data["props"].(map[string]interface{})["pageProps"].(map[string]interface{})["ad"].(map[string]interface{})["images"].([]interface{})
-	for _, image := range images_data {
-		images = append(images, image.(map[string]interface{})["large"].(string))
-	}
-
-	return images, nil
+	return resp.Body, nil
 }
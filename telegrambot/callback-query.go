@@ -1,7 +1,8 @@
 package telegrambot
 
 import (
-	"database/sql"
+	"apartment-parser/database"
+
 	"log"
 	"strings"
 
@@ -16,7 +17,7 @@ import (
 //	bot: Telegram bot instance.
 //	update: Telegram update instance.
 //	search_db: Search database instance.
-func processCallbackQuery(bot *tgbotapi.BotAPI, update tgbotapi.Update, search_db *sql.DB) {
+func processCallbackQuery(bot *tgbotapi.BotAPI, update tgbotapi.Update, search_db database.SearchStore) {
 	data := strings.Split(update.CallbackQuery.Data, "|")
 	switch data[0] {
 
@@ -62,3 +62,35 @@ var cities = []City{
 		Name: "Warszawa",
 		Code: "warszawa",
 	}}
+
+// Room counts of a new search, using the OLX room codes
+var roomOptions = []Option{
+	{Name: "1", Code: "one"},
+	{Name: "2", Code: "two"},
+	{Name: "3", Code: "three"},
+	{Name: "4+", Code: "four"},
+}
+
+// Floors of a new search, using the OLX floor codes
+var floorOptions = []Option{
+	{Name: "Ground", Code: "floor_0"},
+	{Name: "1", Code: "floor_1"},
+	{Name: "2", Code: "floor_2"},
+	{Name: "3", Code: "floor_3"},
+	{Name: "4", Code: "floor_4"},
+	{Name: "5", Code: "floor_5"},
+	{Name: "6", Code: "floor_6"},
+	{Name: "7", Code: "floor_7"},
+	{Name: "8", Code: "floor_8"},
+	{Name: "9", Code: "floor_9"},
+	{Name: "10", Code: "floor_10"},
+	{Name: "Above 10", Code: "floor_11"},
+	{Name: "Attic", Code: "floor_17"},
+}
+
+// Apartment features of a new search, using the names of the parser filters
+var featureOptions = []Option{
+	{Name: "🛋 Furnished", Code: "furnished"},
+	{Name: "🐾 Pets allowed", Code: "pets"},
+	{Name: "🛗 Elevator", Code: "elevator"},
+}
@@ -0,0 +1,336 @@
+package telegrambot
+
+import (
+	"apartment-parser/database"
+	"apartment-parser/parser"
+
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Steps of a new search following the price, in order.
+// Steps of the filters not supported by the source of the search are skipped.
+var newSearchSteps = []struct {
+	state   string
+	filters []parser.Filter
+}{
+	{"search|rooms", []parser.Filter{parser.FilterRooms}},
+	{"search|area", []parser.Filter{parser.FilterArea}},
+	{"search|floors", []parser.Filter{parser.FilterFloors}},
+	{"search|features", []parser.Filter{parser.FilterFurnished, parser.FilterPets, parser.FilterElevator}},
+}
+
+// Check if the source of the search term supports the filter.
+func termSupportsFilter(term parser.SearchTerm, filter parser.Filter) bool {
+	name := term.Source
+	if name == "" {
+		name = parser.DefaultSource
+	}
+	source, err := parser.GetSource(name)
+	if err != nil {
+		return false
+	}
+	return parser.SupportsFilter(source, filter)
+}
+
+// Continue a new search with the next step supported by its source,
+// creating the search after the last step.
+//
+// Parameters:
+//
+//	bot: Telegram bot instance.
+//	userID: Telegram user ID.
+//	db: Database instance of the search database.
+func newSearchNextStep(bot *tgbotapi.BotAPI, userID int64, db database.SearchStore) {
+	state, ok := userStates[userID]
+	if !ok {
+		return
+	}
+
+	// Steps after the current one, all of them after the price
+	next := 0
+	for i, step := range newSearchSteps {
+		if step.state == state.state {
+			next = i + 1
+		}
+	}
+
+	for _, step := range newSearchSteps[next:] {
+		for _, filter := range step.filters {
+			if termSupportsFilter(state.term, filter) {
+				state.state = step.state
+				userStates[userID] = state
+				displayNewSearchStep(bot, userID)
+				return
+			}
+		}
+	}
+
+	newSearchCreate(bot, userID, db)
+}
+
+// Clear the values of the current step of a new search.
+//
+// Parameters:
+//
+//	userID: Telegram user ID.
+func newSearchSkipStep(userID int64) {
+	state, ok := userStates[userID]
+	if !ok {
+		return
+	}
+
+	switch state.state {
+	case "search|price":
+		state.term.Price_min, state.term.Price_max = 0, 0
+	case "search|rooms":
+		state.term.Bedrooms = nil
+	case "search|area":
+		state.term.Size_min, state.term.Size_max = 0, 0
+	case "search|floors":
+		state.term.Floors = nil
+	case "search|features":
+		state.term.Furnished, state.term.Pets, state.term.Elevator = false, false, false
+	}
+	userStates[userID] = state
+}
+
+// Toggle an option of the current step of a new search and display the step again.
+//
+// Parameters:
+//
+//	bot: Telegram bot instance.
+//	userID: Telegram user ID.
+//	action: Kind of the option, e.g. "toggle_room".
+//	code: Code of the option.
+func newSearchToggleOption(bot *tgbotapi.BotAPI, userID int64, action string, code string) {
+	state, ok := userStates[userID]
+	if !ok {
+		return
+	}
+
+	switch action {
+	case "toggle_room":
+		state.term.Bedrooms = toggleCode(state.term.Bedrooms, code)
+	case "toggle_floor":
+		state.term.Floors = toggleCode(state.term.Floors, code)
+	case "toggle_feature":
+		switch parser.Filter(code) {
+		case parser.FilterFurnished:
+			state.term.Furnished = !state.term.Furnished
+		case parser.FilterPets:
+			state.term.Pets = !state.term.Pets
+		case parser.FilterElevator:
+			state.term.Elevator = !state.term.Elevator
+		}
+	}
+	userStates[userID] = state
+	displayNewSearchStep(bot, userID)
+}
+
+// Add the code to the list or remove it if already present, keeping the order of the list.
+func toggleCode(codes []string, code string) []string {
+	toggled := make([]string, 0, len(codes)+1)
+	for _, c := range codes {
+		if c != code {
+			toggled = append(toggled, c)
+		}
+	}
+	if len(toggled) == len(codes) {
+		toggled = append(toggled, code)
+	}
+	return toggled
+}
+
+// Check if the list contains the code.
+func containsCode(codes []string, code string) bool {
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Display the current step of a new search.
+//
+// Parameters:
+//
+//	bot: Telegram bot instance.
+//	userID: Telegram user ID.
+func displayNewSearchStep(bot *tgbotapi.BotAPI, userID int64) {
+	state := userStates[userID]
+	msg := tgbotapi.NewMessage(userID, "")
+	reply_markup := tgbotapi.NewInlineKeyboardMarkup()
+
+	// Current value of the text steps, set when editing a search
+	current := ""
+
+	switch state.state {
+	case "search|price":
+		msg.Text = `💵 Enter the price range in PLN:
+
+Examples:
+• 1000-2000 - from 1000 to 2000 PLN
+• 1500+ - from 1500 PLN (no upper limit)
+• -2000 or 2000 - up to 2000 PLN
+• 1500- - from 1500 PLN (alternative format)`
+		current = rangeToText(state.term.Price_min, state.term.Price_max)
+
+	case "search|rooms":
+		msg.Text = "🛏 Choose the number of rooms"
+		reply_markup = optionsKeyboard(roomOptions, 4, "search|toggle_room|", func(code string) bool {
+			return containsCode(state.term.Bedrooms, code)
+		})
+
+	case "search|area":
+		msg.Text = `📐 Enter the area range in m²:
+
+Examples:
+• 40-60 - from 40 to 60 m²
+• 40+ - from 40 m²
+• -60 or 60 - up to 60 m²`
+		current = rangeToText(state.term.Size_min, state.term.Size_max)
+
+	case "search|floors":
+		msg.Text = "🏢 Choose the allowed floors"
+		reply_markup = optionsKeyboard(floorOptions, 4, "search|toggle_floor|", func(code string) bool {
+			return containsCode(state.term.Floors, code)
+		})
+
+	case "search|features":
+		msg.Text = "✨ Choose the required features"
+		features := make([]Option, 0)
+		for _, option := range featureOptions {
+			if termSupportsFilter(state.term, parser.Filter(option.Code)) {
+				features = append(features, option)
+			}
+		}
+		reply_markup = optionsKeyboard(features, 1, "search|toggle_feature|", func(code string) bool {
+			switch parser.Filter(code) {
+			case parser.FilterFurnished:
+				return state.term.Furnished
+			case parser.FilterPets:
+				return state.term.Pets
+			case parser.FilterElevator:
+				return state.term.Elevator
+			}
+			return false
+		})
+
+	default:
+		log.Println("Unknown step of a new search: ", state.state)
+		return
+	}
+
+	// Text steps continue after the message with the value, or keep the current value
+	isText := state.state == "search|price" || state.state == "search|area"
+	if current != "" {
+		msg.Text += "\n\nCurrent: " + current
+	}
+
+	row := tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("❌ Cancel", "search|cancel_new_search|"),
+		tgbotapi.NewInlineKeyboardButtonData("⏭ Skip", "search|skip|"),
+	)
+	if !isText {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("➡️ Next", "search|next|"))
+	} else if current != "" {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("➡️ Keep", "search|next|"))
+	}
+	reply_markup.InlineKeyboard = append(reply_markup.InlineKeyboard, row)
+
+	msg.ReplyMarkup = reply_markup
+	sendMessage(bot, msg)
+}
+
+// Format the range in the format of the price and area steps, e.g. "1000-2000", "1500+" or "-2000".
+//
+// Parameters:
+//
+//	min: Minimum of the range, 0 if there is no minimum.
+//	max: Maximum of the range, 0 if there is no maximum.
+//
+// Returns:
+//
+//	The range as text, empty if the range has no limits.
+func rangeToText(min, max float64) string {
+	switch {
+	case min != 0 && max != 0:
+		return strconv.FormatFloat(min, 'f', -1, 64) + "-" + strconv.FormatFloat(max, 'f', -1, 64)
+	case min != 0:
+		return strconv.FormatFloat(min, 'f', -1, 64) + "+"
+	case max != 0:
+		return "-" + strconv.FormatFloat(max, 'f', -1, 64)
+	}
+	return ""
+}
+
+// Create a keyboard of the options, marking the selected ones.
+//
+// Parameters:
+//
+//	options: Options to display.
+//	columns: Number of the options in a row.
+//	data: Prefix of the callback data of the options, followed by their codes.
+//	selected: Reports whether the option with the code is selected.
+//
+// Returns:
+//
+//	Keyboard with the options.
+func optionsKeyboard(options []Option, columns int, data string, selected func(code string) bool) tgbotapi.InlineKeyboardMarkup {
+	reply_markup := tgbotapi.NewInlineKeyboardMarkup()
+
+	for i := 0; i < len(options); i += columns {
+		row := tgbotapi.NewInlineKeyboardRow()
+
+		for j := 0; j < columns && i+j < len(options); j++ {
+			option := options[i+j]
+			text := option.Name
+			if selected(option.Code) {
+				text = "✅ " + text
+			}
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData(text, data+option.Code))
+		}
+		reply_markup.InlineKeyboard = append(reply_markup.InlineKeyboard, row)
+	}
+	return reply_markup
+}
+
+// Process the area range of a new search and continue with the next step.
+//
+// Parameters:
+//
+//	bot: Telegram bot instance.
+//	update: Telegram update.
+//	db: Database instance of the search database.
+func newSearchProcessArea(bot *tgbotapi.BotAPI, update tgbotapi.Update, db database.SearchStore) {
+	userID := update.Message.Chat.ID
+
+	// The area range has the same format as the price range
+	minArea, maxArea, err := processPriceStr(update.Message.Text)
+	if err != nil {
+		log.Println(err)
+
+		msg := tgbotapi.NewMessage(userID, "❌ Invalid area format. Please use one of these formats:\n• 40-60 (range)\n• 40+ (minimum only)\n• -60 or 60 (maximum only)\n\nError: "+strings.Replace(err.Error(), "price", "area", 1))
+		sendMessage(bot, msg)
+		delete(userStates, userID)
+
+		// Remove the previous message and display all searches again
+		removeUpdateMessageRelative(bot, update.Message, 1)
+		displayAllSearchesToUser(bot, userID, db)
+		return
+	}
+
+	state := userStates[userID]
+	state.term.Size_min = float64(minArea)
+	state.term.Size_max = float64(maxArea)
+	userStates[userID] = state
+
+	// Remove the last bot's message
+	removeUpdateMessageRelative(bot, update.Message, 1)
+	newSearchNextStep(bot, userID, db)
+}
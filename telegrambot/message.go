@@ -1,7 +1,7 @@
 package telegrambot
 
 import (
-	"database/sql"
+	"apartment-parser/database"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
@@ -14,7 +14,7 @@ import (
 //	bot: Telegram bot instance.
 //	update: Telegram update.
 //	db: Database instance of the search database.
-func processMessage(bot *tgbotapi.BotAPI, update tgbotapi.Update, db *sql.DB) {
+func processMessage(bot *tgbotapi.BotAPI, update tgbotapi.Update, db database.SearchStore) {
 	if update.Message.IsCommand() {
 		processCommand(bot, update)
 	}
@@ -25,9 +25,14 @@ func processMessage(bot *tgbotapi.BotAPI, update tgbotapi.Update, db *sql.DB) {
 
 	// If user exists in userStates
 	if userState, ok := userStates[update.Message.Chat.ID]; ok {
-		if userState.state == "search|price" {
+		switch userState.state {
+		case "search|price":
 			newSearchProcessPrice(bot, update, db)
+		case "search|area":
+			newSearchProcessArea(bot, update, db)
 		}
+	} else if isUrl(update.Message.Text) {
+		addSearchFromUrl(bot, update.Message.Chat.ID, update.Message.Text, db)
 	}
 
 	// Remove last user's message
@@ -4,23 +4,28 @@ import (
 	"apartment-parser/database"
 	"apartment-parser/parser"
 
-	"database/sql"
+	"context"
+	"html"
 	"log"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
 // Send offer to user with given id.
+// The first offer of the cluster is sent with links to the others.
 //
 // Parameters:
 //
 //	bot: Telegram bot instance.
-//	offer: Offer to send.
+//	cluster: Offers of the same apartment to send.
 //	UserId: Id of user to send offer to.
-func sendOfferToUser(bot *tgbotapi.BotAPI, offer parser.Offer, UserId int64) {
-	message_string := offerToText(offer)
+func sendOfferToUser(bot *tgbotapi.BotAPI, cluster []parser.Offer, UserId int64) {
+	offer := cluster[0]
+	message_string := clusterToText(cluster)
 	msg := tgbotapi.NewMessage(UserId, message_string)
 	msg.ParseMode = "HTML"
 	msg.DisableWebPagePreview = false
@@ -33,7 +38,8 @@ func sendOfferToUser(bot *tgbotapi.BotAPI, offer parser.Offer, UserId int64) {
 			var image []byte
 			image, err := parser.DownloadImage(image_url)
 			if err != nil {
-				panic(err)
+				log.Printf("Error downloading image: %v", err)
+				continue
 			}
 
 			images = append(images, tgbotapi.NewInputMediaPhoto(tgbotapi.FileBytes{Name: "image.jpg", Bytes: image}))
@@ -91,81 +97,504 @@ func offerToText(offer parser.Offer) string {
 	}
 	text += "\n"
 
-	if offer.Area != "" {
+	if offer.AreaM2 != 0 {
+		text += "📐 " + strconv.FormatFloat(offer.AreaM2, 'f', -1, 64) + " m² (" + strconv.Itoa(int(offer.PricePerM2())) + " zł/m²)\n"
+	} else if offer.Area != "" {
 		text += "📐 " + offer.Area + "\n"
 	}
-	if offer.Rooms != "" {
+	if offer.RoomCount != 0 {
+		text += "🛏 " + strconv.Itoa(offer.RoomCount) + "\n"
+	} else if offer.Rooms != "" {
 		text += "🛏 " + offer.Rooms + "\n"
 	}
 	if offer.Floor != "" {
-		text += "🏢 " + offer.Floor + "\n"
+		text += "🏢 " + floorToText(offer) + "\n"
 	}
+	if offer.IsBusiness {
+		text += "💼 Agency\n"
+	}
+	if offer.Latitude != 0 || offer.Longitude != 0 {
+		coordinates := strconv.FormatFloat(offer.Latitude, 'f', -1, 64) + "," + strconv.FormatFloat(offer.Longitude, 'f', -1, 64)
+		text += "🗺 <a href=\"https://www.google.com/maps?q=" + coordinates + "\">Map</a>\n"
+	}
+
+	if !offer.PostedAt.IsZero() {
+		text += "\n📅 " + postedAtToText(offer.PostedAt, time.Now()) + "\n"
+	}
+	return text
+}
+
+// Convert the offers of the same apartment to text.
+// The first offer is described in full, followed by the links to all of them.
+//
+// Parameters:
+//
+//	cluster: Offers of the same apartment.
+//
+// Returns:
+//
+//	Text representation of the cluster.
+func clusterToText(cluster []parser.Offer) string {
+	text := offerToText(cluster[0])
+	if len(cluster) == 1 {
+		return text
+	}
+
+	links := make([]string, 0, len(cluster))
+	for _, offer := range cluster {
+		links = append(links, "<a href=\""+offer.Url+"\">"+sourceName(offer.Source)+"</a>")
+	}
+	return text + "\n🔗 " + strings.Join(links, ", ") + "\n"
+}
+
+// Get the display name of the source, e.g. "Otodom" for "otodom".
+func sourceName(code string) string {
+	if source, err := parser.GetSource(code); err == nil {
+		return source.DisplayName()
+	}
+	if code == "" {
+		return "Link"
+	}
+	return code
+}
+
+// Convert the time the offer was posted at to text, e.g. "Dzisiaj o 14:30".
+//
+// Parameters:
+//
+//	postedAt: Time the offer was posted at.
+//	now: Current time.
+//
+// Returns:
+//
+//	Text representation of the time in the Warsaw time zone.
+func postedAtToText(postedAt, now time.Time) string {
+	postedAt, now = postedAt.In(parser.Warsaw), now.In(parser.Warsaw)
+
+	switch postedAt.Format("2006-01-02") {
+	case now.Format("2006-01-02"):
+		return "Dzisiaj o " + postedAt.Format("15:04")
+	case now.AddDate(0, 0, -1).Format("2006-01-02"):
+		return "Wczoraj o " + postedAt.Format("15:04")
+	}
+	return postedAt.Format("02.01.2006 15:04")
+}
 
-	text += "\n📅 Dzisiaj o " + offer.Time + "\n"
+// Convert the floor of the offer to text, e.g. "2/4" or "Ground".
+//
+// Parameters:
+//
+//	offer: Offer with the floor to convert.
+//
+// Returns:
+//
+//	Text representation of the floor.
+func floorToText(offer parser.Offer) string {
+	var text string
+	switch offer.FloorNumber {
+	case parser.FloorBasement:
+		text = "Basement"
+	case parser.FloorGround:
+		text = "Ground"
+	case parser.FloorAboveTenth:
+		text = "Above Tenth"
+	case parser.FloorAttic:
+		text = "Attic"
+	default:
+		text = strconv.Itoa(offer.FloorNumber)
+	}
+
+	if offer.TotalFloors != 0 {
+		text += "/" + strconv.Itoa(offer.TotalFloors)
+	}
 	return text
 }
 
 // Parse all offers from all searches and send them to users in a loop.
+// New offers of all the searches of a user are grouped, so an apartment
+// posted on several sources is sent once.
 //
 // Parameters:
 //
 //	bot: Telegram bot instance.
 //	offers_db: Database with offers.
 //	search_db: Database with searches.
-func parseOffers(bot *tgbotapi.BotAPI, offers_db *sql.DB, search_db *sql.DB) {
+func parseOffers(bot *tgbotapi.BotAPI, offers_db database.OfferStore, search_db database.SearchStore) {
 	for {
-		searches, err := database.GetAllSearches(search_db)
+		searches, err := search_db.GetAllSearches()
 		if err != nil {
 			panic(err)
 		}
 
+		users := make([]int64, 0)
+		new_offers := make(map[int64][]parser.Offer)
+		// Id of the search which found each new offer, by its url
+		found_by := make(map[string]int64)
 		for _, search := range searches {
-			processAllOffersFromSearch(bot, search, offers_db, search_db)
+			if search.IsPaused(time.Now()) {
+				continue
+			}
+			// Pauses with a time resume by themselves
+			if !search.Active {
+				if err := search_db.ResumeSearch(search.UserID, search.ID); err != nil {
+					log.Println(err)
+				}
+			}
+
+			if _, ok := new_offers[search.UserID]; !ok {
+				users = append(users, search.UserID)
+				new_offers[search.UserID] = make([]parser.Offer, 0)
+			}
+			found := processAllOffersFromSearch(bot, search, new_offers[search.UserID], offers_db, search_db)
+			for _, offer := range found {
+				found_by[offer.Url] = search.ID
+			}
+			new_offers[search.UserID] = append(new_offers[search.UserID], found...)
+		}
+
+		for _, user_id := range users {
+			sendNewOffersToUser(bot, new_offers[user_id], found_by, user_id, offers_db)
+		}
+
+		if cache := parser.DefaultFetcher.Cache; cache != nil {
+			if err := cache.Prune(cacheMaxAge); err != nil {
+				log.Printf("Error pruning the cache: %v", err)
+			}
 		}
 	}
 }
 
-// Parse all offers from given search and send them to user.
+// Parse all new offers from given search.
+// Price changes of the offers already sent to the user are tracked as well.
 //
 // Parameters:
 //
-//		bot: Telegram bot instance.
-//		search: Search to parse offers from.
-//		offers_db: Database with offers.
-//	 search_db: Database with searches.
-func processAllOffersFromSearch(bot *tgbotapi.BotAPI, search database.Search, offers_db *sql.DB, search_db *sql.DB) {
-	page, err := parser.FetchHTMLPage(search.URL)
+//	bot: Telegram bot instance.
+//	search: Search to parse offers from.
+//	found: New offers already found by other searches of the user, skipped.
+//	offers_db: Database with offers.
+//	search_db: Database with searches.
+//
+// Returns:
+//
+//	New offers of the search with the images hashed.
+func processAllOffersFromSearch(bot *tgbotapi.BotAPI, search database.Search, found []parser.Offer, offers_db database.OfferStore, search_db database.SearchStore) []parser.Offer {
+	new_offers := make([]parser.Offer, 0)
+
+	// Follow the pages until reaching the offers already sent to the user
+	offers, err := parser.FetchSearchOffers(search.URL, maxSearchPages, func(offer parser.Offer) (bool, error) {
+		return offers_db.OfferExists(offer, search.UserID)
+	})
 	if err != nil {
-		log.Printf("Error fetching page: %v", err)
-		return
+		log.Printf("Error fetching offers: %v", err)
+		return new_offers
 	}
 
-	offers := parser.ParseHtml(page)
-
 	for _, offer := range offers {
-		search_exists, _ := database.SearchExists(search_db, search)
+		search_exists, _ := search_db.SearchExists(search)
 		if !search_exists {
-			return
+			return new_offers
 		}
 
-		exists, err := database.OfferExists(offers_db, offer, search.UserID)
+		exists, err := offers_db.OfferExists(offer, search.UserID)
 		if err != nil {
 			log.Printf("Error checking if offer exists: %v", err)
-			return
+			return new_offers
+		}
+		if exists {
+			if err := offers_db.MarkOfferSeen(offer, search.UserID); err != nil {
+				log.Printf("Error marking offer as seen: %v", err)
+			}
+			checkPriceChange(bot, search, offer, offers_db)
+			continue
+		}
+		if containsOffer(found, offer) || containsOffer(new_offers, offer) {
+			continue
+		}
+
+		offer = parser.ParseOffer(offer)
+		offer = parser.HashImages(offer, imagesToHash)
+		new_offers = append(new_offers, offer)
+	}
+	return new_offers
+}
+
+// Track the price of the offer already sent to the user
+// and notify the user if it dropped and the search has price alerts enabled.
+//
+// Parameters:
+//
+//	bot: Telegram bot instance.
+//	search: Search the offer was found by.
+//	offer: Offer with the current price.
+//	offers_db: Database with offers.
+func checkPriceChange(bot *tgbotapi.BotAPI, search database.Search, offer parser.Offer, offers_db database.OfferStore) {
+	stored, updated, dropped := trackPrice(search, offer, offers_db)
+	if !dropped {
+		return
+	}
+
+	msg := tgbotapi.NewMessage(search.UserID, priceDropToText(stored, updated))
+	msg.ParseMode = "HTML"
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🗑️ Remove", "remove_msg|"),
+	))
+	sendMessage(bot, msg)
+}
+
+// Record the current price of the offer already sent to the user and update the stored offer.
+// Search results often lack the additional payment, so 0 keeps the stored one.
+//
+// Parameters:
+//
+//	search: Search the offer was found by.
+//	offer: Offer with the current price.
+//	offers_db: Database with offers.
+//
+// Returns:
+//
+//	The stored offer with the previous price, the stored offer with the current price
+//	and true if the total price dropped and the search has price alerts enabled.
+func trackPrice(search database.Search, offer parser.Offer, offers_db database.OfferStore) (parser.Offer, parser.Offer, bool) {
+	if _, err := offers_db.RecordPrice(offer); err != nil {
+		log.Printf("Error recording price: %v", err)
+		return offer, offer, false
+	}
+
+	stored, changed, err := offers_db.UpdateOfferPrice(offer, search.UserID)
+	if err != nil {
+		log.Printf("Error updating price: %v", err)
+		return offer, offer, false
+	}
+	if !changed {
+		return stored, stored, false
+	}
+
+	// The stored offer has the details missing in the search results
+	updated := stored
+	updated.Price = offer.Price
+	if offer.AdditionalPayment != 0 {
+		updated.AdditionalPayment = offer.AdditionalPayment
+	}
+	log.Printf("Price of %s changed from %d to %d", offer.Url, stored.Price+stored.AdditionalPayment, updated.Price+updated.AdditionalPayment)
+
+	dropped := search.PriceAlerts && updated.Price+updated.AdditionalPayment < stored.Price+stored.AdditionalPayment
+	return stored, updated, dropped
+}
+
+// Convert the price drop of the offer to text.
+//
+// Parameters:
+//
+//	old: Offer with the previous price.
+//	offer: Offer with the current price.
+//
+// Returns:
+//
+//	Text with the previous and the current total price followed by the offer.
+func priceDropToText(old parser.Offer, offer parser.Offer) string {
+	text := "📉 Price dropped: <s>" + strconv.Itoa(old.Price+old.AdditionalPayment) + " zł</s> → " +
+		strconv.Itoa(offer.Price+offer.AdditionalPayment) + " zł\n\n"
+	return text + offerToText(offer)
+}
+
+// Check if the list contains the same listing as the offer.
+func containsOffer(offers []parser.Offer, offer parser.Offer) bool {
+	for _, o := range offers {
+		if o.SameListing(offer) {
+			return true
 		}
-		if !exists {
-			offer = parser.ParseOffer(offer)
-			err := database.AddOffer(offers_db, offer, search.UserID)
+	}
+	return false
+}
+
+// Store the new offers of the user and send them grouped by apartment.
+// Apartments already sent to the user from another source are not sent again.
+//
+// Parameters:
+//
+//	bot: Telegram bot instance.
+//	offers: New offers of the user.
+//	foundBy: Id of the search which found each offer, by its url.
+//	userID: Id of the user.
+//	offers_db: Database with offers.
+func sendNewOffersToUser(bot *tgbotapi.BotAPI, offers []parser.Offer, foundBy map[string]int64, userID int64, offers_db database.OfferStore) {
+	if len(offers) == 0 {
+		return
+	}
+
+	sent, err := offers_db.ListUserOffers(userID, sentOffersToCompare)
+	if err != nil {
+		log.Printf("Error listing offers: %v", err)
+		return
+	}
+
+	ctx := context.Background()
+	for _, cluster := range parser.DefaultDuplicateDetector.Cluster(offers) {
+		already_sent := false
+		any_added := false
+		for _, offer := range cluster {
+			if !already_sent && isDuplicateOfAny(offer, sent) {
+				log.Printf("Skipping duplicate of an offer sent before: %s", offer.Url)
+				already_sent = true
+			}
+
+			// The offer and its first price are stored together
+			err := offers_db.WithTx(ctx, func(tx database.Store) error {
+				added, err := tx.AddOfferContext(ctx, offer, userID, foundBy[offer.Url])
+				if err != nil || !added {
+					return err
+				}
+				any_added = true
+				_, err = tx.RecordPriceContext(ctx, offer)
+				return err
+			})
 			if err != nil {
 				log.Printf("Error adding offer to database: %v", err)
 				return
 			}
+		}
+		// Offers added in the meantime by another bot sharing the database were sent by it
+		if already_sent || !any_added {
+			continue
+		}
 
-			// if has 'Dzisiaj' in time and images, send offer
-			if len(offer.Images) > 0 {
-				sendOfferToUser(bot, offer, search.UserID)
-			}
+		// Only offers with images are sent
+		cluster = orderCluster(cluster)
+		if len(cluster[0].Images) > 0 {
+			sendOfferToUser(bot, cluster, userID)
 			time.Sleep(5 * time.Second)
 		}
 	}
 }
+
+// Check if the offer is a duplicate of any of the offers.
+func isDuplicateOfAny(offer parser.Offer, offers []parser.Offer) bool {
+	for _, o := range offers {
+		if parser.DefaultDuplicateDetector.IsDuplicate(offer, o) {
+			return true
+		}
+	}
+	return false
+}
+
+// Order the offers of the cluster so the one with the most images comes first.
+//
+// Parameters:
+//
+//	cluster: Offers of the same apartment.
+//
+// Returns:
+//
+//	Ordered offers, the order of offers with the same number of images is kept.
+func orderCluster(cluster []parser.Offer) []parser.Offer {
+	ordered := append([]parser.Offer(nil), cluster...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return len(ordered[i].Images) > len(ordered[j].Images)
+	})
+	return ordered
+}
+
+// Check the stored offers for being taken down in a loop and notify the users.
+// The pages are fetched with the rate limits of the parser.
+//
+// Parameters:
+//
+//	bot: Telegram bot instance.
+//	offers_db: Database with offers.
+func checkRemovedOffers(bot *tgbotapi.BotAPI, offers_db database.OfferStore) {
+	for {
+		offers, err := offers_db.ListOffersToCheck(time.Now().Add(-removedCheckInterval), removedCheckBatch)
+		if err != nil {
+			log.Printf("Error listing offers to check: %v", err)
+		}
+		if len(offers) == 0 {
+			time.Sleep(10 * time.Minute)
+			continue
+		}
+
+		removed := make(map[int64][]database.RemovedOffer)
+		failed := 0
+		for _, offer := range offers {
+			is_removed, err := parser.CheckRemoved(offer)
+			if err != nil {
+				// Offers which could not be checked are not marked as checked and are checked again
+				log.Printf("Error checking if offer was removed: %v", err)
+				failed++
+				continue
+			}
+			if !is_removed {
+				if err := offers_db.MarkOfferChecked(offer); err != nil {
+					log.Printf("Error marking offer as checked: %v", err)
+				}
+				continue
+			}
+
+			removed_offers, err := offers_db.MarkOfferRemoved(offer)
+			if err != nil {
+				log.Printf("Error marking offer as removed: %v", err)
+				continue
+			}
+			for _, r := range removed_offers {
+				removed[r.UserID] = append(removed[r.UserID], r)
+			}
+		}
+
+		for user_id, user_removed := range removed {
+			msg := tgbotapi.NewMessage(user_id, removedOffersToText(user_removed))
+			msg.ParseMode = "HTML"
+			msg.DisableWebPagePreview = true
+			msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("🗑️ Remove", "remove_msg|"),
+			))
+			sendMessage(bot, msg)
+		}
+
+		// The same offers are listed again until they are checked, so the failing sources are not retried in a loop
+		if failed == len(offers) {
+			time.Sleep(10 * time.Minute)
+		}
+	}
+}
+
+// Convert the offers taken down from their sources to text.
+//
+// Parameters:
+//
+//	removed: Offers of the user taken down from their sources.
+//
+// Returns:
+//
+//	Text listing the offers and how long they were listed.
+func removedOffersToText(removed []database.RemovedOffer) string {
+	text := "🚫 Offers no longer listed:\n"
+	for _, r := range removed {
+		text += "\n• <a href=\"" + r.Offer.Url + "\">" + html.EscapeString(r.Offer.Title) + "</a>"
+		if !r.ListedAt.IsZero() {
+			text += " - listed for " + durationToText(r.RemovedAt.Sub(r.ListedAt))
+		}
+	}
+	return text
+}
+
+// Convert the duration to text, e.g. "5 hours" or "3 days".
+//
+// Parameters:
+//
+//	duration: Duration to convert.
+//
+// Returns:
+//
+//	Text representation of the duration rounded down to hours or days.
+func durationToText(duration time.Duration) string {
+	hours := int(duration.Hours())
+	switch {
+	case hours < 1:
+		return "less than an hour"
+	case hours == 1:
+		return "1 hour"
+	case hours < 48:
+		return strconv.Itoa(hours) + " hours"
+	}
+	return strconv.Itoa(hours/24) + " days"
+}
@@ -0,0 +1,170 @@
+package telegrambot
+
+import (
+	"apartment-parser/database"
+	"apartment-parser/parser"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTrackPrice(t *testing.T) {
+	store, err := database.Open(filepath.Join(t.TempDir(), "apartibot.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	search := database.Search{UserID: 1, PriceAlerts: true}
+	offer := parser.Offer{
+		Url:               "https://www.olx.pl/d/oferta/mieszkanie-CID3-ID1.html",
+		ListingId:         "ID1",
+		Source:            "olx",
+		Title:             "Mieszkanie 2 pokojowe",
+		Price:             3000,
+		AdditionalPayment: 500,
+	}
+	if _, err := store.AddOffer(offer, search.UserID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.RecordPrice(offer); err != nil {
+		t.Fatal(err)
+	}
+
+	// The offers found in the search results, in the order they are found
+	tests := []struct {
+		name        string
+		price       int
+		additional  int
+		url         string
+		alerts      bool
+		wantDropped bool
+		wantOld     int
+		wantTotal   int
+	}{
+		{"same price", 3000, 500, "", true, false, 3500, 3500},
+		{"additional payment missing in the results", 3000, 0, "", true, false, 3500, 3500},
+		{"reposted with the same price", 3000, 0, "https://www.olx.pl/d/oferta/mieszkanie-odswiezone-CID3-ID1.html", true, false, 3500, 3500},
+		{"additional payment dropped", 3000, 300, "", true, true, 3500, 3300},
+		{"price raised", 3200, 0, "", true, false, 3300, 3500},
+		{"price dropped without alerts", 3100, 0, "", false, false, 3500, 3400},
+		{"price dropped", 2900, 0, "", true, true, 3400, 3200},
+		{"reposted after the drop", 2900, 300, "https://www.olx.pl/d/oferta/mieszkanie-znowu-CID3-ID1.html", true, false, 3200, 3200},
+	}
+	for _, tt := range tests {
+		found := parser.Offer{Url: offer.Url, ListingId: offer.ListingId, Source: offer.Source, Price: tt.price, AdditionalPayment: tt.additional}
+		if tt.url != "" {
+			found.Url = tt.url
+		}
+		search.PriceAlerts = tt.alerts
+
+		old, updated, dropped := trackPrice(search, found, store)
+		if dropped != tt.wantDropped {
+			t.Errorf("%s: dropped = %v, want %v", tt.name, dropped, tt.wantDropped)
+		}
+		if total := old.Price + old.AdditionalPayment; total != tt.wantOld {
+			t.Errorf("%s: old total price = %d, want %d", tt.name, total, tt.wantOld)
+		}
+		if total := updated.Price + updated.AdditionalPayment; total != tt.wantTotal {
+			t.Errorf("%s: total price = %d, want %d", tt.name, total, tt.wantTotal)
+		}
+		// The stored offer keeps the details missing in the search results
+		if updated.Title != offer.Title {
+			t.Errorf("%s: title = %q, want %q", tt.name, updated.Title, offer.Title)
+		}
+	}
+
+	history, err := store.PriceHistory(offer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []int{3500, 3300, 3500, 3400, 3200}
+	if len(history) != len(want) {
+		t.Fatalf("PriceHistory = %v, want the totals %v", history, want)
+	}
+	for i, point := range history {
+		if total := point.Price + point.AdditionalPayment; total != want[i] {
+			t.Errorf("PriceHistory[%d] total = %d, want %d", i, total, want[i])
+		}
+	}
+}
+
+func TestPriceDropToText(t *testing.T) {
+	old := parser.Offer{Title: "Mieszkanie", Price: 3000, AdditionalPayment: 500, Url: "https://www.olx.pl/d/oferta/a-ID1.html"}
+	offer := old
+	offer.Price = 2800
+	if text := priceDropToText(old, offer); !strings.HasPrefix(text, "📉 Price dropped: <s>3500 zł</s> → 3300 zł\n\n") {
+		t.Errorf("priceDropToText() = %q", text)
+	}
+}
+
+// Transport sending all the requests to the test server.
+type redirectTransport struct {
+	server *httptest.Server
+}
+
+func (t redirectTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.URL.Scheme, r.URL.Host = "http", strings.TrimPrefix(t.server.URL, "http://")
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestOtodomOfferFromOlx(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body><script id="__NEXT_DATA__" type="application/json">{"props":{"pageProps":{"ad":{"id":65123456,"images":[
+			{"large":"https://img.otodom.pl/1-l.jpg"}
+		]}}}}</script></body></html>`))
+	}))
+	defer server.Close()
+
+	fetcher := parser.NewFetcher()
+	fetcher.Rate, fetcher.MaxRetries = 0, 0
+	fetcher.Client = &http.Client{Transport: redirectTransport{server}}
+	defaultFetcher := parser.DefaultFetcher
+	parser.DefaultFetcher = fetcher
+	defer func() { parser.DefaultFetcher = defaultFetcher }()
+
+	// The test offers have no time
+	if err := parser.SetTodayOnly("olx", false); err != nil {
+		t.Fatal(err)
+	}
+	defer parser.SetTodayOnly("olx", true)
+
+	store, err := database.Open(filepath.Join(t.TempDir(), "apartibot.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	// OLX search results link to the offers posted on Otodom
+	searchPage := func(price string) parser.Offer {
+		t.Helper()
+		offers, err := parser.ParseSearchPage("https://www.olx.pl/nieruchomosci/mieszkania/wynajem/warszawa/",
+			`<div class="css-1sw7q4x"><a href="https://www.otodom.pl/pl/oferta/mieszkanie-przy-parku-ID4bbbb"><h4>Mieszkanie przy parku</h4></a><p data-testid="ad-price">`+price+` zł</p></div>`)
+		if err != nil || len(offers) != 1 {
+			t.Fatalf("ParseSearchPage() = %v, %v, want 1 offer", offers, err)
+		}
+		return offers[0]
+	}
+
+	found := searchPage("3 000")
+	offer := parser.ParseOffer(found)
+	if offer.Source != "otodom" || offer.ListingId != found.ListingId || len(offer.Images) != 1 {
+		t.Fatalf("ParseOffer() = %+v, want the otodom offer %q with its images", offer, found.ListingId)
+	}
+	if added, err := store.AddOffer(offer, 1, 0); err != nil || !added {
+		t.Fatalf("AddOffer = %v, %v, want true", added, err)
+	}
+
+	// The next poll finds the stored offer and its price drop
+	again := searchPage("2 800")
+	if exists, err := store.OfferExists(again, 1); err != nil || !exists {
+		t.Errorf("OfferExists = %v, %v, want true", exists, err)
+	}
+	old, updated, dropped := trackPrice(database.Search{UserID: 1, PriceAlerts: true}, again, store)
+	if !dropped || old.Price != 3000 || updated.Price != 2800 {
+		t.Errorf("trackPrice() = %d, %d, %v, want the drop from 3000 to 2800", old.Price, updated.Price, dropped)
+	}
+}
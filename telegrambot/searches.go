@@ -4,10 +4,11 @@ import (
 	"apartment-parser/database"
 	"apartment-parser/parser"
 
-	"database/sql"
+	"errors"
 	"log"
 	"strconv"
 	"strings"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
@@ -20,11 +21,15 @@ import (
 //	bot: Telegram bot instance.
 //	update: Telegram update.
 //	db: Database instance of the search database.
-func processSearchAction(bot *tgbotapi.BotAPI, update tgbotapi.Update, db *sql.DB) {
+func processSearchAction(bot *tgbotapi.BotAPI, update tgbotapi.Update, db database.SearchStore) {
 	data := strings.Split(update.CallbackQuery.Data, "|")
 	switch data[1] {
 
 	case "create_search":
+		newSearchListSources(bot, update)
+
+	case "choose_source":
+		newSearchProcessSource(bot, update, data[2])
 		newSearchListCities(bot, update, db)
 
 	case "list_info":
@@ -34,12 +39,37 @@ func processSearchAction(bot *tgbotapi.BotAPI, update tgbotapi.Update, db *sql.D
 		removeSearchFromDatabase(data[2], db)
 		displayAllSearchesToUser(bot, update.CallbackQuery.Message.Chat.ID, db)
 
+	case "pause_search":
+		pauseSearch(update.CallbackQuery.Message.Chat.ID, data[2], data[3], db)
+		displayFullSearchInfo(bot, update.CallbackQuery.Message.Chat.ID, data[2], db)
+
+	case "resume_search":
+		resumeSearch(update.CallbackQuery.Message.Chat.ID, data[2], db)
+		displayFullSearchInfo(bot, update.CallbackQuery.Message.Chat.ID, data[2], db)
+
+	case "toggle_price_alerts":
+		togglePriceAlerts(update.CallbackQuery.Message.Chat.ID, data[2], db)
+		displayFullSearchInfo(bot, update.CallbackQuery.Message.Chat.ID, data[2], db)
+
+	case "edit_search":
+		editSearch(bot, update.CallbackQuery.Message.Chat.ID, data[2], db)
+
 	case "choose_city":
 		newSearchProcessCity(bot, update.CallbackQuery.Message.Chat.ID, data[2], db)
 
 	case "cancel_new_search":
 		delete(userStates, update.CallbackQuery.Message.Chat.ID)
 
+	case "toggle_room", "toggle_floor", "toggle_feature":
+		newSearchToggleOption(bot, update.CallbackQuery.Message.Chat.ID, data[1], data[2])
+
+	case "skip":
+		newSearchSkipStep(update.CallbackQuery.Message.Chat.ID)
+		newSearchNextStep(bot, update.CallbackQuery.Message.Chat.ID, db)
+
+	case "next":
+		newSearchNextStep(bot, update.CallbackQuery.Message.Chat.ID, db)
+
 	default:
 		log.Println("Unknown callback query data for search: ", data[1])
 	}
@@ -51,17 +81,137 @@ func processSearchAction(bot *tgbotapi.BotAPI, update tgbotapi.Update, db *sql.D
 //
 //	search_id_str: Search ID as string.
 //	db: Database instance of the search database.
-func removeSearchFromDatabase(search_id_str string, db *sql.DB) {
+func removeSearchFromDatabase(search_id_str string, db database.SearchStore) {
+	search_id, err := strconv.Atoi(search_id_str)
+	if err != nil {
+		log.Println(err)
+	}
+	err = db.DeleteSearch(int64(search_id))
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// Enable or disable the price drop notifications of a search of the user.
+//
+// Parameters:
+//
+//	userID: Telegram user ID.
+//	search_id_str: Search ID as string.
+//	db: Database instance of the search database.
+func togglePriceAlerts(userID int64, search_id_str string, db database.SearchStore) {
+	search_id, err := strconv.Atoi(search_id_str)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	search, err := db.GetSearch(int64(search_id))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	err = db.SetPriceAlerts(userID, search.ID, !search.PriceAlerts)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// Pause a search of the user for the given number of days.
+//
+// Parameters:
+//
+//	userID: Telegram user ID.
+//	search_id_str: Search ID as string.
+//	days_str: Number of days as string, 0 to pause the search until it is resumed.
+//	db: Database instance of the search database.
+func pauseSearch(userID int64, search_id_str string, days_str string, db database.SearchStore) {
 	search_id, err := strconv.Atoi(search_id_str)
 	if err != nil {
 		log.Println(err)
+		return
+	}
+	days, err := strconv.Atoi(days_str)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	var until time.Time
+	if days > 0 {
+		until = time.Now().AddDate(0, 0, days)
 	}
-	err = database.DeleteSearch(db, int64(search_id))
+	err = db.PauseSearch(userID, int64(search_id), until)
 	if err != nil {
 		log.Println(err)
 	}
 }
 
+// Resume a paused search of the user.
+//
+// Parameters:
+//
+//	userID: Telegram user ID.
+//	search_id_str: Search ID as string.
+//	db: Database instance of the search database.
+func resumeSearch(userID int64, search_id_str string, db database.SearchStore) {
+	search_id, err := strconv.Atoi(search_id_str)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	err = db.ResumeSearch(userID, int64(search_id))
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// Display a list of all sources that can be used to create a new search.
+//
+// Parameters:
+//
+//	bot: Telegram bot instance.
+//	update: Telegram update.
+func newSearchListSources(bot *tgbotapi.BotAPI, update tgbotapi.Update) {
+	msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Message.Text)
+	msg.Text = "🌐 Choose the website you want to search on"
+	reply_markup := tgbotapi.NewInlineKeyboardMarkup()
+
+	sources := listSources()
+	for i := 0; i < len(sources); i += 2 {
+		row := tgbotapi.NewInlineKeyboardRow()
+
+		for j := 0; j < 2; j++ {
+			if i+j < len(sources) {
+				row = append(row, tgbotapi.NewInlineKeyboardButtonData(sources[i+j].Name, "search|choose_source|"+sources[i+j].Code))
+			}
+		}
+		reply_markup.InlineKeyboard = append(reply_markup.InlineKeyboard, row)
+	}
+
+	reply_markup.InlineKeyboard = append(reply_markup.InlineKeyboard, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("❌ Cancel", "remove_msg|"),
+	))
+
+	msg.ReplyMarkup = reply_markup
+	sendMessage(bot, msg)
+}
+
+// Process the source selection of a new search.
+//
+// Parameters:
+//
+//	bot: Telegram bot instance.
+//	update: Telegram update.
+//	source: Name of the source.
+func newSearchProcessSource(bot *tgbotapi.BotAPI, update tgbotapi.Update, source string) {
+	userID := update.CallbackQuery.Message.Chat.ID
+	userStates[userID] = UserNewSearch{
+		user_id: userID,
+		state:   "search|city",
+		term:    parser.SearchTerm{Source: source},
+	}
+}
+
 // Display a list of all cities that can be used to create a new search.
 //
 // Parameters:
@@ -69,7 +219,7 @@ func removeSearchFromDatabase(search_id_str string, db *sql.DB) {
 //	bot: Telegram bot instance.
 //	update: Telegram update.
 //	db: Database instance of the search database.
-func newSearchListCities(bot *tgbotapi.BotAPI, update tgbotapi.Update, db *sql.DB) {
+func newSearchListCities(bot *tgbotapi.BotAPI, update tgbotapi.Update, db database.SearchStore) {
 	msg := tgbotapi.NewMessage(update.CallbackQuery.Message.Chat.ID, update.CallbackQuery.Message.Text)
 	msg.Text = "🌇 Choose the city you want to search in"
 	reply_markup := tgbotapi.NewInlineKeyboardMarkup()
@@ -100,10 +250,10 @@ func newSearchListCities(bot *tgbotapi.BotAPI, update tgbotapi.Update, db *sql.D
 //	bot: Telegram bot instance.
 //	userID: Telegram user ID.
 //	db: Database instance of the search database.
-func displayAllSearchesToUser(bot *tgbotapi.BotAPI, userID int64, db *sql.DB) {
+func displayAllSearchesToUser(bot *tgbotapi.BotAPI, userID int64, db database.SearchStore) {
 	msg := tgbotapi.NewMessage(userID, "")
 
-	searches, err := database.ListSearches(db, userID)
+	searches, err := db.ListSearches(userID)
 	if err != nil {
 		log.Println(err)
 	}
@@ -120,9 +270,14 @@ func displayAllSearchesToUser(bot *tgbotapi.BotAPI, userID int64, db *sql.DB) {
 			if err != nil {
 				log.Println(err)
 			} else {
+				icon := "💵 "
+				if search.IsPaused(time.Now()) {
+					icon = "⏸ "
+				}
+
 				// Add button to reply_markup
 				reply_markup.InlineKeyboard = append(reply_markup.InlineKeyboard, tgbotapi.NewInlineKeyboardRow(
-					tgbotapi.NewInlineKeyboardButtonData("💵 "+search_info, "search|list_info|"+strconv.Itoa(int(search.ID))),
+					tgbotapi.NewInlineKeyboardButtonData(icon+search_info, "search|list_info|"+strconv.Itoa(int(search.ID))),
 				))
 			}
 		}
@@ -145,7 +300,7 @@ func displayAllSearchesToUser(bot *tgbotapi.BotAPI, userID int64, db *sql.DB) {
 //	userID: Telegram user ID.
 //	search_id_str: Search ID as string.
 //	db: Database instance of the search database.
-func displayFullSearchInfo(bot *tgbotapi.BotAPI, userID int64, search_id_str string, db *sql.DB) {
+func displayFullSearchInfo(bot *tgbotapi.BotAPI, userID int64, search_id_str string, db database.SearchStore) {
 	search_id, err := strconv.Atoi(search_id_str)
 	if err != nil {
 		log.Println(err)
@@ -153,7 +308,7 @@ func displayFullSearchInfo(bot *tgbotapi.BotAPI, userID int64, search_id_str str
 	}
 
 	msg := tgbotapi.NewMessage(userID, "")
-	search, err := database.GetSearch(db, int64(search_id))
+	search, err := db.GetSearch(int64(search_id))
 	if err != nil {
 		log.Println(err)
 		return
@@ -165,11 +320,36 @@ func displayFullSearchInfo(bot *tgbotapi.BotAPI, userID int64, search_id_str str
 		return
 	}
 
+	price_alerts := "🔕 Price drops: off"
+	if search.PriceAlerts {
+		price_alerts = "🔔 Price drops: on"
+	}
+
+	id := strconv.Itoa(int(search.ID))
+	pause_row := tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("⏸ Pause", "search|pause_search|"+id+"|0"),
+		tgbotapi.NewInlineKeyboardButtonData("⏸ 1 week", "search|pause_search|"+id+"|7"),
+		tgbotapi.NewInlineKeyboardButtonData("⏸ 1 month", "search|pause_search|"+id+"|30"),
+	)
+	if search.IsPaused(time.Now()) {
+		search_info += "\n\n" + pausedToText(search.PausedUntil)
+		pause_row = tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("▶️ Resume", "search|resume_search|"+id),
+		)
+	}
+
 	msg.Text = search_info
 	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(price_alerts, "search|toggle_price_alerts|"+id),
+		),
+		pause_row,
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✏️ Edit search", "search|edit_search|"+id),
+		),
 		tgbotapi.NewInlineKeyboardRow(
 			tgbotapi.NewInlineKeyboardButtonData("❌ Cancel", "remove_msg|"),
-			tgbotapi.NewInlineKeyboardButtonData("🗑️ Delete search", "search|remove_search|"+strconv.Itoa(int(search.ID))),
+			tgbotapi.NewInlineKeyboardButtonData("🗑️ Delete search", "search|remove_search|"+id),
 		),
 	)
 	msg.ParseMode = "HTML"
@@ -177,6 +357,22 @@ func displayFullSearchInfo(bot *tgbotapi.BotAPI, userID int64, search_id_str str
 	sendMessage(bot, msg)
 }
 
+// Describe the pause of a search, e.g. "⏸ Paused until 20.10.2026 14:30".
+//
+// Parameters:
+//
+//	pausedUntil: Time the search resumes at, zero if it is paused until resumed.
+//
+// Returns:
+//
+//	Text representation of the pause in the Warsaw time zone.
+func pausedToText(pausedUntil time.Time) string {
+	if pausedUntil.IsZero() {
+		return "⏸ Paused"
+	}
+	return "⏸ Paused until " + pausedUntil.In(parser.Warsaw).Format("02.01.2006 15:04")
+}
+
 // Process the city selection of a new search.
 //
 // Parameters:
@@ -185,41 +381,123 @@ func displayFullSearchInfo(bot *tgbotapi.BotAPI, userID int64, search_id_str str
 //	userID: Telegram user ID.
 //	city: Name of the city.
 //	db: Database instance of the search database.
-func newSearchProcessCity(bot *tgbotapi.BotAPI, userID int64, city string, db *sql.DB) {
+func newSearchProcessCity(bot *tgbotapi.BotAPI, userID int64, city string, db database.SearchStore) {
+	// Add user to userStates, keeping the source chosen in the previous step
+	term := userStates[userID].term
+	term.Location = city
+	userStates[userID] = UserNewSearch{
+		user_id: userID,
+		state:   "search|price",
+		term:    term,
+	}
+
+	displayNewSearchStep(bot, userID)
+}
 
+// Add a search from a search url pasted by the user.
+// The url is normalized to sort the offers from the newest and the summary of the search is displayed.
+// Filters set on the website which the bot can not describe, e.g. districts, are kept in the url.
+//
+// Parameters:
+//
+//	bot: Telegram bot instance.
+//	userID: Telegram user ID.
+//	url_string: The pasted url.
+//	db: Database instance of the search database.
+func addSearchFromUrl(bot *tgbotapi.BotAPI, userID int64, url_string string, db database.SearchStore) {
 	msg := tgbotapi.NewMessage(userID, "")
-	msg.Text = `💵 Enter the price range in PLN:
 
-Examples:
-• 1000-2000 - from 1000 to 2000 PLN
-• 1500+ - from 1500 PLN (no upper limit)
-• -2000 or 2000 - up to 2000 PLN
-• 1500- - from 1500 PLN (alternative format)`
+	url, err := parser.NormalizeSearchUrl(url_string)
+	if err != nil {
+		log.Println(err)
+		msg.Text = "❌ This is not a search link of a supported website. Please paste the link of the search results page."
+		sendMessage(bot, msg)
+		return
+	}
 
-	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonData("❌ Cancel", "search|cancel_new_search|"),
-		),
-	)
+	search_info, err := parser.GetSearchFullInfo(url)
+	if err != nil {
+		log.Println(err)
+		msg.Text = "❌ Failed to read the search link. Please try again."
+		sendMessage(bot, msg)
+		return
+	}
 
-	// Add user to userStates
-	userStates[userID] = UserNewSearch{
-		user_id: userID,
-		state:   "search|price",
-		city:    city,
+	err = db.AddSearch(userID, url)
+	if err != nil {
+		log.Println(err)
+		msg.Text = "❌ Failed to add to database. Please try again."
+		sendMessage(bot, msg)
+		return
 	}
 
+	msg.Text = "✅ Search added\n\n" + search_info
+	msg.ParseMode = "HTML"
+	msg.DisableWebPagePreview = true
 	sendMessage(bot, msg)
+
+	displayAllSearchesToUser(bot, userID, db)
+}
+
+// Start editing a search with the steps of a new search, pre-filled with the values of the search.
+// The source and the city of the search are kept. Searches added from pasted urls with filters
+// the steps can not set are not edited, as the edited search would lose these filters.
+//
+// Parameters:
+//
+//	bot: Telegram bot instance.
+//	userID: Telegram user ID.
+//	search_id_str: Search ID as string.
+//	db: Database instance of the search database.
+func editSearch(bot *tgbotapi.BotAPI, userID int64, search_id_str string, db database.SearchStore) {
+	search_id, err := strconv.Atoi(search_id_str)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	search, err := db.GetSearch(int64(search_id))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if search.UserID != userID {
+		log.Printf("user %d can not edit the search %d of another user", userID, search.ID)
+		return
+	}
+
+	// Searches without a city or with filters set on the website, e.g. districts,
+	// can not be created again by the steps
+	term, err := parser.ParseEditableSearchUrl(search.URL)
+	if err == nil && term.Location == "" {
+		err = errors.New("no location in the search url: " + search.URL)
+	}
+	if err != nil {
+		log.Println(err)
+
+		msg := tgbotapi.NewMessage(userID, "❌ This search can not be edited. Please delete it and create a new one.")
+		sendMessage(bot, msg)
+		return
+	}
+
+	userStates[userID] = UserNewSearch{
+		user_id:   userID,
+		state:     "search|price",
+		term:      term,
+		search_id: search.ID,
+	}
+
+	displayNewSearchStep(bot, userID)
 }
 
-// Process the price range of a new search and create the search.
+// Process the price range of a new search and continue with the next step.
 //
 // Parameters:
 //
 //	bot: Telegram bot instance.
 //	update: Telegram update.
 //	db: Database instance of the search database.
-func newSearchProcessPrice(bot *tgbotapi.BotAPI, update tgbotapi.Update, db *sql.DB) {
+func newSearchProcessPrice(bot *tgbotapi.BotAPI, update tgbotapi.Update, db database.SearchStore) {
 
 	msg := tgbotapi.NewMessage(update.Message.Chat.ID, update.Message.Text)
 
@@ -244,41 +522,48 @@ Error: ` + err.Error()
 		return
 	}
 
-	search_term := parser.SearchTerm{
-		Location:  userStates[update.Message.Chat.ID].city,
-		Price_min: float64(minPrice),
-		Price_max: float64(maxPrice),
-	}
+	state := userStates[update.Message.Chat.ID]
+	state.term.Price_min = float64(minPrice)
+	state.term.Price_max = float64(maxPrice)
+	userStates[update.Message.Chat.ID] = state
 
-	url, error := parser.CreateUrl(search_term)
-	if error != nil {
-		log.Println(err)
-
-		msg.Text = "❌ Failed to create a url. Please try again."
-		sendMessage(bot, msg)
-
-		delete(userStates, update.Message.Chat.ID)
-
-		// Remove the previous message and display all searches again
-		removeUpdateMessageRelative(bot, update.Message, 1)
-		displayAllSearchesToUser(bot, update.Message.Chat.ID, db)
-		return
-	}
+	// Remove the last bot's message
+	removeUpdateMessageRelative(bot, update.Message, 1)
+	newSearchNextStep(bot, update.Message.Chat.ID, db)
+}
 
-	// Add search to database
-	err = database.AddSearch(db, update.Message.Chat.ID, url)
+// Create the search from the search term collected by the steps of the new search,
+// or update the edited search.
+//
+// Parameters:
+//
+//	bot: Telegram bot instance.
+//	userID: Telegram user ID.
+//	db: Database instance of the search database.
+func newSearchCreate(bot *tgbotapi.BotAPI, userID int64, db database.SearchStore) {
+	msg := tgbotapi.NewMessage(userID, "")
 
+	state := userStates[userID]
+	url, err := parser.CreateUrl(state.term)
 	if err != nil {
 		log.Println(err)
-
+		msg.Text = "❌ Failed to create a url. Please try again."
+		sendMessage(bot, msg)
+	} else if state.search_id != 0 {
+		// Update the edited search in place
+		if err := db.UpdateSearch(userID, state.search_id, url); err != nil {
+			log.Println(err)
+			msg.Text = "❌ Failed to update the search. Please try again."
+			sendMessage(bot, msg)
+		}
+	} else if err := db.AddSearch(userID, url); err != nil {
+		// Add search to database
+		log.Println(err)
 		msg.Text = "❌ Failed to add to database. Please try again."
 		sendMessage(bot, msg)
 	}
 
 	// Remove user from userStates
-	delete(userStates, update.Message.Chat.ID)
-
-	// Remove the last bot's message
-	removeUpdateMessageRelative(bot, update.Message, 1)
-	displayAllSearchesToUser(bot, update.Message.Chat.ID, db)
+	delete(userStates, userID)
+	displayAllSearchesToUser(bot, userID, db)
 }
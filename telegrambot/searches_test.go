@@ -0,0 +1,64 @@
+package telegrambot
+
+import (
+	"apartment-parser/database"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// Open a store with a search of the user 1.
+func openSearchStore(t *testing.T) (*database.SQLStore, database.Search) {
+	t.Helper()
+	store, err := database.Open(filepath.Join(t.TempDir(), "apartibot.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	if err := store.AddSearch(1, "https://www.olx.pl/nieruchomosci/mieszkania/wynajem/warszawa/"); err != nil {
+		t.Fatal(err)
+	}
+	searches, err := store.ListSearches(1)
+	if err != nil || len(searches) != 1 {
+		t.Fatalf("ListSearches = %v, %v, want 1 search", searches, err)
+	}
+	return store, searches[0]
+}
+
+func TestEditSearchOfAnotherUser(t *testing.T) {
+	store, search := openSearchStore(t)
+	defer delete(userStates, 2)
+
+	// The callback of another user does not start editing the search
+	editSearch(nil, 2, strconv.FormatInt(search.ID, 10), store)
+	if state, ok := userStates[2]; ok {
+		t.Errorf("editing the search of another user started: %+v", state)
+	}
+}
+
+func TestSearchActionsOfAnotherUser(t *testing.T) {
+	store, search := openSearchStore(t)
+	id := strconv.FormatInt(search.ID, 10)
+
+	// The callbacks of another user do not change the search
+	togglePriceAlerts(2, id, store)
+	pauseSearch(2, id, "7", store)
+	if got, err := store.GetSearch(search.ID); err != nil || got != search {
+		t.Errorf("search changed by another user = %+v, %v, want %+v", got, err, search)
+	}
+
+	togglePriceAlerts(1, id, store)
+	pauseSearch(1, id, "0", store)
+	if got, _ := store.GetSearch(search.ID); !got.PriceAlerts || got.Active {
+		t.Errorf("search changed by its user = %+v, want price alerts on and paused", got)
+	}
+	resumeSearch(2, id, store)
+	if got, _ := store.GetSearch(search.ID); got.Active {
+		t.Errorf("search resumed by another user = %+v", got)
+	}
+	resumeSearch(1, id, store)
+	if got, _ := store.GetSearch(search.ID); !got.Active {
+		t.Errorf("search resumed by its user = %+v", got)
+	}
+}
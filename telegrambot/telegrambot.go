@@ -2,10 +2,13 @@ package telegrambot
 
 import (
 	"apartment-parser/database"
+	"apartment-parser/parser"
 
 	"errors"
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
@@ -13,6 +16,28 @@ import (
 // Stores user states for new searches
 var userStates = make(map[int64]UserNewSearch)
 
+// Maximum number of search result pages fetched per search,
+// can be changed with the MAX_SEARCH_PAGES environment variable
+var maxSearchPages = 5
+
+// Time the fetched offers and images are served from the cache without revalidation
+const cacheTTL = 24 * time.Hour
+
+// Time after which the entries not used anymore are removed from the cache
+const cacheMaxAge = 7 * 24 * time.Hour
+
+// Number of images of every new offer hashed to detect duplicates
+const imagesToHash = 3
+
+// Number of the latest offers of a user new offers are compared with to detect duplicates
+const sentOffersToCompare = 500
+
+// Time after which the stored offers are checked again for being taken down
+const removedCheckInterval = 24 * time.Hour
+
+// Number of offers checked for being taken down before the users are notified
+const removedCheckBatch = 50
+
 // Keyboard for the bot
 var keyboard = tgbotapi.NewReplyKeyboard(
 	tgbotapi.NewKeyboardButtonRow(
@@ -57,15 +82,71 @@ func StartBot(debug bool) {
 
 	log.Printf("Authorized on account %s", bot.Self.UserName)
 
-	search_db, err := database.OpenSearchesDatabase("searches.db")
+	if pages := os.Getenv("MAX_SEARCH_PAGES"); pages != "" {
+		maxSearchPages, err = strconv.Atoi(pages)
+		if err != nil || maxSearchPages < 1 {
+			log.Panic("MAX_SEARCH_PAGES must be a positive number")
+		}
+	}
+
+	// OLX lists old offers among the new ones, by default only the ones posted today are sent
+	if todayOnly := os.Getenv("OLX_TODAY_ONLY"); todayOnly != "" {
+		enabled, err := strconv.ParseBool(todayOnly)
+		if err != nil {
+			log.Panic("OLX_TODAY_ONLY must be true or false")
+		}
+		if err := parser.SetTodayOnly("olx", enabled); err != nil {
+			log.Panic(err)
+		}
+	}
+
+	// Layout changes of the sites are reported to the admin chat
+	if adminChat := os.Getenv("ADMIN_CHAT_ID"); adminChat != "" {
+		adminChatID, err := strconv.ParseInt(adminChat, 10, 64)
+		if err != nil {
+			log.Panic("ADMIN_CHAT_ID must be a chat id")
+		}
+		parser.DefaultHealthMonitor.Alert = func(source, message string) {
+			log.Printf("[ALERT] %s: %s", source, message)
+			sendMessage(bot, tgbotapi.NewMessage(adminChatID, "⚠️ "+source+": "+message))
+		}
+	}
+
+	// Selectors can be changed without a restart when the sites change their layout
+	if selectorsFile := os.Getenv("SELECTORS_FILE"); selectorsFile != "" {
+		if err := parser.LoadSelectors(selectorsFile); err != nil {
+			log.Panic(err)
+		}
+		go parser.WatchSelectors(selectorsFile, time.Minute)
+	}
+
+	// Offers matched by several searches are fetched once
+	cacheDir := os.Getenv("CACHE_DIR")
+	if cacheDir == "" {
+		cacheDir = "cache"
+	}
+	parser.DefaultFetcher.Cache, err = parser.NewCache(cacheDir, cacheTTL)
 	if err != nil {
 		log.Println(err)
 	}
 
-	offers_db, err := database.OpenOffersDatabase("offers.db")
+	// Users, searches and offers are kept in a single database, migrated at startup.
+	// A PostgreSQL url lets several bots share the database.
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		dsn = os.Getenv("DATABASE_FILE")
+	}
+	if dsn == "" {
+		dsn = "apartibot.db"
+	}
+	db, err := database.Open(dsn)
 	if err != nil {
-		log.Println(err)
+		log.Panic(err)
+	}
+	if err := db.ImportLegacyDatabases("offers.db", "searches.db"); err != nil {
+		log.Panic(err)
 	}
+	search_db, offers_db := db, db
 
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 60
@@ -73,6 +154,7 @@ func StartBot(debug bool) {
 	updates := bot.GetUpdatesChan(u)
 
 	go parseOffers(bot, offers_db, search_db)
+	go checkRemovedOffers(bot, offers_db)
 
 	// Handle updates
 	for update := range updates {
@@ -1,6 +1,8 @@
 package telegrambot
 
 import (
+	"apartment-parser/parser"
+
 	"errors"
 	"log"
 	"strconv"
@@ -15,11 +17,13 @@ import (
 //
 //	user_id: ID of the user that creates the search.
 //	state: State of the search creation process.
-//	city: City to create the search for.
+//	term: Search term filled in by the steps of the process.
+//	search_id: ID of the edited search, 0 when creating a new search.
 type UserNewSearch struct {
-	user_id int64
-	state   string
-	city    string
+	user_id   int64
+	state     string
+	term      parser.SearchTerm
+	search_id int64
 }
 
 // Structure for representing a city.
@@ -33,6 +37,59 @@ type City struct {
 	Code string
 }
 
+// Structure for representing a source of offers.
+//
+// Attributes:
+//
+//	Name: Name of the source to display.
+//	Code: Name of the source used by the parser.
+type Source struct {
+	Name string
+	Code string
+}
+
+// List the sources supported by the bot, all the sources registered in the parser.
+//
+// Returns:
+//
+//	[]Source: Sources in the order of their registration.
+func listSources() []Source {
+	registered := parser.Sources()
+	sources := make([]Source, len(registered))
+	for i, source := range registered {
+		sources[i] = Source{Name: source.DisplayName(), Code: source.Name()}
+	}
+	return sources
+}
+
+// Structure for representing an option of a filter of a new search.
+//
+// Attributes:
+//
+//	Name: Name of the option to display.
+//	Code: Value of the option used in the search term.
+type Option struct {
+	Name string
+	Code string
+}
+
+// Check if the text of the message is a single link, e.g. a pasted search url.
+//
+// Parameters:
+//
+//	text: Text of the message.
+//
+// Returns:
+//
+//	True if the text is a link, false otherwise.
+func isUrl(text string) bool {
+	text = strings.TrimSpace(text)
+	if text == "" || strings.ContainsAny(text, " \n\t") {
+		return false
+	}
+	return strings.HasPrefix(text, "http://") || strings.HasPrefix(text, "https://") || strings.HasPrefix(text, "www.")
+}
+
 // Remove the update message using a callback query.
 //
 // Parameters:
@@ -277,3 +277,75 @@ func TestPriceRangeToURLIntegration(t *testing.T) {
 		})
 	}
 }
+
+func TestRangeToText(t *testing.T) {
+	tests := []struct {
+		min  float64
+		max  float64
+		want string
+	}{
+		{1000, 2000, "1000-2000"},
+		{1500, 0, "1500+"},
+		{0, 2500, "-2500"},
+		{0, 0, ""},
+	}
+
+	for _, tt := range tests {
+		got := rangeToText(tt.min, tt.max)
+		if got != tt.want {
+			t.Errorf("rangeToText(%g, %g) = %q, want %q", tt.min, tt.max, got, tt.want)
+		}
+		if got == "" {
+			continue
+		}
+
+		// The current value is kept by entering it again
+		min, max, err := processPriceStr(got)
+		if err != nil {
+			t.Fatalf("processPriceStr(%q) error = %v", got, err)
+		}
+		if float64(min) != tt.min || float64(max) != tt.max {
+			t.Errorf("processPriceStr(%q) = %d, %d, want %g, %g", got, min, max, tt.min, tt.max)
+		}
+	}
+}
+
+func TestIsUrl(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"https://www.olx.pl/nieruchomosci/mieszkania/wynajem/poznan/", true},
+		{" www.otodom.pl/pl/wyniki/wynajem/mieszkanie ", true},
+		{"Searches 🔍", false},
+		{"1000-2000", false},
+		{"see https://www.olx.pl/", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := isUrl(tt.text); got != tt.want {
+			t.Errorf("isUrl(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestListSources(t *testing.T) {
+	sources := listSources()
+	registered := parser.Sources()
+	if len(sources) != len(registered) {
+		t.Fatalf("listSources() returned %d sources, want %d", len(sources), len(registered))
+	}
+	for i, source := range registered {
+		if sources[i].Code != source.Name() || sources[i].Name != source.DisplayName() || sources[i].Name == "" {
+			t.Errorf("listSources()[%d] = %+v, want %s", i, sources[i], source.Name())
+		}
+	}
+
+	if got := sourceName("nieruchomosci-online"); got != "Nieruchomosci-online" {
+		t.Errorf("sourceName() = %q, want the display name", got)
+	}
+	if got := sourceName("unknown"); got != "unknown" {
+		t.Errorf("sourceName() = %q, want the code of an unknown source", got)
+	}
+}